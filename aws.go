@@ -17,8 +17,10 @@
 package swift
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -38,12 +40,14 @@ type AWS struct {
 
 // NodeItem is the dynamodb table item representation of a node
 type NodeItem struct {
-	Network      string    // The name of the network the node belongs to
+	Network      string    // The names of the networks the node belongs to
 	Domain       string    // The domain name associated with the node
 	Created      time.Time // The time that the node first came online
 	Expires      int64     `json:"expires"` // The time that the node will retire from the network
 	Role         int       // The role the node has in the network
 	ScramblerKey string    // Secret used to scramble data with fixed nonce
+	Weight       *int      // Relative capacity, or nil for the default
+	Retiring     bool      // True if the node is being retired
 }
 
 // SecretItem is the dynamodb table item representation of a secret
@@ -52,6 +56,13 @@ type SecretItem struct {
 	TimeStamp    time.Time
 	Expires      int64 `json:"expires"`
 	ScramblerKey string
+	AEAD         byte // The AEAD used to encrypt data, zero for AES-GCM
+}
+
+// TableItem is the dynamodb table item representation of a table state
+type TableItem struct {
+	Table    string    // The name of the table
+	Disabled time.Time // The time the table was disabled, or zero if active
 }
 
 // NewAWS creates a new instance of the AWS structure
@@ -76,7 +87,7 @@ func NewAWS() (*AWS, error) {
 	}
 
 	a.mutex = &sync.Mutex{}
-	err = a.refresh()
+	err = a.refresh(context.Background())
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +109,13 @@ func (a *AWS) awsCreateTables() (bool, error) {
 		return false, err
 	}
 
+	// Create table states table
+	_, err = a.createTablesTable()
+	tablesExisted, err := a.checkTableExists(err)
+	if err != nil {
+		return false, err
+	}
+
 	if !nodesExisted {
 		// Wait for nodes table to be created
 		err = a.waitUntilTableActive(nodesTableName)
@@ -126,6 +144,14 @@ func (a *AWS) awsCreateTables() (bool, error) {
 		}
 	}
 
+	if !tablesExisted {
+		// Wait for table states table to be created
+		err = a.waitUntilTableActive(tablesTableName)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	return true, nil
 }
 
@@ -281,52 +307,87 @@ func (a *AWS) createSecretsTable() (*dynamodb.CreateTableOutput, error) {
 	return a.svc.CreateTable(secretsTableInput)
 }
 
+func (a *AWS) createTablesTable() (*dynamodb.CreateTableOutput, error) {
+	// Create table states table
+	tablesTableInput := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String(tableFieldName),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String(tableFieldName),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		BillingMode: aws.String("PAY_PER_REQUEST"),
+		TableName:   aws.String(tablesTableName),
+	}
+	return a.svc.CreateTable(tablesTableInput)
+}
+
 // GetNode takes a domain name and returns the associated node. If a node
 // does not exist then nil is returned.
-func (a *AWS) getNode(domain string) (*node, error) {
-	n, err := a.common.getNode(domain)
+func (a *AWS) getNode(ctx context.Context, domain string) (*node, error) {
+	n, err := a.common.getNode(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
 	if n == nil {
-		err = a.refresh()
+		err = a.refresh(ctx)
 		if err != nil {
 			return nil, err
 		}
-		n, err = a.common.getNode(domain)
+		n, err = a.common.getNode(ctx, domain)
 	}
 	return n, err
 }
 
 // GetNodes returns all the nodes associated with a network.
-func (a *AWS) getNodes(network string) (*nodes, error) {
-	ns, err := a.common.getNodes(network)
+func (a *AWS) getNodes(
+	ctx context.Context,
+	network string) (*nodes, error) {
+	ns, err := a.common.getNodes(ctx, network)
 	if err != nil {
 		return nil, err
 	}
 	if ns == nil {
-		err = a.refresh()
+		err = a.refresh(ctx)
 		if err != nil {
 			return nil, err
 		}
-		ns, err = a.common.getNodes(network)
+		ns, err = a.common.getNodes(ctx, network)
 	}
 	return ns, err
 }
 
+// getAllNodes refreshes the nodes from storage and returns all of them.
+func (a *AWS) getAllNodes(ctx context.Context) ([]*node, error) {
+	err := a.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.common.getAllNodes(ctx)
+}
+
 // SetNode inserts or updates the node.
-func (a *AWS) setNode(node *node) error {
-	err := a.setNodeSecrets(node)
+func (a *AWS) setNode(ctx context.Context, node *node) error {
+	err := a.setNodeSecrets(ctx, node)
 	if err != nil {
 		return err
 	}
+	w := node.weight
 	item := NodeItem{
-		node.network,
+		node.getNetwork(),
 		node.domain,
 		node.created,
 		node.expires.Unix(),
 		node.role,
-		node.scrambler.key}
+		node.scrambler.key,
+		&w,
+		node.retiring}
 
 	av, err := dynamodbattribute.MarshalMap(item)
 	if err != nil {
@@ -339,7 +400,7 @@ func (a *AWS) setNode(node *node) error {
 		TableName: aws.String(nodesTableName),
 	}
 
-	_, err = a.svc.PutItem(input)
+	_, err = a.svc.PutItemWithContext(ctx, input)
 	if err != nil {
 		fmt.Println("Got error calling PutItem:")
 		return err
@@ -348,29 +409,23 @@ func (a *AWS) setNode(node *node) error {
 	return nil
 }
 
-func (a *AWS) refresh() error {
+func (a *AWS) refresh(ctx context.Context) error {
 	nets := make(map[string]*nodes)
 
 	// Fetch the nodes and then add the secrets.
-	ns, err := a.fetchNodes()
+	ns, err := a.fetchNodes(ctx)
 	if err != nil {
 		return err
 	}
-	err = a.addSecrets(ns)
+	err = a.addSecrets(ctx, ns)
 	if err != nil {
 		return err
 	}
 
 	// Create a map of networks from the nodes found.
 	for _, v := range ns {
-		net := nets[v.network]
-		if net == nil {
-			net = &nodes{}
-			net.dict = make(map[string]*node)
-			nets[v.network] = net
-		}
-		net.all = append(net.all, v)
-		net.dict[v.domain] = v
+		v.clock = a.clock
+		addNodeToNetworks(nets, v)
 	}
 
 	// Finally sort the nodes by hash values and whether they are active.
@@ -388,7 +443,7 @@ func (a *AWS) refresh() error {
 	return nil
 }
 
-func (a *AWS) fetchNodes() (map[string]*node, error) {
+func (a *AWS) fetchNodes(ctx context.Context) (map[string]*node, error) {
 	var err error
 	ns := make(map[string]*node)
 
@@ -397,7 +452,7 @@ func (a *AWS) fetchNodes() (map[string]*node, error) {
 		TableName: aws.String(nodesTableName),
 	}
 
-	result, err := a.svc.Scan(params)
+	result, err := a.svc.ScanWithContext(ctx, params)
 	if err != nil {
 		fmt.Println("Query API call failed:")
 		fmt.Println((err.Error()))
@@ -426,19 +481,21 @@ func (a *AWS) fetchNodes() (map[string]*node, error) {
 		if err != nil {
 			return nil, err
 		}
+		ns[nodeItem.Domain].weight = getWeight(nodeItem.Weight)
+		ns[nodeItem.Domain].retiring = nodeItem.Retiring
 	}
 
 	return ns, err
 }
 
-func (a *AWS) addSecrets(ns map[string]*node) error {
+func (a *AWS) addSecrets(ctx context.Context, ns map[string]*node) error {
 
 	// Fetch all the records from the secrets table in DynamoDB.
 	params := &dynamodb.ScanInput{
 		TableName: aws.String(secretsTableName),
 	}
 
-	result, err := a.svc.Scan(params)
+	result, err := a.svc.ScanWithContext(ctx, params)
 	if err != nil {
 		fmt.Println("Query API call failed:")
 		fmt.Println((err.Error()))
@@ -456,7 +513,10 @@ func (a *AWS) addSecrets(ns map[string]*node) error {
 			return err
 		}
 
-		s, err := newSecretFromKey(secretItem.ScramblerKey, secretItem.TimeStamp)
+		s, err := newSecretFromKeyWithAEAD(
+			secretItem.ScramblerKey,
+			secretItem.TimeStamp,
+			secretItem.AEAD)
 		if err != nil {
 			return err
 		}
@@ -465,7 +525,7 @@ func (a *AWS) addSecrets(ns map[string]*node) error {
 		}
 	}
 
-	// Sort the secrets so the most recent is at the start of the array.
+	// Sort the secrets so the most recent is at the end of the array.
 	for _, n := range ns {
 		n.sortSecrets()
 	}
@@ -473,7 +533,7 @@ func (a *AWS) addSecrets(ns map[string]*node) error {
 	return nil
 }
 
-func (a *AWS) setNodeSecrets(node *node) error {
+func (a *AWS) setNodeSecrets(ctx context.Context, node *node) error {
 	var pi []*dynamodb.WriteRequest
 
 	for _, s := range node.secrets {
@@ -481,7 +541,8 @@ func (a *AWS) setNodeSecrets(node *node) error {
 			node.domain,
 			s.timeStamp,
 			node.expires.Unix(),
-			s.key}
+			s.key,
+			s.crypto.aead}
 
 		av, err := dynamodbattribute.MarshalMap(item)
 		if err != nil {
@@ -502,9 +563,90 @@ func (a *AWS) setNodeSecrets(node *node) error {
 		},
 	}
 
-	_, err := a.svc.BatchWriteItem(input)
+	_, err := a.svc.BatchWriteItemWithContext(ctx, input)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// addTable records the table without altering the time it was disabled if it
+// has already been recorded.
+func (a *AWS) addTable(ctx context.Context, table string) error {
+	return a.addTableOnce(table, func() error {
+		av, err := dynamodbattribute.MarshalMap(TableItem{Table: table})
+		if err != nil {
+			return err
+		}
+		_, err = a.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			Item:                av,
+			TableName:           aws.String(tablesTableName),
+			ConditionExpression: aws.String("attribute_not_exists(#t)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#t": aws.String(tableFieldName)},
+		})
+		if aerr, ok := err.(awserr.Error); ok &&
+			aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return nil
+		}
+		return err
+	})
+}
+
+func (a *AWS) getTables(ctx context.Context) ([]string, error) {
+	result, err := a.svc.ScanWithContext(ctx, &dynamodb.ScanInput{
+		TableName: aws.String(tablesTableName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	t := make([]string, 0, len(result.Items))
+	for _, i := range result.Items {
+		var item TableItem
+		err = dynamodbattribute.UnmarshalMap(i, &item)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, item.Table)
+	}
+	sort.Strings(t)
+	return t, nil
+}
+
+// getTableDisabled reads the table state from storage so that tables disabled
+// by any instance are seen immediately.
+func (a *AWS) getTableDisabled(
+	ctx context.Context,
+	table string) (time.Time, error) {
+	result, err := a.svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tablesTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			tableFieldName: {S: aws.String(table)}},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var item TableItem
+	if result.Item != nil {
+		err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return item.Disabled, nil
+}
+
+func (a *AWS) setTableDisabled(
+	ctx context.Context,
+	table string,
+	disabled time.Time) error {
+	av, err := dynamodbattribute.MarshalMap(TableItem{table, disabled})
+	if err != nil {
+		return err
+	}
+	_, err = a.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(tablesTableName),
+	})
+	return err
+}
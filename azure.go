@@ -17,6 +17,10 @@
 package swift
 
 import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -24,7 +28,8 @@ import (
 )
 
 const (
-	azureTimeout = 2
+	azureTimeout         = 2
+	azureTablesPartition = "tables" // Partition key for the table states
 )
 
 // Azure is a implementation of sws.Store for Microsoft's Azure table storage.
@@ -32,6 +37,7 @@ type Azure struct {
 	timestamp    time.Time      // The last time the maps were refreshed
 	nodesTable   *storage.Table // Reference to the node table
 	secretsTable *storage.Table // Reference to the table of node secrets
+	tablesTable  *storage.Table // Reference to the table of table states
 	common
 }
 
@@ -55,53 +61,75 @@ func NewAzure(account string, accessKey string) (*Azure, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = a.refresh()
+	a.tablesTable = ts.GetTableReference(tablesTableName)
+	err = azureCreateTable(a.tablesTable)
+	if err != nil {
+		return nil, err
+	}
+	err = a.refresh(context.Background())
 	if err != nil {
 		return nil, err
 	}
 	return &a, nil
 }
 
-func (a *Azure) getNode(domain string) (*node, error) {
-	n, err := a.common.getNode(domain)
+func (a *Azure) getNode(ctx context.Context, domain string) (*node, error) {
+	n, err := a.common.getNode(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
 	if n == nil {
-		err = a.refresh()
+		err = a.refresh(ctx)
 		if err != nil {
 			return nil, err
 		}
-		n, err = a.common.getNode(domain)
+		n, err = a.common.getNode(ctx, domain)
 	}
 	return n, err
 }
 
-func (a *Azure) getNodes(network string) (*nodes, error) {
-	ns, err := a.common.getNodes(network)
+func (a *Azure) getNodes(
+	ctx context.Context,
+	network string) (*nodes, error) {
+	ns, err := a.common.getNodes(ctx, network)
 	if err != nil {
 		return nil, err
 	}
 	if ns == nil {
-		err = a.refresh()
+		err = a.refresh(ctx)
 		if err != nil {
 			return nil, err
 		}
-		ns, err = a.common.getNodes(network)
+		ns, err = a.common.getNodes(ctx, network)
 	}
 	return ns, err
 }
 
-func (a *Azure) setNode(node *node) error {
-	err := a.setNodeSecrets(node)
+// getAllNodes refreshes the nodes from storage and returns all of them.
+func (a *Azure) getAllNodes(ctx context.Context) ([]*node, error) {
+	err := a.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.common.getAllNodes(ctx)
+}
+
+func (a *Azure) setNode(ctx context.Context, node *node) error {
+	err := a.setNodeSecrets(ctx, node)
 	if err != nil {
 		return err
 	}
-	e := a.nodesTable.GetEntityReference(node.network, node.domain)
+	e := a.nodesTable.GetEntityReference(node.getNetwork(), node.domain)
 	e.Properties = make(map[string]interface{})
 	e.Properties[expiresFieldName] = node.expires
 	e.Properties[roleFieldName] = node.role
 	e.Properties[scramblerKeyFieldName] = node.scrambler.key
+	e.Properties[weightFieldName] = node.weight
+	e.Properties[retiringFieldName] = node.retiring
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
 	return e.Insert(storage.FullMetadata, nil)
 }
 
@@ -120,14 +148,22 @@ func azureCreateTable(t *storage.Table) error {
 	return nil
 }
 
-func (a *Azure) refresh() error {
+func (a *Azure) refresh(ctx context.Context) error {
 	nets := make(map[string]*nodes)
 
-	// Fetch the nodes and then add the secrets.
+	// Fetch the nodes and then add the secrets. The table storage client does
+	// not accept a context so cancellation is checked between requests.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	ns, err := a.fetchNodes()
 	if err != nil {
 		return err
 	}
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
 	err = a.addSecrets(ns)
 	if err != nil {
 		return err
@@ -135,14 +171,8 @@ func (a *Azure) refresh() error {
 
 	// Create a map of networks from the nodes found.
 	for _, v := range ns {
-		net := nets[v.network]
-		if net == nil {
-			net = &nodes{}
-			net.dict = make(map[string]*node)
-			nets[v.network] = net
-		}
-		net.all = append(net.all, v)
-		net.dict[v.domain] = v
+		v.clock = a.clock
+		addNodeToNetworks(nets, v)
 	}
 
 	// Finally sort the nodes by hash values and whether they are active.
@@ -173,7 +203,11 @@ func (a *Azure) addSecrets(ns map[string]*node) error {
 
 	// Iterate over the secrets adding them to nodes.
 	for _, i := range e.Entities {
-		s, err := newSecretFromKey(i.RowKey, i.TimeStamp)
+		var aead byte
+		if v, ok := i.Properties[aeadFieldName].(float64); ok {
+			aead = byte(v)
+		}
+		s, err := newSecretFromKeyWithAEAD(i.RowKey, i.TimeStamp, aead)
 		if err != nil {
 			return err
 		}
@@ -182,7 +216,7 @@ func (a *Azure) addSecrets(ns map[string]*node) error {
 		}
 	}
 
-	// Sort the secrets so the most recent is at the start of the array.
+	// Sort the secrets so the most recent is at the end of the array.
 	for _, n := range ns {
 		n.sortSecrets()
 	}
@@ -216,15 +250,26 @@ func (a *Azure) fetchNodes() (map[string]*node, error) {
 		if err != nil {
 			return nil, err
 		}
+		if w, ok := i.Properties[weightFieldName].(float64); ok {
+			ns[i.RowKey].weight = int(w)
+		}
+		if r, ok := i.Properties[retiringFieldName].(bool); ok {
+			ns[i.RowKey].retiring = r
+		}
 	}
 
 	return ns, err
 }
 
-func (a *Azure) setNodeSecrets(node *node) error {
+func (a *Azure) setNodeSecrets(ctx context.Context, node *node) error {
 	for _, s := range node.secrets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		e := a.secretsTable.GetEntityReference(node.domain, s.key)
 		e.TimeStamp = s.timeStamp
+		e.Properties = make(map[string]interface{})
+		e.Properties[aeadFieldName] = int(s.crypto.aead)
 		err := e.Insert(storage.FullMetadata, nil)
 		if err != nil {
 			return err
@@ -232,3 +277,86 @@ func (a *Azure) setNodeSecrets(node *node) error {
 	}
 	return nil
 }
+
+// getTableEntity returns the entity for the table state. The row key is the
+// table name in URL safe base 64 as table names can contain characters that
+// are not allowed in keys.
+func (a *Azure) getTableEntity(table string) *storage.Entity {
+	return a.tablesTable.GetEntityReference(
+		azureTablesPartition,
+		base64.RawURLEncoding.EncodeToString([]byte(table)))
+}
+
+// addTable records the table without altering the time it was disabled if it
+// has already been recorded.
+func (a *Azure) addTable(ctx context.Context, table string) error {
+	return a.addTableOnce(table, func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		e := a.getTableEntity(table)
+		e.Properties = make(map[string]interface{})
+		e.Properties[tableFieldName] = table
+		return e.InsertOrMerge(nil)
+	})
+}
+
+func (a *Azure) getTables(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	e, err := a.tablesTable.QueryEntities(
+		azureTimeout,
+		storage.FullMetadata,
+		nil)
+	if err != nil {
+		return nil, err
+	}
+	t := make([]string, 0, len(e.Entities))
+	for _, i := range e.Entities {
+		if v, ok := i.Properties[tableFieldName].(string); ok {
+			t = append(t, v)
+		}
+	}
+	sort.Strings(t)
+	return t, nil
+}
+
+// getTableDisabled reads the table state from storage so that tables disabled
+// by any instance are seen immediately.
+func (a *Azure) getTableDisabled(
+	ctx context.Context,
+	table string) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	e := a.getTableEntity(table)
+	err := e.Get(azureTimeout, storage.FullMetadata, nil)
+	if err != nil {
+		if v, ok := err.(storage.AzureStorageServiceError); ok &&
+			v.StatusCode == http.StatusNotFound {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	d, _ := e.Properties[disabledFieldName].(time.Time)
+	return d, nil
+}
+
+// setTableDisabled replaces the table state. The disabled time is not stored
+// if the table is active.
+func (a *Azure) setTableDisabled(
+	ctx context.Context,
+	table string,
+	disabled time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e := a.getTableEntity(table)
+	e.Properties = make(map[string]interface{})
+	e.Properties[tableFieldName] = table
+	if disabled.IsZero() == false {
+		e.Properties[disabledFieldName] = disabled
+	}
+	return e.InsertOrReplace(nil)
+}
@@ -0,0 +1,42 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import "time"
+
+// Clock interface provides the current time for all time dependent logic. An
+// implementation can be provided to Services to control the time in tests or
+// to use a time source other than the system clock.
+type Clock interface {
+
+	// Now returns the current UTC time.
+	Now() time.Time
+}
+
+// systemClock is the default implementation of Clock using the system clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now().UTC() }
+
+// nowFrom returns the current UTC time from the clock, or from the system clock
+// if the clock is nil.
+func nowFrom(c Clock) time.Time {
+	if c == nil {
+		return systemClock{}.Now()
+	}
+	return c.Now()
+}
@@ -0,0 +1,256 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// clockTest is a clock that returns a fixed time which can be advanced.
+type clockTest struct {
+	now time.Time
+}
+
+func (c *clockTest) Now() time.Time { return c.now }
+
+func TestClockPairExpired(t *testing.T) {
+	c := &clockTest{time.Now().UTC()}
+	p, err := createPair(
+		"a>"+c.now.AddDate(0, 0, 2).Format("2006-01-02"),
+		"1",
+		c.Now(),
+		&Configuration{})
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if p.isExpiredAt(c.Now()) {
+		fmt.Println("Pair should not have expired")
+		t.Fail()
+	}
+	c.now = c.now.AddDate(0, 0, 3)
+	if p.isExpiredAt(c.Now()) == false {
+		fmt.Println("Pair should have expired after the clock advanced")
+		t.Fail()
+	}
+	_, err = createPair(
+		"a>"+c.now.AddDate(0, 0, -1).Format("2006-01-02"),
+		"1",
+		c.Now(),
+		&Configuration{})
+	if err == nil {
+		fmt.Println("Pair expiring before the clock time should be invalid")
+		t.Fail()
+	}
+}
+
+func TestClockDecodeExpired(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c := &clockTest{time.Now().UTC()}
+	s.SetClock(c)
+	r := newResultsTest(2)
+	r.Expires = c.now.AddDate(1, 0, 0)
+	r.Values[1].Expires = c.now.AddDate(0, 2, 0)
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Advance the clock past the expiry of the first value only.
+	c.now = c.now.AddDate(0, 1, 1)
+	w := testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var v []*Result
+	err = json.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(v) != 1 || v[0].Key != "key1" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+
+	// Advance the clock past the expiry of the results.
+	c.now = c.now.AddDate(1, 0, 0)
+	w = testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
+
+func TestClockNodeExpired(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	x, err := newSecret(time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n.addSecret(x)
+	c := &clockTest{time.Now().UTC()}
+	n.clock = c
+	if n.isActive() == false {
+		fmt.Println("Node should be active")
+		t.Fail()
+	}
+	c.now = n.expires.Add(time.Second)
+	if n.isActive() {
+		fmt.Println("Node should not be active after the clock advanced")
+		t.Fail()
+	}
+}
+
+func TestClockServicesNodes(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c := &clockTest{time.Now().UTC()}
+	s.SetClock(c)
+
+	// Nodes already in the store and those added later use the clock.
+	v, ok := s.store.(*Volatile)
+	if ok == false {
+		fmt.Println("Expected a volatile store")
+		t.Fail()
+		return
+	}
+	a, err := v.testAddNode(testNetwork, "added.com", roleStorage)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, i := range []*node{n, a} {
+		if i.isActive() == false {
+			fmt.Printf("Node '%s' should be active\n", i.domain)
+			t.Fail()
+		}
+	}
+	c.now = c.now.AddDate(2, 0, 0)
+	for _, i := range []*node{n, a} {
+		if i.isActive() {
+			fmt.Printf("Node '%s' should not be active after the clock "+
+				"advanced\n", i.domain)
+			t.Fail()
+		}
+	}
+}
+
+func TestClockRotateNodeSecrets(t *testing.T) {
+	v, err := newVolatileNetworkTest(1)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c := &clockTest{time.Now().UTC().AddDate(0, 0, 1)}
+	s.SetClock(c)
+	err = s.RotateNodeSecrets(testAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n, err := v.getNode(context.Background(), testAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The new secret becomes active at the time from the clock.
+	x := n.secrets[len(n.secrets)-1]
+	if x.timeStamp.Equal(c.now) == false || x.timeStamp.Location() != time.UTC {
+		fmt.Printf("Expected '%s' but got '%s'\n", c.now, x.timeStamp)
+		t.Fail()
+	}
+}
+
+func TestClockResults(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c := &clockTest{time.Now().UTC()}
+	s.SetClock(c)
+	r := newResultsTest(1)
+	r.Expires = c.now.AddDate(1, 0, 0)
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := decryptResultsData(context.Background(), s, n, d, "")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if a.Has("key0") == false ||
+		a.Values[0].IsExpired() ||
+		a.IsTimeStampValid() == false {
+		fmt.Println("Results should be valid")
+		t.Fail()
+	}
+
+	// Advance the clock past the expiry of the value and the results.
+	c.now = c.now.AddDate(2, 0, 0)
+	if a.Has("key0") ||
+		a.Values[0].IsExpired() == false ||
+		a.IsTimeStampValid() ||
+		a.Merge(a).Has("key0") {
+		fmt.Println("Results should use the clock of the services")
+		t.Fail()
+	}
+}
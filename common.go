@@ -17,7 +17,9 @@
 package swift
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -27,6 +29,8 @@ type common struct {
 	nodes    map[string]*node  // Map of domain names to nodes
 	networks map[string]*nodes // Map of network names to nodes
 	mutex    *sync.Mutex       // mutual-exclusion lock used for refresh
+	clock    Clock             // Clock for the nodes, or nil for the system
+	tables   map[string]bool   // Tables already recorded in the store
 }
 
 func (c *common) init() {
@@ -37,8 +41,10 @@ func (c *common) init() {
 
 // GetAccessNode returns an access node for the network, or null if there is no
 // access node available.
-func (c *common) GetAccessNode(network string) (string, error) {
-	nodes, err := c.getNodes(network)
+func (c *common) GetAccessNode(
+	ctx context.Context,
+	network string) (string, error) {
+	nodes, err := c.getNodes(ctx, network)
 	if err != nil {
 		return "", err
 	}
@@ -54,13 +60,84 @@ func (c *common) GetAccessNode(network string) (string, error) {
 	return node.domain, nil
 }
 
+// setClock sets the clock used by the nodes currently held and those added
+// when the nodes are next refreshed.
+func (c *common) setClock(k Clock) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.clock = k
+	for _, n := range c.nodes {
+		n.clock = k
+	}
+}
+
+// addTableOnce calls the function provided to record the table in the store
+// the first time the table is used by this instance so that the store is not
+// written to for every storage operation.
+func (c *common) addTableOnce(table string, f func() error) error {
+	c.mutex.Lock()
+	ok := c.tables[table]
+	c.mutex.Unlock()
+	if ok {
+		return nil
+	}
+	err := f()
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	if c.tables == nil {
+		c.tables = make(map[string]bool)
+	}
+	c.tables[table] = true
+	c.mutex.Unlock()
+	return nil
+}
+
 // getNode takes a domain name and returns the associated node. If a node
 // does not exist then nil is returned.
-func (c *common) getNode(domain string) (*node, error) {
+func (c *common) getNode(ctx context.Context, domain string) (*node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return c.nodes[domain], nil
 }
 
+// addNodeToNetworks adds the node to each of the networks it belongs to,
+// creating the network if it does not already exist.
+func addNodeToNetworks(nets map[string]*nodes, n *node) {
+	for _, v := range n.networks {
+		net := nets[v]
+		if net == nil {
+			net = newNodes()
+			nets[v] = net
+		}
+		net.all = append(net.all, n)
+		net.dict[n.domain] = n
+	}
+}
+
 // getNodes returns all the nodes associated with a network.
-func (c *common) getNodes(network string) (*nodes, error) {
+func (c *common) getNodes(
+	ctx context.Context,
+	network string) (*nodes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return c.networks[network], nil
 }
+
+// getAllNodes returns all the nodes in every network ordered by domain name.
+func (c *common) getAllNodes(ctx context.Context) ([]*node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	a := make([]*node, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		a = append(a, n)
+	}
+	c.mutex.Unlock()
+	sort.Slice(a, func(i, j int) bool { return a[i].domain < a[j].domain })
+	return a, nil
+}
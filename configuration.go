@@ -17,11 +17,35 @@
 package swift
 
 import (
+	"compress/zlib"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	defaultMaxPairs      = 255   // The most pairs an operation can serialize
+	defaultMaxValueBytes = 65536 // Default limit for the total value bytes
+	defaultMinBounces    = 1     // Fewest nodes an operation can visit
+	defaultMaxBounces    = 254   // Most nodes an operation can visit
+	defaultOpTimeout     = 300   // Default seconds to complete an operation
+	defaultMaxNonces     = 65536 // Default completed operations to remember
+	defaultClockSkew     = 5     // Default seconds of clock skew tolerated
+	defaultRetirement    = 30    // Default days a retiring node stays active
+	defaultWebhookTime   = 10    // Default seconds to wait for a webhook
+	defaultWebhookRetry  = 3     // Default retries of a failed webhook
+	defaultWebhookDelay  = 1000  // Default milliseconds before the first retry
+	defaultURLLength     = 2000  // URL length all browsers support
+	defaultPayloadWarn   = 80    // Default URL length percentage to warn at
+	defaultNodeRetry     = 2     // Default retries of a failed node request
+	defaultNodeDelay     = 100   // Default milliseconds before the first retry
+	defaultNodeDeadline  = 10    // Default seconds for a node request
+	defaultTableGrace    = 30    // Default days a disabled table can return
 )
 
 // Configuration maps to the appsettings.json settings file.
@@ -54,8 +78,210 @@ type Configuration struct {
 	NodeCount byte `json:"nodeCount"`
 	// True to enable debug logging and user interfaces.
 	Debug bool `json:"debug"`
+	// The number of seconds between checks that the nodes in the network are
+	// reachable. Zero disables the background checks.
+	NodeHealthInterval time.Duration `json:"nodeHealthInterval"`
+	// The zlib compression level between 1 (fastest) and 9 (smallest) used
+	// when encrypting data. Zero uses the zlib default level.
+	CompressionLevel int `json:"compressionLevel"`
+	// The maximum number of key value pairs that can be included in a single
+	// storage operation. Zero uses the default of 255.
+	MaxPairs int `json:"maxPairs"`
+	// The maximum total number of bytes across all the values in a single
+	// storage operation. Zero uses the default of 65536.
+	MaxValueBytes int `json:"maxValueBytes"`
+	// The number of seconds after a node secret is superseded by a newer
+	// secret that it continues to be used for decryption before it is removed.
+	SecretRetirement time.Duration `json:"secretRetirement"`
+	// Access keys that are allowed to use the handlers in addition to those
+	// allowed by the access service. Multiple keys allow a new key to be
+	// introduced before the old key is removed.
+	AccessKeys []string `json:"accessKeys"`
+	// The number of seconds from creation that a storage operation must
+	// complete within. Operations that return after this deadline are rejected.
+	// Zero uses the default of 300 seconds.
+	OperationTimeout time.Duration `json:"operationTimeout"`
+	// Access keys mapped to the table names they can be used with. A table
+	// name ending in '*' allows any table that starts with the characters
+	// before it. Access keys that are not present can be used with any table.
+	AccessKeyTables map[string][]string `json:"accessKeyTables"`
+	// The fewest nodes that can be requested via the bounces parameter when
+	// creating a storage operation. Zero uses the default of 1.
+	MinBounces byte `json:"minBounces"`
+	// The most nodes that can be requested via the bounces parameter when
+	// creating a storage operation. Zero uses the default of 254.
+	MaxBounces byte `json:"maxBounces"`
+	// The number of storage operations per second that can be created with
+	// the same access key, or from the same IP address if there is no access
+	// key. Zero disables rate limiting.
+	CreateRate float64 `json:"createRate"`
+	// The number of storage operations that can be created in a burst before
+	// the CreateRate applies. Values less than 1 are treated as 1.
+	CreateBurst int `json:"createBurst"`
+	// The origins that browsers can call the API handlers from. The request's
+	// origin is returned in the Access-Control-Allow-Origin header if it is
+	// present. An entry of '*' allows any origin. If empty then any origin is
+	// allowed without credentials.
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// True to return the Access-Control-Allow-Credentials header for allowed
+	// origins. Requires AllowedOrigins to be set without an entry of '*'.
+	AllowCredentials bool `json:"allowCredentials"`
+	// The number of completed storage operations the access node remembers
+	// to prevent the results being used more than once. Zero uses the default
+	// of 65536.
+	MaxNonces int `json:"maxNonces"`
+	// The number of seconds of difference between the clocks of the nodes
+	// that is tolerated when checking if results have expired. Results are
+	// accepted for this long after their expiry time. Zero uses the default of
+	// 5 seconds. A negative value disables the tolerance.
+	ClockSkew time.Duration `json:"clockSkew"`
+	// The number of seconds between sweeps that remove expired state held by
+	// the node. Zero disables the background sweeps.
+	PruneInterval time.Duration `json:"pruneInterval"`
+	// The number of days until a value expires if the key does not include a
+	// conflict character. Such values are newest wins. Used when migrating
+	// clients that send bare keys. Zero rejects keys without a conflict
+	// character.
+	DefaultExpiry int `json:"defaultExpiry"`
+	// The most days in the future that a value can expire. Keys with a later
+	// expiry date are rejected. Zero allows any expiry date.
+	MaxExpiry int `json:"maxExpiry"`
+	// Access keys that peer nodes use to fetch scramble key material from the
+	// share secret handler. These must not also be AccessKeys so that public
+	// clients can never obtain the material. If empty then the handler rejects
+	// all requests.
+	PeerKeys []string `json:"peerKeys"`
+	// Domains of other access nodes whose secrets are tried in order when the
+	// access node handling the request can not decrypt the data. Used when
+	// migrating to a new access node so that results encrypted by the old
+	// access node can still be decoded. Empty uses only the request's node.
+	DecodeAccessNodes []string `json:"decodeAccessNodes"`
+	// The encoding used for scrambled names and the data in URLs. One of
+	// base64url, base32 or base58. Values other than base64url start with a
+	// prefix that identifies the encoding. Changing the encoding changes the
+	// path of the cookies so existing cookies are no longer sent by browsers.
+	// Empty uses base64url.
+	Encoding string `json:"encoding"`
+	// The AEAD used to encrypt data with the secrets created when nodes are
+	// registered or their secrets rotated. One of aes-gcm or
+	// chacha20-poly1305. The AEAD is stored with each secret so existing
+	// secrets keep their AEAD. Empty uses aes-gcm.
+	AEAD string `json:"aead"`
+	// The number of days a node remains active after it is retired so that
+	// the values it holds can be carried to the new home nodes by storage
+	// operations. Zero uses the default of 30 days.
+	NodeRetirement int `json:"nodeRetirement"`
+	// The Cache-Control header for each API handler keyed by the name of the
+	// handler in the URL path, for example decode-as-json. Handlers that are
+	// not present use no-cache. Storage operation pages and errors are never
+	// cached.
+	CacheControl map[string]string `json:"cacheControl"`
+	// The URL that the final node of every storage operation posts the
+	// encrypted results to. A webhook URL provided when the operation is
+	// created is used instead. Empty disables the webhook unless provided.
+	WebhookURL string `json:"webhookUrl"`
+	// The number of seconds to wait for the webhook to respond. Zero uses the
+	// default of 10 seconds.
+	WebhookTimeout time.Duration `json:"webhookTimeout"`
+	// The number of times a failed webhook is retried. Zero uses the default
+	// of 3 and a negative value disables retries.
+	WebhookRetries int `json:"webhookRetries"`
+	// The number of milliseconds before the first retry of a failed webhook.
+	// The delay doubles for each subsequent retry. Zero uses the default of
+	// 1000 milliseconds.
+	WebhookRetryDelay int `json:"webhookRetryDelay"`
+	// True to encrypt the values and operations of each table with keys
+	// derived from the node secrets and the table name. Data encrypted with
+	// the node secrets before this was enabled can still be decrypted.
+	// Decode requests must include the table parameter.
+	TableSecrets bool `json:"tableSecrets"`
+	// The most characters in the URL that starts a storage operation. Values
+	// are carried in the URL so too many or too large values result in URLs
+	// that web browsers truncate or refuse. The number of bounces does not
+	// affect the length. Zero disables the check. Around 2000 is supported by
+	// all browsers.
+	MaxURLLength int `json:"maxUrlLength"`
+	// True to use the X-Real-IP header set by a reverse proxy such as nginx
+	// as the client IP address when finding the home node. X-Forwarded-For
+	// takes precedence if present, and the remote address is used if neither
+	// header is present.
+	UseRealIP bool `json:"useRealIp"`
+	// The percentage of the maximum URL length at or above which the create
+	// handler adds the payload utilization header to warn the caller that the
+	// values are approaching the limit. The maximum is MaxURLLength, or 2000 if
+	// not set. Zero uses the default of 80 and a negative value disables the
+	// warning.
+	PayloadWarning int `json:"payloadWarning"`
+	// The number of times a request from one node to another that fails with
+	// a timeout, a network error or a 502, 503 or 504 status code is retried.
+	// Used when the final node of a storage operation calls the access node.
+	// Zero uses the default of 2 and a negative value disables retries.
+	NodeRetries int `json:"nodeRetries"`
+	// The number of milliseconds before the first retry of a failed request
+	// to another node. The delay doubles for each subsequent retry. Zero uses
+	// the default of 100 milliseconds.
+	NodeRetryDelay int `json:"nodeRetryDelay"`
+	// The number of seconds that a request to another node, including all the
+	// retries, must complete within. Zero uses the default of 10 seconds.
+	NodeDeadline time.Duration `json:"nodeDeadline"`
+	// The number of reverse proxies in front of the node that each append the
+	// address they received the request from to X-Forwarded-For. The client
+	// address used to find the home node is then the entry this many places
+	// from the end, ignoring earlier entries that the client could have set to
+	// choose their home node. If there are fewer entries the header is ignored.
+	// Zero uses the first entry which is compatible with earlier versions but
+	// can be spoofed by clients.
+	TrustedProxies int `json:"trustedProxies"`
+	// The number of days after a table is disabled that it can be enabled
+	// again to restore reads of the values it contains. Zero uses the default
+	// of 30 days.
+	TableGracePeriod int `json:"tableGracePeriod"`
+	// The number of seconds either side of the nominal expiry time that the
+	// expiry of each value is randomly moved by so that values stored at the
+	// same time do not all expire together. Expiry is never moved past
+	// MaxExpiry. Zero disables the jitter.
+	ExpiryJitter int `json:"expiryJitter"`
+	// The most bytes that can be read from the body of a request to the
+	// handlers. Larger requests are rejected with request entity too large.
+	// Zero uses the default of 1MB. A negative value disables the limit.
+	MaxRequestBytes int64 `json:"maxRequestBytes"`
+	// The number of storage nodes each value is written to. These are the
+	// home node and the storage nodes that follow it in hash order, which
+	// become the home node if the nodes before them are not alive. Can be
+	// overridden for an operation with the redundancy parameter. Zero uses the
+	// default of 1, the home node only.
+	Redundancy byte `json:"redundancy"`
+	// True to normalize keys and values to Unicode normalization form C when
+	// storage operations are created so that the same text entered in
+	// different forms is treated as the same key or value.
+	NormalizeUnicode bool `json:"normalizeUnicode"`
 }
 
+// The Cache-Control header used by API handlers unless configured otherwise.
+const defaultCacheControl = "no-cache"
+
+// The names of the API handlers that can have the Cache-Control header
+// configured.
+var cacheControlHandlers = []string{
+	"register",
+	"create",
+	"delete",
+	"encrypt",
+	"decrypt",
+	"refresh",
+	"decode-as-json",
+	"decode-many-as-json",
+	"decode-as-csv",
+	"validate-keys",
+	"key-ttl",
+	"decode-key",
+	"decode-keys",
+	"has-keys",
+	"status",
+	"operation-info",
+	"unscramble",
+	"tables"}
+
 // NewConfig creates a new instance of configuration from the file provided.
 func NewConfig(file string) Configuration {
 	var c Configuration
@@ -108,5 +334,378 @@ func (c *Configuration) Validate() error {
 			err = fmt.Errorf("SWIFT ProgressColor missing in config")
 		}
 	}
+	if err == nil {
+		if c.CompressionLevel < 0 || c.CompressionLevel > zlib.BestCompression {
+			err = fmt.Errorf(
+				"SWIFT CompressionLevel '%d' must be between 0 and %d",
+				c.CompressionLevel,
+				zlib.BestCompression)
+		}
+	}
+	if err == nil {
+		if c.minBounces() > c.maxBounces() {
+			err = fmt.Errorf(
+				"SWIFT MinBounces '%d' must not exceed MaxBounces '%d'",
+				c.minBounces(),
+				c.maxBounces())
+		}
+	}
+	if err == nil {
+		if c.NodeCount != 0 &&
+			(int(c.NodeCount) < c.minBounces() ||
+				int(c.NodeCount) > c.maxBounces()) {
+			err = fmt.Errorf(
+				"SWIFT NodeCount '%d' must be between %d and %d",
+				c.NodeCount,
+				c.minBounces(),
+				c.maxBounces())
+		}
+	}
+	if err == nil {
+		if c.MaxExpiry > 0 && c.DefaultExpiry > c.MaxExpiry {
+			err = fmt.Errorf(
+				"SWIFT DefaultExpiry '%d' must not exceed MaxExpiry '%d'",
+				c.DefaultExpiry,
+				c.MaxExpiry)
+		}
+	}
+	if err == nil {
+		if _, ok := encodingNames[c.Encoding]; ok == false {
+			err = fmt.Errorf(
+				"SWIFT Encoding '%s' must be base64url, base32 or base58",
+				c.Encoding)
+		}
+	}
+	if err == nil {
+		if _, ok := aeadNames[c.AEAD]; ok == false {
+			err = fmt.Errorf(
+				"SWIFT AEAD '%s' must be aes-gcm or chacha20-poly1305",
+				c.AEAD)
+		}
+	}
+	if err == nil {
+		for _, p := range c.PeerKeys {
+			for _, a := range c.AccessKeys {
+				if p == a {
+					err = fmt.Errorf(
+						"SWIFT PeerKeys must not also be AccessKeys")
+				}
+			}
+		}
+	}
+	if err == nil {
+		for k, v := range c.CacheControl {
+			f := false
+			for _, h := range cacheControlHandlers {
+				if h == k {
+					f = true
+					break
+				}
+			}
+			if f == false {
+				err = fmt.Errorf("SWIFT CacheControl handler '%s' unknown", k)
+			} else if strings.TrimSpace(v) == "" {
+				err = fmt.Errorf(
+					"SWIFT CacheControl for handler '%s' must not be empty", k)
+			}
+		}
+	}
+	if err == nil {
+		if int(c.Redundancy) >= c.maxBounces() {
+			err = fmt.Errorf(
+				"SWIFT Redundancy '%d' must be less than %d",
+				c.Redundancy,
+				c.maxBounces())
+		}
+	}
+	if err == nil {
+		if c.ExpiryJitter < 0 {
+			err = fmt.Errorf(
+				"SWIFT ExpiryJitter '%d' must not be negative",
+				c.ExpiryJitter)
+		}
+	}
+	if err == nil {
+		if c.TrustedProxies < 0 {
+			err = fmt.Errorf(
+				"SWIFT TrustedProxies '%d' must not be negative",
+				c.TrustedProxies)
+		}
+	}
+	if err == nil {
+		if c.MaxURLLength < 0 {
+			err = fmt.Errorf(
+				"SWIFT MaxURLLength '%d' must not be negative",
+				c.MaxURLLength)
+		}
+	}
+	if err == nil {
+		if c.WebhookURL != "" {
+			err = validateWebhookURL(c.WebhookURL)
+		}
+	}
+	if err == nil {
+		for _, d := range c.DecodeAccessNodes {
+			if strings.TrimSpace(d) == "" {
+				err = fmt.Errorf(
+					"SWIFT DecodeAccessNodes must not contain empty domains")
+			}
+		}
+	}
+	if err == nil {
+		if c.AllowCredentials && len(c.AllowedOrigins) == 0 {
+			err = fmt.Errorf(
+				"SWIFT AllowCredentials requires AllowedOrigins to be set")
+		}
+	}
+	if err == nil && c.AllowCredentials {
+		for _, o := range c.AllowedOrigins {
+			if o == "*" {
+				err = fmt.Errorf(
+					"SWIFT AllowCredentials must not be used with '*' in " +
+						"AllowedOrigins")
+			}
+		}
+	}
 	return err
 }
+
+// minBounces returns the fewest nodes a storage operation can visit.
+func (c *Configuration) minBounces() int {
+	if c.MinBounces == 0 {
+		return defaultMinBounces
+	}
+	return int(c.MinBounces)
+}
+
+// maxBounces returns the most nodes a storage operation can visit.
+func (c *Configuration) maxBounces() int {
+	if c.MaxBounces == 0 {
+		return defaultMaxBounces
+	}
+	return int(c.MaxBounces)
+}
+
+// maxPairs returns the maximum number of pairs in a storage operation.
+func (c *Configuration) maxPairs() int {
+	if c.MaxPairs <= 0 || c.MaxPairs > defaultMaxPairs {
+		return defaultMaxPairs
+	}
+	return c.MaxPairs
+}
+
+// maxValueBytes returns the maximum total bytes of all the values in a storage
+// operation.
+func (c *Configuration) maxValueBytes() int {
+	if c.MaxValueBytes <= 0 {
+		return defaultMaxValueBytes
+	}
+	return c.MaxValueBytes
+}
+
+// operationTimeout returns the duration that a storage operation must complete
+// within.
+func (c *Configuration) operationTimeout() time.Duration {
+	if c.OperationTimeout <= 0 {
+		return time.Second * defaultOpTimeout
+	}
+	return time.Second * c.OperationTimeout
+}
+
+// getTableAllowed returns true if the access key can be used with the table.
+func (c *Configuration) getTableAllowed(key string, table string) bool {
+	a, ok := c.AccessKeyTables[key]
+	if ok == false {
+		return true
+	}
+	for _, t := range a {
+		if strings.HasSuffix(t, "*") {
+			if strings.HasPrefix(table, t[:len(t)-1]) {
+				return true
+			}
+		} else if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// encoding returns the encoding used for scrambled names and the data in URLs.
+func (c *Configuration) encoding() int {
+	return encodingNames[c.Encoding]
+}
+
+// aead returns the AEAD used by new secrets.
+func (c *Configuration) aead() byte {
+	return aeadNames[c.AEAD]
+}
+
+// cacheControl returns the Cache-Control header for the API handler.
+func (c *Configuration) cacheControl(handler string) string {
+	if v, ok := c.CacheControl[handler]; ok {
+		return v
+	}
+	return defaultCacheControl
+}
+
+// payloadUtilization returns the URL length as a percentage of the maximum URL
+// length and true if the warning threshold has been reached.
+func (c *Configuration) payloadUtilization(length int) (int, bool) {
+	m := c.MaxURLLength
+	if m <= 0 {
+		m = defaultURLLength
+	}
+	p := length * 100 / m
+	if c.PayloadWarning < 0 {
+		return p, false
+	}
+	w := c.PayloadWarning
+	if w == 0 {
+		w = defaultPayloadWarn
+	}
+	return p, p >= w
+}
+
+// webhookTimeout returns the time to wait for a webhook to respond.
+func (c *Configuration) webhookTimeout() time.Duration {
+	if c.WebhookTimeout <= 0 {
+		return time.Second * defaultWebhookTime
+	}
+	return time.Second * c.WebhookTimeout
+}
+
+// webhookRetries returns the number of times a failed webhook is retried.
+func (c *Configuration) webhookRetries() int {
+	if c.WebhookRetries == 0 {
+		return defaultWebhookRetry
+	}
+	if c.WebhookRetries < 0 {
+		return 0
+	}
+	return c.WebhookRetries
+}
+
+// webhookRetryDelay returns the delay before the first retry of a webhook.
+func (c *Configuration) webhookRetryDelay() time.Duration {
+	if c.WebhookRetryDelay <= 0 {
+		return time.Millisecond * defaultWebhookDelay
+	}
+	return time.Millisecond * time.Duration(c.WebhookRetryDelay)
+}
+
+// nodeRetries returns the number of times a failed node request is retried.
+func (c *Configuration) nodeRetries() int {
+	if c.NodeRetries == 0 {
+		return defaultNodeRetry
+	}
+	if c.NodeRetries < 0 {
+		return 0
+	}
+	return c.NodeRetries
+}
+
+// nodeRetryDelay returns the delay before the first retry of a node request.
+func (c *Configuration) nodeRetryDelay() time.Duration {
+	if c.NodeRetryDelay <= 0 {
+		return time.Millisecond * defaultNodeDelay
+	}
+	return time.Millisecond * time.Duration(c.NodeRetryDelay)
+}
+
+// nodeDeadline returns the time a node request and its retries must complete
+// within.
+func (c *Configuration) nodeDeadline() time.Duration {
+	if c.NodeDeadline <= 0 {
+		return time.Second * defaultNodeDeadline
+	}
+	return time.Second * c.NodeDeadline
+}
+
+// The most bytes in a request body unless configured otherwise.
+const defaultMaxRequest = 1 << 20
+
+// maxRequestBytes returns the most bytes that can be read from a request body,
+// or zero if there is no limit.
+func (c *Configuration) maxRequestBytes() int64 {
+	if c.MaxRequestBytes < 0 {
+		return 0
+	}
+	if c.MaxRequestBytes == 0 {
+		return defaultMaxRequest
+	}
+	return c.MaxRequestBytes
+}
+
+// normalize returns the string in Unicode normalization form C if
+// NormalizeUnicode is enabled, otherwise the string unaltered.
+func (c *Configuration) normalize(s string) string {
+	if c.NormalizeUnicode {
+		return norm.NFC.String(s)
+	}
+	return s
+}
+
+// redundancy returns the number of storage nodes each value is written to.
+func (c *Configuration) redundancy() int {
+	if c.Redundancy == 0 {
+		return 1
+	}
+	return int(c.Redundancy)
+}
+
+// tableGracePeriod returns the duration a disabled table can be enabled again
+// within.
+func (c *Configuration) tableGracePeriod() time.Duration {
+	if c.TableGracePeriod <= 0 {
+		return time.Hour * 24 * defaultTableGrace
+	}
+	return time.Hour * 24 * time.Duration(c.TableGracePeriod)
+}
+
+// nodeRetirement returns the duration a retiring node remains active.
+func (c *Configuration) nodeRetirement() time.Duration {
+	if c.NodeRetirement <= 0 {
+		return time.Hour * 24 * defaultRetirement
+	}
+	return time.Hour * 24 * time.Duration(c.NodeRetirement)
+}
+
+// clockSkew returns the clock skew tolerated when checking if results have
+// expired.
+func (c *Configuration) clockSkew() time.Duration {
+	if c.ClockSkew == 0 {
+		return time.Second * defaultClockSkew
+	}
+	if c.ClockSkew < 0 {
+		return 0
+	}
+	return time.Second * c.ClockSkew
+}
+
+// maxNonces returns the number of completed operations to remember.
+func (c *Configuration) maxNonces() int {
+	if c.MaxNonces <= 0 {
+		return defaultMaxNonces
+	}
+	return c.MaxNonces
+}
+
+// getOriginAllowed returns true if browsers can call the API handlers from the
+// origin.
+func (c *Configuration) getOriginAllowed(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// compressionLevel returns the zlib compression level to use when encrypting
+// data.
+func (c *Configuration) compressionLevel() int {
+	if c.CompressionLevel == 0 {
+		return zlib.DefaultCompression
+	}
+	return c.CompressionLevel
+}
@@ -0,0 +1,156 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The prefix of the environment variables read by ConfigFromEnv.
+const envPrefix = "SWIFT_"
+
+// Values used by ConfigFromEnv for the user interface settings that Validate
+// requires when the environment variable is not set.
+var envDefaults = map[string]string{
+	"Message":         "Please wait",
+	"Title":           "SWIFT",
+	"BackgroundColor": "#f5f5f5",
+	"MessageColor":    "darkslategray",
+	"ProgressColor":   "darkslategray",
+	"Scheme":          "https"}
+
+// ConfigFromEnv returns a configuration read from environment variables and
+// validated. Each field of the configuration is read from a variable named
+// SWIFT_ followed by the field name in upper snake case, for example
+// SWIFT_NODE_COUNT for NodeCount and SWIFT_MAX_URL_LENGTH for MaxURLLength.
+// Durations are whole numbers in the units documented for the field, lists
+// are comma separated and maps are JSON objects. Fields without a variable use
+// the same defaults as the settings file, and the user interface text and
+// colors have defaults so that only the settings needed must be set. An error
+// naming the variable is returned if a value is malformed.
+func ConfigFromEnv() (Configuration, error) {
+	var c Configuration
+	v := reflect.ValueOf(&c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		n := envPrefix + envName(f.Name)
+		e, ok := os.LookupEnv(n)
+		if ok == false {
+			e, ok = envDefaults[f.Name]
+		}
+		if ok == false {
+			continue
+		}
+		err := setEnvField(v.Field(i), e)
+		if err != nil {
+			return c, fmt.Errorf(
+				"SWIFT environment variable '%s' value '%s' invalid: %w",
+				n,
+				e,
+				err)
+		}
+	}
+	return c, c.Validate()
+}
+
+// NewServicesFromEnv returns services configured with ConfigFromEnv. The store
+// is selected from the environment as described by NewStore. Only the
+// AccessKeys in the configuration can access the handlers.
+func NewServicesFromEnv() (*Services, error) {
+	c, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	b, err := NewBrowserRegexes()
+	if err != nil {
+		return nil, err
+	}
+	return NewServices(c, NewStore(c), NewAccessSimple(nil), b), nil
+}
+
+// envName returns the field name in upper snake case. A capital letter starts
+// a new word if it follows a lower case letter, or if it ends an acronym and
+// is followed by a lower case letter.
+func envName(f string) string {
+	r := []rune(f)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) &&
+			(unicode.IsLower(r[i-1]) ||
+				(i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(c))
+	}
+	return b.String()
+}
+
+// setEnvField parses the environment variable value into the field.
+func setEnvField(f reflect.Value, e string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(e)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(e)
+		if err != nil {
+			return fmt.Errorf("not a boolean")
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(e, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("not a whole number")
+		}
+		f.SetInt(i)
+	case reflect.Uint8:
+		i, err := strconv.ParseUint(e, 10, 8)
+		if err != nil {
+			return fmt.Errorf("not a whole number between 0 and 255")
+		}
+		f.SetUint(i)
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(e, 64)
+		if err != nil {
+			return fmt.Errorf("not a number")
+		}
+		f.SetFloat(x)
+	case reflect.Slice:
+		var l []string
+		for _, s := range strings.Split(e, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				l = append(l, s)
+			}
+		}
+		f.Set(reflect.ValueOf(l))
+	case reflect.Map:
+		m := reflect.New(f.Type())
+		err := json.Unmarshal([]byte(e), m.Interface())
+		if err != nil {
+			return fmt.Errorf("not a JSON object")
+		}
+		f.Set(m.Elem())
+	default:
+		return fmt.Errorf("type '%s' not supported", f.Type())
+	}
+	return nil
+}
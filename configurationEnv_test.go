@@ -0,0 +1,97 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("SWIFT_TITLE", "Env Title")
+	t.Setenv("SWIFT_NODE_COUNT", "7")
+	t.Setenv("SWIFT_DEBUG", "true")
+	t.Setenv("SWIFT_OPERATION_TIMEOUT", "60")
+	t.Setenv("SWIFT_CREATE_RATE", "2.5")
+	t.Setenv("SWIFT_ACCESS_KEYS", "a, b")
+	t.Setenv("SWIFT_MAX_URL_LENGTH", "4000")
+	t.Setenv("SWIFT_USE_REAL_IP", "1")
+	t.Setenv("SWIFT_CACHE_CONTROL", `{"status":"max-age=60"}`)
+	c, err := ConfigFromEnv()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if c.Title != "Env Title" ||
+		c.NodeCount != 7 ||
+		c.Debug == false ||
+		c.OperationTimeout != 60 ||
+		c.operationTimeout() != time.Minute ||
+		c.CreateRate != 2.5 ||
+		len(c.AccessKeys) != 2 || c.AccessKeys[1] != "b" ||
+		c.MaxURLLength != 4000 ||
+		c.UseRealIP == false ||
+		c.cacheControl("status") != "max-age=60" {
+		fmt.Printf("Unexpected configuration '%+v'\n", c)
+		t.Fail()
+	}
+
+	// Fields without a variable use the defaults.
+	if c.Message == "" || c.Scheme != "https" || c.maxPairs() != 255 {
+		fmt.Printf("Defaults not applied '%+v'\n", c)
+		t.Fail()
+	}
+}
+
+func TestConfigFromEnvMalformed(t *testing.T) {
+	t.Setenv("SWIFT_NODE_COUNT", "five")
+	_, err := ConfigFromEnv()
+	if err == nil {
+		fmt.Println("Non numeric NodeCount should be invalid")
+		t.Fail()
+		return
+	}
+	if strings.Contains(err.Error(), "SWIFT_NODE_COUNT") == false {
+		fmt.Printf("Error '%s' should name the variable\n", err)
+		t.Fail()
+	}
+}
+
+func TestConfigFromEnvInvalid(t *testing.T) {
+	t.Setenv("SWIFT_COMPRESSION_LEVEL", "10")
+	if _, err := ConfigFromEnv(); err == nil {
+		fmt.Println("Compression level above 9 should fail validation")
+		t.Fail()
+	}
+}
+
+func TestConfigFromEnvNames(t *testing.T) {
+	for f, e := range map[string]string{
+		"NodeCount":         "NODE_COUNT",
+		"MaxURLLength":      "MAX_URL_LENGTH",
+		"UseRealIP":         "USE_REAL_IP",
+		"DecodeAccessNodes": "DECODE_ACCESS_NODES",
+		"Debug":             "DEBUG"} {
+		if n := envName(f); n != e {
+			fmt.Printf("Expected '%s' but got '%s'\n", e, n)
+			t.Fail()
+		}
+	}
+}
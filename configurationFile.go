@@ -0,0 +1,100 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// ConfigFile is the JSON document read by ServicesFromConfigFile. The nodes are
+// in the same form as the output of ExportNodes. If a node has no scrambler
+// key or secrets then new ones are created as described by RegisterNodes.
+type ConfigFile struct {
+	Configuration Configuration    `json:"configuration"` // The settings
+	Nodes         []NodeDefinition `json:"nodes"`         // Nodes to add
+}
+
+// ServicesFromConfigFile returns services configured from the JSON document in
+// the file at the path provided. The nodes in the file are added to an in
+// memory store. Only the AccessKeys in the configuration can access the
+// handlers. If the JSON is invalid then the error contains the line and column
+// of the problem, and the field if known. If the configuration or the nodes
+// are invalid then nothing is returned.
+func ServicesFromConfigFile(path string) (*Services, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f ConfigFile
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	err = d.Decode(&f)
+	if err != nil {
+		return nil, getConfigFileError(path, b, d.InputOffset(), err)
+	}
+	err = f.Configuration.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("File '%s' configuration: %w", path, err)
+	}
+	r, err := NewBrowserRegexes()
+	if err != nil {
+		return nil, err
+	}
+	s := NewServices(f.Configuration, newVolatile(), NewAccessSimple(nil), r)
+	err = s.RegisterNodes(f.Nodes)
+	if err != nil {
+		return nil, fmt.Errorf("File '%s' nodes: %w", path, err)
+	}
+	return s, nil
+}
+
+// getConfigFileError returns the error decoding the JSON in the file with the
+// line and column of the problem. The offset is used if the error does not
+// include one.
+func getConfigFileError(path string, b []byte, offset int64, err error) error {
+	var x *json.SyntaxError
+	var t *json.UnmarshalTypeError
+	if errors.As(err, &x) {
+		offset = x.Offset
+	} else if errors.As(err, &t) {
+		l, c := getLineColumn(b, t.Offset)
+		return fmt.Errorf(
+			"File '%s' line %d column %d field '%s': %w",
+			path,
+			l,
+			c,
+			t.Field,
+			err)
+	}
+	l, c := getLineColumn(b, offset)
+	return fmt.Errorf("File '%s' line %d column %d: %w", path, l, c, err)
+}
+
+// getLineColumn returns the line and column numbers starting at one for the
+// byte offset in the data.
+func getLineColumn(b []byte, offset int64) (int, int) {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	p := b[:offset]
+	l := bytes.Count(p, []byte("\n")) + 1
+	return l, len(p) - bytes.LastIndexByte(p, '\n')
+}
@@ -0,0 +1,124 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFileNodes(t *testing.T) {
+	e := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	p := testConfigFile(t, `{
+	"configuration": {
+		"message": "Test Message",
+		"title": "Test Title",
+		"backgroundColor": "white",
+		"messageColor": "black",
+		"progressColor": "blue",
+		"scheme": "https",
+		"nodeCount": 2
+	},
+	"nodes": [
+		{"networks": ["test"], "domain": "a.com", "role": 0,
+			"expires": "`+e+`"},
+		{"networks": ["test"], "domain": "b.com", "role": 1,
+			"expires": "`+e+`", "scramblerKey": "`+testNodeDefinitionKey(t)+`"},
+		{"networks": ["test"], "domain": "c.com", "role": 1,
+			"expires": "`+e+`"}
+	]
+}`)
+	s, err := ServicesFromConfigFile(p)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	ns, err := s.store.getNodes(context.Background(), "test")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(ns.all) != 3 {
+		fmt.Printf("Expected '3' nodes but got '%d'\n", len(ns.all))
+		t.Fail()
+	}
+	for d, r := range map[string]int{
+		"a.com": roleAccess,
+		"b.com": roleStorage,
+		"c.com": roleStorage} {
+		n := ns.dict[d]
+		if n == nil || n.role != r || n.isActive() == false {
+			fmt.Printf("Node '%s' should be active with role '%d'\n", d, r)
+			t.Fail()
+		}
+	}
+	if s.config.Title != "Test Title" {
+		fmt.Println("Configuration should be read from the file")
+		t.Fail()
+	}
+}
+
+func TestConfigFileInvalid(t *testing.T) {
+	for v, e := range map[string][]string{
+
+		// Type error includes the line and field.
+		`{"nodes": [
+	{"domain": "a.com",
+	"role": "access"}]}`: {"line 3 column", "role"},
+
+		// Syntax error includes the line.
+		`{"nodes": [
+	{"domain": "a.com",,}]}`: {"line 2 column"},
+
+		// Unknown field includes the field name.
+		`{
+	"unknown": 1}`: {"\"unknown\""},
+
+		// Node validation errors are reported after the JSON is read.
+		`{
+	"configuration": {"message": "m", "title": "t", "backgroundColor": "w",
+		"messageColor": "b", "progressColor": "b"},
+	"nodes": []}`: {"At least one access node is required"}} {
+		_, err := ServicesFromConfigFile(testConfigFile(t, v))
+		for _, i := range e {
+			if err == nil || strings.Contains(err.Error(), i) == false {
+				fmt.Printf("Expected error containing '%s' but got '%v'\n",
+					i,
+					err)
+				t.Fail()
+			}
+		}
+	}
+}
+
+// testConfigFile writes the JSON to a temporary file returning the path.
+func testConfigFile(t *testing.T, j string) string {
+	p := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(p, []byte(j), 0600)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	return p
+}
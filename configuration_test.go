@@ -16,6 +16,12 @@
 
 package swift
 
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
 func newConfigurationTest() Configuration {
 	var c Configuration
 	c.Message = "Test Message"
@@ -24,6 +30,131 @@ func newConfigurationTest() Configuration {
 	c.MessageColor = "black"
 	c.ProgressColor = "blue"
 	c.Scheme = "https"
+	c.BundleTimeout = 60
+	c.NodeCount = 5
 	c.Debug = true
 	return c
 }
+
+func TestConfigurationBounces(t *testing.T) {
+	c := newConfigurationTest()
+	if c.Validate() != nil || c.minBounces() != 1 || c.maxBounces() != 254 {
+		fmt.Println("Default bounces invalid")
+		t.Fail()
+	}
+	c.MinBounces = 6
+	if c.Validate() == nil {
+		fmt.Println("Node count below minimum bounces should be invalid")
+		t.Fail()
+	}
+	c.MaxBounces = 2
+	c.NodeCount = 2
+	if c.Validate() == nil {
+		fmt.Println("Minimum greater than maximum bounces should be invalid")
+		t.Fail()
+	}
+}
+
+func TestConfigurationAEAD(t *testing.T) {
+	c := newConfigurationTest()
+	if c.Validate() != nil || c.aead() != aeadGCM {
+		fmt.Println("Default AEAD should be AES-GCM")
+		t.Fail()
+	}
+	c.AEAD = "chacha20-poly1305"
+	if c.Validate() != nil || c.aead() != aeadChaCha20Poly1305 {
+		fmt.Println("AEAD should be ChaCha20-Poly1305")
+		t.Fail()
+	}
+	c.AEAD = "des"
+	if c.Validate() == nil {
+		fmt.Println("Unknown AEAD should be invalid")
+		t.Fail()
+	}
+}
+
+func TestConfigurationAllowCredentials(t *testing.T) {
+	c := newConfigurationTest()
+	c.AllowCredentials = true
+	if c.Validate() == nil {
+		fmt.Println("Credentials without allowed origins should be invalid")
+		t.Fail()
+	}
+	c.AllowedOrigins = []string{"https://a.com", "*"}
+	if c.Validate() == nil {
+		fmt.Println("Credentials with any origin should be invalid")
+		t.Fail()
+	}
+	c.AllowedOrigins = []string{"https://a.com"}
+	if c.Validate() != nil {
+		fmt.Println("Credentials with listed origins should be valid")
+		t.Fail()
+	}
+	c.AllowCredentials = false
+	c.AllowedOrigins = []string{"*"}
+	if c.Validate() != nil {
+		fmt.Println("Any origin without credentials should be valid")
+		t.Fail()
+	}
+}
+
+func TestConfigurationClockSkew(t *testing.T) {
+	c := newConfigurationTest()
+	for v, e := range map[time.Duration]time.Duration{
+		0:  time.Second * defaultClockSkew,
+		-1: 0,
+		30: time.Second * 30} {
+		c.ClockSkew = v
+		if c.clockSkew() != e {
+			fmt.Printf("Skew '%d' should be '%s' not '%s'\n", v, e, c.clockSkew())
+			t.Fail()
+		}
+	}
+}
+
+func TestConfigurationPeerKeys(t *testing.T) {
+	c := newConfigurationTest()
+	c.AccessKeys = []string{"public"}
+	c.PeerKeys = []string{"peer"}
+	if c.Validate() != nil {
+		fmt.Println("Distinct peer keys should be valid")
+		t.Fail()
+	}
+	c.PeerKeys = append(c.PeerKeys, "public")
+	if c.Validate() == nil {
+		fmt.Println("Peer key that is also an access key should be invalid")
+		t.Fail()
+	}
+}
+
+func TestConfigurationCacheControl(t *testing.T) {
+	c := newConfigurationTest()
+	if v := c.cacheControl("decode-as-json"); v != defaultCacheControl {
+		fmt.Printf("Expected '%s' but got '%s'\n", defaultCacheControl, v)
+		t.Fail()
+	}
+	c.CacheControl = map[string]string{"decode-as-json": "max-age=60"}
+	if c.Validate() != nil {
+		fmt.Println("Known handler should be valid")
+		t.Fail()
+	}
+	c.CacheControl["decode-as-jsn"] = "max-age=60"
+	if c.Validate() == nil {
+		fmt.Println("Unknown handler should be invalid")
+		t.Fail()
+	}
+}
+
+func TestConfigurationDecodeAccessNodes(t *testing.T) {
+	c := newConfigurationTest()
+	c.DecodeAccessNodes = []string{"old-access.com"}
+	if c.Validate() != nil {
+		fmt.Println("Decode access node domain should be valid")
+		t.Fail()
+	}
+	c.DecodeAccessNodes = append(c.DecodeAccessNodes, " ")
+	if c.Validate() == nil {
+		fmt.Println("Empty decode access node domain should be invalid")
+		t.Fail()
+	}
+}
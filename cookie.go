@@ -0,0 +1,116 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The most characters of an encrypted value stored in a single cookie.
+	// Browsers limit cookies to around 4KB including the name and attributes.
+	cookieChunkSize = 3800
+	// Starts the value of a cookie that records the number of chunk cookies
+	// the value is split across. Is not a character used by base 64 URL
+	// encoding so can not be confused with a value.
+	cookieChunkPrefix = "~"
+	// Separates the cookie name from the index of the chunk.
+	cookieChunkSeparator = "."
+)
+
+// getCookieChunkName returns the name of the cookie for the chunk index.
+func getCookieChunkName(name string, i int) string {
+	return name + cookieChunkSeparator + strconv.Itoa(i)
+}
+
+// splitCookieValue returns the value split into chunks that each fit in a
+// single cookie in order.
+func splitCookieValue(v string) []string {
+	var c []string
+	for len(v) > cookieChunkSize {
+		c = append(c, v[:cookieChunkSize])
+		v = v[cookieChunkSize:]
+	}
+	return append(c, v)
+}
+
+// getCookieValue returns the value of the cookie reassembling the value from
+// the chunk cookies in the request if the value was split across more than
+// one cookie. An error is returned if any of the chunks are missing.
+func getCookieValue(r *http.Request, c *http.Cookie) (string, error) {
+	if strings.HasPrefix(c.Value, cookieChunkPrefix) == false {
+		return c.Value, nil
+	}
+	n, err := strconv.Atoi(c.Value[len(cookieChunkPrefix):])
+	if err != nil || n < 1 {
+		return "", fmt.Errorf("Chunk count for cookie '%s' invalid", c.Name)
+	}
+	if r == nil {
+		return "", fmt.Errorf("Chunks for cookie '%s' not available", c.Name)
+	}
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		p, err := r.Cookie(getCookieChunkName(c.Name, i))
+		if err != nil {
+			return "", fmt.Errorf(
+				"Chunk '%d' of '%d' for cookie '%s' missing",
+				i,
+				n,
+				c.Name)
+		}
+		b.WriteString(p.Value)
+	}
+	return b.String(), nil
+}
+
+// setCookieChunks sets the cookie in the response. If the value is too large
+// for a single cookie then it is split across numbered chunk cookies and the
+// cookie records the number of chunks. Chunk cookies in the request that are
+// no longer needed are removed.
+func setCookieChunks(w http.ResponseWriter, r *http.Request, c *http.Cookie) {
+	l := 0
+	if len(c.Value) > cookieChunkSize {
+		v := splitCookieValue(c.Value)
+		for i, p := range v {
+			k := *c
+			k.Name = getCookieChunkName(c.Name, i)
+			k.Value = p
+			http.SetCookie(w, &k)
+		}
+		l = len(v)
+		c.Value = cookieChunkPrefix + strconv.Itoa(l)
+	}
+	http.SetCookie(w, c)
+	if r == nil {
+		return
+	}
+	for i := l; ; i++ {
+		_, err := r.Cookie(getCookieChunkName(c.Name, i))
+		if err != nil {
+			break
+		}
+		k := *c
+		k.Name = getCookieChunkName(c.Name, i)
+		k.Value = ""
+		k.MaxAge = -1
+		http.SetCookie(w, &k)
+	}
+}
@@ -0,0 +1,232 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCookieChunksLargeValue(t *testing.T) {
+	o, p, err := newCookieChunksTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c := testCookies(t, o)
+	if len(c) < 3 {
+		fmt.Printf("Expected the value to be split but got '%d' cookies\n",
+			len(c))
+		t.Fail()
+		return
+	}
+	for _, i := range c {
+		if len(i.Value) > cookieChunkSize {
+			fmt.Printf("Cookie '%s' length '%d' too long\n",
+				i.Name,
+				len(i.Value))
+			t.Fail()
+		}
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, i := range c {
+		r.AddCookie(i)
+	}
+	b, err := r.Cookie(o.scramble(o.thisNode, p.key))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	v, err := o.thisNode.getValueFromCookie(r, b, "")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if v.value != p.value {
+		fmt.Println("Value read from the chunks does not match")
+		t.Fail()
+	}
+}
+
+func TestCookieChunksMissing(t *testing.T) {
+	o, p, err := newCookieChunksTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n := getCookieChunkName(o.scramble(o.thisNode, p.key), 1)
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, i := range testCookies(t, o) {
+		if i.Name != n {
+			r.AddCookie(i)
+		}
+	}
+	b, err := r.Cookie(o.scramble(o.thisNode, p.key))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, err = o.thisNode.getValueFromCookie(r, b, "")
+	if err == nil {
+		fmt.Println("Missing chunk should be an error")
+		t.Fail()
+	}
+}
+
+func TestCookieChunksRemoved(t *testing.T) {
+	o, p, err := newCookieChunksTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, i := range testCookies(t, o) {
+		r.AddCookie(i)
+	}
+
+	// Writing a small value removes the chunks that are no longer needed.
+	p.value = "small"
+	w := httptest.NewRecorder()
+	err = o.setValueInCookie(w, r, p)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, i := range w.Result().Cookies() {
+		if i.Name != o.scramble(o.thisNode, p.key) && i.MaxAge >= 0 {
+			fmt.Printf("Chunk cookie '%s' should be removed\n", i.Name)
+			t.Fail()
+		}
+	}
+}
+
+func TestCookieLegacyPath(t *testing.T) {
+	s, n, err := NewTestNetwork(1, 3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	d := n.StorageNodes[0]
+	h, err := s.store.getNode(context.Background(), d)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Add a cookie to the browser with the name and path used before scrambled
+	// values included a version byte.
+	var b bytes.Buffer
+	err = writeTime(&b, time.Now().UTC().Add(-time.Hour))
+	if err == nil {
+		err = testPair("a", "1", conflictOldest, -time.Hour).writeToBuffer(&b)
+	}
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	v, err := h.encryptForTable(
+		b.Bytes(),
+		s.config.compressionLevel(),
+		s.getSecretTable("table"))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n.Client.Jar.SetCookies(
+		&url.URL{Scheme: "http", Host: d, Path: "/"},
+		[]*http.Cookie{{
+			Name:  h.scrambleLegacy("a"),
+			Value: base64.RawURLEncoding.EncodeToString(v),
+			Path:  "/" + h.scrambleLegacy("table")}})
+
+	// An operation at the node finds the older value in the legacy cookie.
+	q := url.Values{}
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	q.Set(homeNodeParam, d)
+	q.Set(bounces, "2")
+	q.Set("a<"+time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02"), "2")
+	u, err := n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err := n.Follow(u)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := n.Decode(e)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != 1 || a[0].Value != "1" {
+		fmt.Printf("Expected the legacy cookie value but got '%v'\n", a)
+		t.Fail()
+	}
+}
+
+// newCookieChunksTest returns an operation with a single pair whose value is
+// too large for a single cookie.
+func newCookieChunksTest() (*operation, *pair, error) {
+	s, err := newCreateTest()
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := s.store.getNode(context.Background(), "storage-1.com")
+	if err != nil {
+		return nil, nil, err
+	}
+	b := make([]byte, cookieChunkSize*2)
+	_, err = rand.Read(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	o := newOperation(s, n)
+	o.table = "table"
+	p := testPair(
+		"audience",
+		base64.RawURLEncoding.EncodeToString(b),
+		conflictNewest,
+		-time.Hour)
+	o.values = []*pair{p}
+	return o, p, nil
+}
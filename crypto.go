@@ -21,20 +21,57 @@ import (
 	"compress/zlib"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Flags that precede the data to indicate if it is compressed. Data encrypted
+// before the flag was added is always zlib compressed and starts with the zlib
+// header which can never be a flag byte.
+const (
+	compressionFlagRaw  = iota // The data is not compressed
+	compressionFlagZlib = iota // The data is compressed with zlib
 )
 
-// crypto structure containing AES ciphers.
+// The AEAD used to encrypt data. AES-GCM is the default and its ciphertext has
+// no version byte so that it is compatible with data encrypted before the AEAD
+// could be selected. ChaCha20-Poly1305 ciphertext starts with a version byte.
+// ChaCha20-Poly1305 is faster on platforms without AES hardware acceleration.
+const (
+	aeadGCM              = 0    // AES-GCM without a version byte
+	aeadChaCha20Poly1305 = 0x02 // ChaCha20-Poly1305 with a version byte
+)
+
+// The names of the AEADs that can be selected in the configuration.
+var aeadNames = map[string]byte{
+	"":                  aeadGCM,
+	"aes-gcm":           aeadGCM,
+	"chacha20-poly1305": aeadChaCha20Poly1305}
+
+// crypto structure containing the AEAD ciphers.
 type crypto struct {
-	gcm cipher.AEAD
+	gcm    cipher.AEAD // AES-GCM cipher
+	chacha cipher.AEAD // ChaCha20-Poly1305 cipher, or nil if the key is not 32
+	aead   byte        // The AEAD used to encrypt data
 }
 
 // NewCrypto creates a new instance of the security structure used to encrypt
-// and decrypt data using rotating shared secret keys.
+// and decrypt data using rotating shared secret keys. AES-GCM is used to
+// encrypt data.
 func newCrypto(key []byte) (*crypto, error) {
+	return newCryptoWithAEAD(key, aeadGCM)
+}
+
+// newCryptoWithAEAD creates a new instance of the security structure that
+// encrypts data with the AEAD provided. Data encrypted with either AEAD can be
+// decrypted. ChaCha20-Poly1305 requires a 32 byte key.
+func newCryptoWithAEAD(key []byte, aead byte) (*crypto, error) {
 	var x crypto
 	i, err := aes.NewCipher(key)
 	if err != nil {
@@ -44,11 +81,46 @@ func newCrypto(key []byte) (*crypto, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(key) == chacha20poly1305.KeySize {
+		x.chacha, err = chacha20poly1305.New(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch aead {
+	case aeadGCM:
+	case aeadChaCha20Poly1305:
+		if x.chacha == nil {
+			return nil, fmt.Errorf(
+				"ChaCha20-Poly1305 key length '%d' must be '%d'",
+				len(key),
+				chacha20poly1305.KeySize)
+		}
+	default:
+		return nil, fmt.Errorf("AEAD '%d' invalid", aead)
+	}
+	x.aead = aead
 	return &x, nil
 }
 
+// decrypt returns the data decrypted with the AEAD identified by the version
+// byte. Data without a version byte is AES-GCM. AES-GCM data can start with
+// the ChaCha20-Poly1305 version byte by chance so if ChaCha20-Poly1305 can not
+// open the data then AES-GCM is tried.
 func (x *crypto) decrypt(b []byte) ([]byte, error) {
-	nonceSize := x.gcm.NonceSize()
+	if len(b) > 0 && b[0] == aeadChaCha20Poly1305 && x.chacha != nil {
+		d, err := open(x.chacha, b[1:])
+		if err == nil {
+			return d, nil
+		}
+	}
+	return open(x.gcm, b)
+}
+
+// open returns the data decrypted with the AEAD. The data starts with the
+// nonce.
+func open(a cipher.AEAD, b []byte) ([]byte, error) {
+	nonceSize := a.NonceSize()
 	if len(b) < nonceSize {
 		return nil, fmt.Errorf(
 			"Data length '%d' shorter than nonce '%d'",
@@ -56,7 +128,7 @@ func (x *crypto) decrypt(b []byte) ([]byte, error) {
 			nonceSize)
 	}
 	nonce, c := b[:nonceSize], b[nonceSize:]
-	d, err := x.gcm.Open(nil, nonce, c, nil)
+	d, err := a.Open(nil, nonce, c, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +140,17 @@ func (x *crypto) decryptAndDecompress(b []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return decompress(d)
+	if len(d) == 0 {
+		return nil, fmt.Errorf("Decrypted data empty")
+	}
+	switch d[0] {
+	case compressionFlagRaw:
+		return d[1:], nil
+	case compressionFlagZlib:
+		return decompress(d[1:])
+	default:
+		return decompress(d)
+	}
 }
 
 func (x *crypto) encryptWithNonce(b []byte, n []byte) []byte {
@@ -77,16 +159,30 @@ func (x *crypto) encryptWithNonce(b []byte, n []byte) []byte {
 	// additional data and appends the result to dst, returning the updated
 	// slice. The nonce must be NonceSize() bytes long and unique for all
 	// time, for a given key.
+	if x.aead == aeadChaCha20Poly1305 {
+		return x.chacha.Seal(append([]byte{x.aead}, n...), n, b, nil)
+	}
 	return x.gcm.Seal(n, n, b, nil)
 }
 
-func (x *crypto) compressAndEncrypt(b []byte) ([]byte, error) {
+// compressAndEncrypt compresses the data at the zlib compression level
+// provided and then encrypts it with a random nonce. If compression does not
+// reduce the size of the data then the data is encrypted uncompressed. A flag
+// byte before the data records which was used. The level does not need to be
+// known to decrypt and decompress the data.
+func (x *crypto) compressAndEncrypt(b []byte, level int) ([]byte, error) {
 
-	// Compress the data before encrypting it.
-	c, err := compress(b)
+	// Compress the data before encrypting it unless it would get larger.
+	z, err := compress(b, level)
 	if err != nil {
 		return nil, err
 	}
+	var c []byte
+	if len(z) < len(b) {
+		c = append([]byte{compressionFlagZlib}, z...)
+	} else {
+		c = append([]byte{compressionFlagRaw}, b...)
+	}
 
 	// Create nonce with a cryptographically secure random sequence. Nonce
 	// should never be repeated.
@@ -103,9 +199,12 @@ func randomBytes(l int) ([]byte, error) {
 	return r, err
 }
 
-func compress(b []byte) ([]byte, error) {
+func compress(b []byte, level int) ([]byte, error) {
 	var o bytes.Buffer
-	z := zlib.NewWriter(&o)
+	z, err := zlib.NewWriterLevel(&o, level)
+	if err != nil {
+		return nil, err
+	}
 	i, err := z.Write(b)
 	if err != nil {
 		return nil, err
@@ -128,3 +227,15 @@ func decompress(b []byte) ([]byte, error) {
 	}
 	return ioutil.ReadAll(z)
 }
+
+// deriveKey returns a 32 byte key derived from the input key material, salt and
+// info using HKDF with SHA-256 as defined in RFC 5869. A single block of the
+// expand step provides the 32 bytes needed for AES-256.
+func deriveKey(ikm []byte, salt []byte, info []byte) []byte {
+	e := hmac.New(sha256.New, salt)
+	e.Write(ikm)
+	x := hmac.New(sha256.New, e.Sum(nil))
+	x.Write(info)
+	x.Write([]byte{1})
+	return x.Sum(nil)
+}
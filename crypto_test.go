@@ -18,7 +18,10 @@ package swift
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -37,7 +40,7 @@ func TestCryptoCorrupt(t *testing.T) {
 	if err != nil {
 		t.Fail()
 	}
-	c, err := x.compressAndEncrypt([]byte("corrupt"))
+	c, err := x.compressAndEncrypt([]byte("corrupt"), zlib.DefaultCompression)
 	if err != nil {
 		t.Fail()
 	}
@@ -49,6 +52,105 @@ func TestCryptoCorrupt(t *testing.T) {
 	fmt.Println(err)
 }
 
+func TestCryptoIncompressible(t *testing.T) {
+	i, err := randomBytes(1024)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testCryptoCompression(t, i, compressionFlagRaw)
+}
+
+func TestCryptoCompressible(t *testing.T) {
+	testCryptoCompression(
+		t,
+		[]byte(strings.Repeat("Share Web State", 100)),
+		compressionFlagZlib)
+}
+
+func TestCryptoLegacy(t *testing.T) {
+	x, err := newCrypto(testSecret)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Data encrypted before the flag byte was added is compressed without a
+	// flag.
+	i := []byte("Share Web State")
+	z, err := compress(i, zlib.DefaultCompression)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n, err := randomBytes(x.gcm.NonceSize())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	o, err := x.decryptAndDecompress(x.encryptWithNonce(z, n))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if bytes.Equal(i, o) == false {
+		fmt.Println("Legacy data should decrypt")
+		t.Fail()
+	}
+}
+
+// testCryptoCompression checks the data round trips and is stored with the
+// compression flag expected.
+func testCryptoCompression(t *testing.T, i []byte, flag byte) {
+	x, err := newCrypto(testSecret)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c, err := x.compressAndEncrypt(i, zlib.DefaultCompression)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d, err := x.decrypt(c)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if d[0] != flag {
+		fmt.Printf("Flag '%d' should be '%d'\n", d[0], flag)
+		t.Fail()
+	}
+	if flag == compressionFlagRaw && len(d) != len(i)+1 {
+		fmt.Printf("Raw length '%d' should be '%d'\n", len(d), len(i)+1)
+		t.Fail()
+	}
+	if flag == compressionFlagZlib && len(d) >= len(i) {
+		fmt.Printf("Compressed length '%d' should be less than '%d'\n",
+			len(d),
+			len(i))
+		t.Fail()
+	}
+	o, err := x.decryptAndDecompress(c)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if bytes.Equal(i, o) == false {
+		fmt.Println("Data should round trip")
+		t.Fail()
+	}
+}
+
 func testCryptoString(t *testing.T, s string) {
 	i := []byte(s)
 	o, err := testCryptoByteArray(i)
@@ -69,9 +171,182 @@ func testCryptoByteArray(i []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	c, err := x.compressAndEncrypt(i)
+	c, err := x.compressAndEncrypt(i, zlib.DefaultCompression)
 	if err != nil {
 		return nil, err
 	}
 	return x.decryptAndDecompress(c)
 }
+
+func TestCryptoCompressionLevels(t *testing.T) {
+	i := []byte(strings.Repeat("Share Web State ", 100))
+	x, err := newCrypto(testSecret)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, l := range []int{1, 6, 9} {
+		c, err := x.compressAndEncrypt(i, l)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		o, err := x.decryptAndDecompress(c)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if bytes.Compare(i, o) != 0 {
+			fmt.Printf("Level '%d' did not round trip\n", l)
+			t.Fail()
+		}
+	}
+}
+
+func TestCryptoCompressionLevelInvalid(t *testing.T) {
+	x, err := newCrypto(testSecret)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, err = x.compressAndEncrypt([]byte("invalid"), 10)
+	if err == nil {
+		fmt.Println("Level 10 should not be valid")
+		t.Fail()
+	}
+}
+
+func TestCryptoDeriveKey(t *testing.T) {
+	// RFC 5869 test case 1 truncated to the first 32 bytes.
+	ikm := bytes.Repeat([]byte{0x0b}, 22)
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	e := "3cb25f25faacd57a90434f64d0362f2a" +
+		"2d2d0a90cf1a5a4c5db02d56ecc4c5bf"
+	if v := hex.EncodeToString(deriveKey(ikm, salt, info)); v != e {
+		fmt.Printf("Expected '%s' but got '%s'\n", e, v)
+		t.Fail()
+	}
+}
+
+func TestCryptoAEADRoundTrip(t *testing.T) {
+	i := []byte("Share Web State")
+	for _, a := range []byte{aeadGCM, aeadChaCha20Poly1305} {
+		x, err := newCryptoWithAEAD(testSecret, a)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		c, err := x.compressAndEncrypt(i, zlib.DefaultCompression)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if a == aeadChaCha20Poly1305 && c[0] != aeadChaCha20Poly1305 {
+			fmt.Printf("Version '%d' should be '%d'\n", c[0], a)
+			t.Fail()
+		}
+
+		// Crypto with the same key decrypts the data whatever the AEAD it
+		// uses to encrypt.
+		for _, b := range []byte{aeadGCM, aeadChaCha20Poly1305} {
+			y, err := newCryptoWithAEAD(testSecret, b)
+			if err != nil {
+				fmt.Println(err)
+				t.Fail()
+				return
+			}
+			o, err := y.decryptAndDecompress(c)
+			if err != nil {
+				fmt.Println(err)
+				t.Fail()
+				return
+			}
+			if bytes.Equal(i, o) == false {
+				fmt.Printf("AEAD '%d' data should round trip\n", a)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestCryptoAEADCross(t *testing.T) {
+	i := []byte("Share Web State")
+	g, err := newCryptoWithAEAD(testSecret, aeadGCM)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c, err := newCryptoWithAEAD(testSecret, aeadChaCha20Poly1305)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// ChaCha20-Poly1305 data without the version byte is opened with AES-GCM.
+	e, err := c.compressAndEncrypt(i, zlib.DefaultCompression)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if _, err = g.decrypt(e[1:]); err == nil {
+		fmt.Println("ChaCha20-Poly1305 data should not open with AES-GCM")
+		t.Fail()
+	}
+
+	// AES-GCM data with the version byte is opened with ChaCha20-Poly1305.
+	e, err = g.compressAndEncrypt(i, zlib.DefaultCompression)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e = append([]byte{aeadChaCha20Poly1305}, e...)
+	if _, err = c.decrypt(e); err == nil {
+		fmt.Println("AES-GCM data should not open with ChaCha20-Poly1305")
+		t.Fail()
+	}
+}
+
+func TestCryptoAEADInvalid(t *testing.T) {
+	if _, err := newCryptoWithAEAD(
+		testSecret[:16],
+		aeadChaCha20Poly1305); err == nil {
+		fmt.Println("ChaCha20-Poly1305 should require a 32 byte key")
+		t.Fail()
+	}
+	if _, err := newCryptoWithAEAD(testSecret, 0xff); err == nil {
+		fmt.Println("Unknown AEAD should be invalid")
+		t.Fail()
+	}
+}
+
+func BenchmarkCryptoLevel1(b *testing.B) { benchmarkCryptoLevel(b, 1) }
+
+func BenchmarkCryptoLevel6(b *testing.B) { benchmarkCryptoLevel(b, 6) }
+
+func BenchmarkCryptoLevel9(b *testing.B) { benchmarkCryptoLevel(b, 9) }
+
+func benchmarkCryptoLevel(b *testing.B, l int) {
+	x, err := newCrypto(testSecret)
+	if err != nil {
+		b.Fatal(err)
+	}
+	i := []byte(strings.Repeat("Share Web State ", 20))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, err = x.compressAndEncrypt(i, l)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// The encodings that can be used for scrambled names and the data in URLs.
+const (
+	encodingBase64URL = iota // Base 64 URL encoding without a prefix
+	encodingBase32    = iota // Base 32 upper case without padding
+	encodingBase58    = iota // Base 58 with the Bitcoin alphabet
+)
+
+// Names of the encodings used in the configuration.
+var encodingNames = map[string]int{
+	"":          encodingBase64URL,
+	"base64url": encodingBase64URL,
+	"base32":    encodingBase32,
+	"base58":    encodingBase58}
+
+// Prefixes for the encodings other than base 64 so that the decoder knows
+// which was used. The characters are not used by the base 64 URL alphabet so
+// values without a prefix are always base 64.
+const (
+	prefixBase32 = '.'
+	prefixBase58 = '~'
+)
+
+// The alphabet used for base 58 excluding characters that look alike.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZ" +
+	"abcdefghijkmnopqrstuvwxyz"
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// encodeValue returns the bytes as a string using the encoding e. Encodings
+// other than base 64 start with the prefix for the encoding.
+func encodeValue(e int, b []byte) string {
+	switch e {
+	case encodingBase32:
+		return string(prefixBase32) + base32NoPadding.EncodeToString(b)
+	case encodingBase58:
+		return string(prefixBase58) + encodeBase58(b)
+	default:
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+}
+
+// decodeValue returns the bytes from a string returned from encodeValue using
+// the prefix to determine the encoding.
+func decodeValue(s string) ([]byte, error) {
+	if len(s) > 0 {
+		switch s[0] {
+		case prefixBase32:
+			return base32NoPadding.DecodeString(s[1:])
+		case prefixBase58:
+			return decodeBase58(s[1:])
+		}
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// encodeBase58 returns the bytes in base 58. Leading zero bytes are each
+// represented by the first character of the alphabet.
+func encodeBase58(b []byte) string {
+	z := 0
+	for z < len(b) && b[z] == 0 {
+		z++
+	}
+	var o []byte
+	x := new(big.Int).SetBytes(b)
+	r := new(big.Int)
+	m := big.NewInt(58)
+	for x.Sign() > 0 {
+		x.DivMod(x, m, r)
+		o = append(o, base58Alphabet[r.Int64()])
+	}
+	for i := 0; i < z; i++ {
+		o = append(o, base58Alphabet[0])
+	}
+	for i, j := 0, len(o)-1; i < j; i, j = i+1, j-1 {
+		o[i], o[j] = o[j], o[i]
+	}
+	return string(o)
+}
+
+// decodeBase58 returns the bytes from a base 58 string.
+func decodeBase58(s string) ([]byte, error) {
+	z := 0
+	for z < len(s) && s[z] == base58Alphabet[0] {
+		z++
+	}
+	x := new(big.Int)
+	m := big.NewInt(58)
+	for i := z; i < len(s); i++ {
+		v := -1
+		for j := 0; j < len(base58Alphabet); j++ {
+			if base58Alphabet[j] == s[i] {
+				v = j
+				break
+			}
+		}
+		if v < 0 {
+			return nil, fmt.Errorf(
+				"illegal base58 data at input byte %d",
+				i)
+		}
+		x.Mul(x, m)
+		x.Add(x, big.NewInt(int64(v)))
+	}
+	return append(make([]byte, z), x.Bytes()...), nil
+}
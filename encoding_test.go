@@ -0,0 +1,176 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, e := range encodingNames {
+		for _, b := range [][]byte{
+			{},
+			{0},
+			{0, 0, 1, 2, 255},
+			[]byte("the quick brown fox")} {
+			v, err := decodeValue(encodeValue(e, b))
+			if err != nil || bytes.Equal(v, b) == false {
+				fmt.Printf("Encoding '%d' of '%v' returned '%v' (%v)\n",
+					e,
+					b,
+					v,
+					err)
+				t.Fail()
+			}
+		}
+		u, err := n.unscramble(n.scramble(e, "table"))
+		if err != nil || u != "table" {
+			fmt.Printf("Encoding '%d' unscrambled '%s' (%v)\n", e, u, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestEncodingAlphabet(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, e := range []int{encodingBase32, encodingBase58} {
+		for i := 0; i < 100; i++ {
+			s := n.scramble(e, fmt.Sprintf("table-%d", i))
+			if strings.ContainsAny(s, "-_") {
+				fmt.Printf("Encoding '%d' value '%s' contains - or _\n", e, s)
+				t.Fail()
+				return
+			}
+		}
+	}
+}
+
+func TestEncodingCrossDecode(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b := n.scramble(encodingBase64URL, "table")
+	x := n.scramble(encodingBase32, "table")
+	y := n.scramble(encodingBase58, "table")
+
+	// Values given the prefix of a different encoding do not unscramble.
+	for _, s := range []string{
+		string(prefixBase32) + b,
+		string(prefixBase58) + b,
+		string(prefixBase58) + x[1:],
+		string(prefixBase32) + y[1:],
+		x[1:],
+		y[1:]} {
+		u, err := n.unscramble(s)
+		if err == nil {
+			fmt.Printf("Value '%s' should not unscramble but got '%s'\n", s, u)
+			t.Fail()
+		}
+	}
+}
+
+func TestEncodingOperation(t *testing.T) {
+	for _, c := range []string{"base32", "base58"} {
+		s, err := newCreateTest()
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		s.config.Encoding = c
+		q := newCreateValuesTest()
+		q.Set(testKey("a"), "1")
+		r := newCreateRequestTest(q)
+		r.ParseForm()
+		_, u, err := createURL(s, r)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		p, err := url.Parse(u)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if strings.ContainsAny(p.Path, "-_") {
+			fmt.Printf("Encoding '%s' URL '%s' contains - or _\n", c, u)
+			t.Fail()
+		}
+		o, err := testOperationFromURL(s, u)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if o.table != "table" {
+			fmt.Printf("Expected table 'table' but got '%s'\n", o.table)
+			t.Fail()
+		}
+	}
+}
+
+func TestEncodingDecodeData(t *testing.T) {
+	for _, e := range []int{encodingBase32, encodingBase58} {
+		s, n, err := newDecodeTest()
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		d, err := testEncryptResults(n, newResultsTest(1))
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		b, err := decodeValue(d)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		w := testDecode(s, newDecodeRequestTest(encodeValue(e, b)))
+		if w.Code != http.StatusOK {
+			fmt.Printf("Encoding '%d' expected '%d' but got '%d'\n",
+				e,
+				http.StatusOK,
+				w.Code)
+			t.Fail()
+		}
+	}
+}
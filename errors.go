@@ -0,0 +1,73 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Errors that callers can identify with errors.Is. The errors returned are
+// often wrapped to include details such as the host or domain.
+var (
+	// ErrNotAuthorized is returned when the access key is not valid.
+	ErrNotAuthorized = errors.New("Not authorized")
+	// ErrNotSwiftNode is returned when a host or domain is not a node.
+	ErrNotSwiftNode = errors.New("Not a Swift node")
+	// ErrNotAccessNode is returned when a node does not have the access role.
+	ErrNotAccessNode = errors.New("Not an access node")
+	// ErrMissingTable is returned when a storage operation has no table.
+	ErrMissingTable = errors.New("Missing table name")
+	// ErrDecryptFailed is returned when none of a node's secrets can decrypt
+	// the data.
+	ErrDecryptFailed = errors.New("Decryption failed with all secrets")
+	// ErrURLTooLong is returned when the URL to start a storage operation is
+	// longer than the configured maximum.
+	ErrURLTooLong = errors.New("URL too long")
+	// ErrStateInvalid is returned when a signed state envelope is malformed or
+	// the signature does not match any of the node's secrets.
+	ErrStateInvalid = errors.New("Signed state invalid")
+	// ErrStateExpired is returned when a signed state envelope has expired.
+	ErrStateExpired = errors.New("Signed state expired")
+	// ErrTableDisabled is returned when a storage operation writes to a table
+	// that has been disabled.
+	ErrTableDisabled = errors.New("Table disabled")
+	// ErrResultsVersion is returned when encoded results are not in the
+	// current format, for example if they were encoded by an older version.
+	ErrResultsVersion = errors.New("Results version not supported")
+)
+
+// getErrorStatus returns the HTTP status code for the error if it is one of
+// the errors that can be identified, otherwise the code provided.
+func getErrorStatus(err error, code int) int {
+	switch {
+	case errors.Is(err, ErrNotAuthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrNotSwiftNode),
+		errors.Is(err, ErrNotAccessNode),
+		errors.Is(err, ErrMissingTable),
+		errors.Is(err, ErrResultsVersion):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTableDisabled):
+		return http.StatusForbidden
+	}
+	var m *http.MaxBytesError
+	if errors.As(err, &m) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return code
+}
@@ -0,0 +1,164 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestErrorsNotSwiftNode(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newCreateRequestTest(newCreateValuesTest())
+	r.Host = "unknown.com"
+	_, err = createOperation(s, r)
+	testErrorsIs(t, err, ErrNotSwiftNode)
+	_, err = getAccessNode(s, r)
+	testErrorsIs(t, err, ErrNotSwiftNode)
+	_, err = testOperationFromURL(s, "https://unknown.com/path")
+	testErrorsIs(t, err, ErrNotSwiftNode)
+}
+
+func TestErrorsNotAccessNode(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newCreateRequestTest(newCreateValuesTest())
+	r.Host = "storage-1.com"
+	_, err = createOperation(s, r)
+	testErrorsIs(t, err, ErrNotAccessNode)
+	_, err = getAccessNode(s, r)
+	testErrorsIs(t, err, ErrNotAccessNode)
+}
+
+func TestErrorsMissingTable(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Del(tableParam)
+	_, err = createOperation(s, newCreateRequestTest(q))
+	testErrorsIs(t, err, ErrMissingTable)
+}
+
+func TestErrorsNotAuthorized(t *testing.T) {
+	s, n, err := NewTestNetwork(1, 1)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	q := url.Values{}
+	q.Set(accessKey, "wrong")
+	q.Set(tableParam, "table")
+	for _, p := range []string{
+		"/swift/api/v1/create",
+		"/swift/api/v1/delete",
+		"/swift/api/v1/decode-as-json",
+		"/swift/api/v1/tables"} {
+		u := "http://" + n.AccessNodes[0] + p
+		r, err := n.Client.PostForm(u, q)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+
+		// The response is written once with the error.
+		if r.StatusCode != http.StatusUnauthorized ||
+			string(b) != ErrNotAuthorized.Error()+"\n" {
+			fmt.Printf("'%s' returned '%d' and '%s'\n", p, r.StatusCode, b)
+			t.Fail()
+		}
+	}
+	r := httptest.NewRequest("POST", "http://"+n.AccessNodes[0]+"/", nil)
+	r.Form = q
+	testErrorsIs(t, s.getAccessError(r), ErrNotAuthorized)
+}
+
+func TestErrorsStatus(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Wrapped errors are identified.
+	if getErrorStatus(
+		fmt.Errorf("Key 'wrong': %w", ErrNotAuthorized),
+		http.StatusInternalServerError) != http.StatusUnauthorized {
+		fmt.Println("Not authorized should be unauthorized")
+		t.Fail()
+	}
+
+	// A request to a storage node is a bad request.
+	r := newCreateRequestTest(newCreateValuesTest())
+	r.Host = "storage-1.com"
+	w := httptest.NewRecorder()
+	HandlerCreate(s)(w, r)
+	testErrorsStatus(t, w, http.StatusBadRequest)
+
+	// Errors that are not identified retain the status provided.
+	if getErrorStatus(
+		errors.New("Other"),
+		http.StatusInternalServerError) != http.StatusInternalServerError {
+		fmt.Println("Unidentified error should retain status")
+		t.Fail()
+	}
+}
+
+func testErrorsIs(t *testing.T, err error, target error) {
+	if errors.Is(err, target) == false {
+		fmt.Printf("Expected '%v' but got '%v'\n", target, err)
+		t.Fail()
+	}
+}
+
+func testErrorsStatus(
+	t *testing.T,
+	w *httptest.ResponseRecorder,
+	code int) {
+	if w.Code != code {
+		fmt.Printf("Expected '%d' but got '%d'\n", code, w.Code)
+		t.Fail()
+	}
+}
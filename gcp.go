@@ -18,7 +18,8 @@ package swift
 
 import (
 	"context"
-	"log"
+	"encoding/base64"
+	"sort"
 	"sync"
 	"time"
 
@@ -42,91 +43,101 @@ func NewFirebase(project string) (*Firebase, error) {
 	conf := &firebase.Config{ProjectID: project}
 	app, err := firebase.NewApp(ctx, conf)
 
+	if err != nil {
+		return nil, err
+	}
 	client, err := app.Firestore(ctx)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 
 	f.client = client
 
 	f.mutex = &sync.Mutex{}
-	err = f.refresh()
+	err = f.refresh(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return &f, nil
 }
 
-func (a *Firebase) getNode(domain string) (*node, error) {
-	n, err := a.common.getNode(domain)
+func (a *Firebase) getNode(ctx context.Context, domain string) (*node, error) {
+	n, err := a.common.getNode(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
 	if n == nil {
-		err = a.refresh()
+		err = a.refresh(ctx)
 		if err != nil {
 			return nil, err
 		}
-		n, err = a.common.getNode(domain)
+		n, err = a.common.getNode(ctx, domain)
 	}
 	return n, err
 }
 
-func (a *Firebase) getNodes(network string) (*nodes, error) {
-	ns, err := a.common.getNodes(network)
+func (a *Firebase) getNodes(
+	ctx context.Context,
+	network string) (*nodes, error) {
+	ns, err := a.common.getNodes(ctx, network)
 	if err != nil {
 		return nil, err
 	}
 	if ns == nil {
-		err = a.refresh()
+		err = a.refresh(ctx)
 		if err != nil {
 			return nil, err
 		}
-		ns, err = a.common.getNodes(network)
+		ns, err = a.common.getNodes(ctx, network)
 	}
 	return ns, err
 }
 
-func (f *Firebase) setNode(node *node) error {
-	err := f.setNodeSecrets(node)
+// getAllNodes refreshes the nodes from storage and returns all of them.
+func (a *Firebase) getAllNodes(ctx context.Context) ([]*node, error) {
+	err := a.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.common.getAllNodes(ctx)
+}
+
+func (f *Firebase) setNode(ctx context.Context, node *node) error {
+	err := f.setNodeSecrets(ctx, node)
 	if err != nil {
 		return err
 	}
-	ctx := context.Background()
+	w := node.weight
 	item := NodeItem{
-		node.network,
+		node.getNetwork(),
 		node.domain,
 		node.created,
 		node.expires.Unix(),
 		node.role,
-		node.scrambler.key}
+		node.scrambler.key,
+		&w,
+		node.retiring}
 	_, err2 := f.client.Collection(nodesTableName).Doc(node.domain).Set(ctx, item)
 	return err2
 }
 
-func (a *Firebase) refresh() error {
+func (a *Firebase) refresh(ctx context.Context) error {
 	nets := make(map[string]*nodes)
 
 	// Fetch the nodes and then add the secrets.
-	ns, err := a.fetchNodes()
+	ns, err := a.fetchNodes(ctx)
 	if err != nil {
 		return err
 	}
-	err = a.addSecrets(ns)
+	err = a.addSecrets(ctx, ns)
 	if err != nil {
 		return err
 	}
 
 	// Create a map of networks from the nodes found.
 	for _, v := range ns {
-		net := nets[v.network]
-		if net == nil {
-			net = &nodes{}
-			net.dict = make(map[string]*node)
-			nets[v.network] = net
-		}
-		net.all = append(net.all, v)
-		net.dict[v.domain] = v
+		v.clock = a.clock
+		addNodeToNetworks(nets, v)
 	}
 
 	// Finally sort the nodes by hash values and whether they are active.
@@ -144,8 +155,9 @@ func (a *Firebase) refresh() error {
 	return nil
 }
 
-func (f *Firebase) addSecrets(ns map[string]*node) error {
-	ctx := context.Background()
+func (f *Firebase) addSecrets(
+	ctx context.Context,
+	ns map[string]*node) error {
 	iter := f.client.Collection(secretsTableName).Documents(ctx)
 	for {
 		doc, err := iter.Next()
@@ -157,7 +169,10 @@ func (f *Firebase) addSecrets(ns map[string]*node) error {
 		}
 		var item SecretItem
 		doc.DataTo(&item)
-		s, err := newSecretFromKey(item.ScramblerKey, item.TimeStamp)
+		s, err := newSecretFromKeyWithAEAD(
+			item.ScramblerKey,
+			item.TimeStamp,
+			item.AEAD)
 		if err != nil {
 			return err
 		}
@@ -166,7 +181,7 @@ func (f *Firebase) addSecrets(ns map[string]*node) error {
 		}
 	}
 
-	// Sort the secrets so the most recent is at the start of the array.
+	// Sort the secrets so the most recent is at the end of the array.
 	for _, n := range ns {
 		n.sortSecrets()
 	}
@@ -174,9 +189,9 @@ func (f *Firebase) addSecrets(ns map[string]*node) error {
 	return nil
 }
 
-func (f *Firebase) fetchNodes() (map[string]*node, error) {
+func (f *Firebase) fetchNodes(
+	ctx context.Context) (map[string]*node, error) {
 	ns := make(map[string]*node)
-	ctx := context.Background()
 
 	iter := f.client.Collection(nodesTableName).Documents(ctx)
 	for {
@@ -199,19 +214,21 @@ func (f *Firebase) fetchNodes() (map[string]*node, error) {
 		if err != nil {
 			return nil, err
 		}
+		ns[item.Domain].weight = getWeight(item.Weight)
+		ns[item.Domain].retiring = item.Retiring
 	}
 	return ns, nil
 }
 
-func (f *Firebase) setNodeSecrets(node *node) error {
-	ctx := context.Background()
+func (f *Firebase) setNodeSecrets(ctx context.Context, node *node) error {
 	for _, s := range node.secrets {
 
 		item := SecretItem{
 			node.domain,
 			s.timeStamp,
 			node.expires.Unix(),
-			s.key}
+			s.key,
+			s.crypto.aead}
 
 		_, _, err := f.client.Collection(secretsTableName).Add(ctx, item)
 		if err != nil {
@@ -220,3 +237,73 @@ func (f *Firebase) setNodeSecrets(node *node) error {
 	}
 	return nil
 }
+
+// getTableDoc returns the document for the table state. The document ID is the
+// table name in URL safe base 64 as table names can contain characters that
+// are not allowed in document IDs.
+func (f *Firebase) getTableDoc(table string) *firestore.DocumentRef {
+	return f.client.Collection(tablesTableName).Doc(
+		base64.RawURLEncoding.EncodeToString([]byte(table)))
+}
+
+// addTable records the table without altering the time it was disabled if it
+// has already been recorded.
+func (f *Firebase) addTable(ctx context.Context, table string) error {
+	return f.addTableOnce(table, func() error {
+		_, err := f.getTableDoc(table).Set(
+			ctx,
+			map[string]interface{}{tableFieldName: table},
+			firestore.MergeAll)
+		return err
+	})
+}
+
+func (f *Firebase) getTables(ctx context.Context) ([]string, error) {
+	t := make([]string, 0)
+	iter := f.client.Collection(tablesTableName).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var item TableItem
+		err = doc.DataTo(&item)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, item.Table)
+	}
+	sort.Strings(t)
+	return t, nil
+}
+
+// getTableDisabled reads the table state from storage so that tables disabled
+// by any instance are seen immediately.
+func (f *Firebase) getTableDisabled(
+	ctx context.Context,
+	table string) (time.Time, error) {
+	doc, err := f.getTableDoc(table).Get(ctx)
+	if doc != nil && doc.Exists() == false {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	var item TableItem
+	err = doc.DataTo(&item)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return item.Disabled, nil
+}
+
+func (f *Firebase) setTableDisabled(
+	ctx context.Context,
+	table string,
+	disabled time.Time) error {
+	_, err := f.getTableDoc(table).Set(ctx, TableItem{table, disabled})
+	return err
+}
@@ -17,14 +17,17 @@
 package swift
 
 import (
-	"errors"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -37,45 +40,108 @@ const (
 	messageColorParam    = "messageColor"
 	tableParam           = "table"
 	xforwarededfor       = "X-FORWARDED-FOR"
+	xrealip              = "X-REAL-IP"
 	remoteAddr           = "remoteAddr"
 	bounces              = "bounces"
 	stateParam           = "state"
 	accessKey            = "accessKey"
+	keyParam             = "key"
+	networkParam         = "network"
+	useCookiesParam      = "useCookies"
+	formatParam          = "format"
+	homeNodeParam        = "homeNode"
+	binaryParam          = "binary"
+	redundancyParam      = "redundancy"
 )
 
+// PayloadUtilizationHeader is added to the create handler response when the
+// URL that starts the storage operation is approaching the maximum length. The
+// value is the percentage of the maximum used, for example 82%. Advisory only,
+// the operation is still created.
+const PayloadUtilizationHeader = "X-Swift-Payload-Utilization"
+
+// MaxStateLength is the most bytes of state information that can be carried
+// by a storage operation and returned in the results. The state is encrypted
+// with the operation so any characters other than the null character can be
+// used.
+const MaxStateLength = 2048
+
+// CreateResponse is returned by HandlerCreate when the caller requests JSON
+// rather than plain text.
+type CreateResponse struct {
+	URL      string `json:"url"`      // The URL to start the storage operation
+	HomeNode string `json:"homeNode"` // The domain of the home node selected
+}
+
 // Used to determine the storage character from the key to use for the
 // operation.
 var operationCharacterRegEx *regexp.Regexp
 
+// Set if the package could not be initialised. Logged when Services are created
+// and returned when pairs are created.
+var initError error
+
 func init() {
-	var err error
-	operationCharacterRegEx, err = regexp.Compile("\\<|\\>|\\+")
-	if err != nil {
-		log.Fatal(err)
-	}
+	operationCharacterRegEx, initError = regexp.Compile("\\<|\\>|\\+|\\*|\\?")
 }
 
 // HandlerCreate takes a Services pointer and returns a HTTP handler used by an
-// Access Node to obtain the initial URL for a storage operation.
+// Access Node to obtain the initial URL for a storage operation. The URL is
+// returned as plain text unless JSON is requested, or if the format parameter
+// is redirect the browser is sent straight to the URL with a 302 response.
 func HandlerCreate(s *Services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
 		// Check caller can access
 		if s.getAccessAllowed(w, r) == false {
-			returnAPIError(s, w,
-				errors.New("Not authorized"),
-				http.StatusUnauthorized)
 			return
 		}
 
-		u, err := createURL(s, r)
+		// Check the access key can be used with the table.
+		if s.getTableAllowed(w, r, r.FormValue(tableParam)) == false {
+			return
+		}
+
+		// Check the caller has not exceeded the rate limit.
+		if s.getRateAllowed(w, r) == false {
+			return
+		}
+
+		o, u, err := createURL(s, r)
 		if err != nil {
 			returnAPIError(s, w, err, http.StatusBadRequest)
 			return
 		}
-		b := []byte(u)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-cache")
+		s.metrics.IncCreated()
+		if p, ok := s.config.payloadUtilization(len(u)); ok {
+			w.Header().Set(PayloadUtilizationHeader, fmt.Sprintf("%d%%", p))
+		}
+		if getCreateAsRedirect(r) {
+			w.Header().Set("Cache-Control", s.config.cacheControl("create"))
+			http.Redirect(w, r, u, http.StatusFound)
+			return
+		}
+		var b []byte
+		if getCreateAsJSON(r) {
+			b, err = json.Marshal(&CreateResponse{u, o.homeNode})
+			if err != nil {
+				returnServerError(s, w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			b = []byte(u)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.Header().Set("Cache-Control", s.config.cacheControl("create"))
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b)))
 		_, err = w.Write(b)
 		if err != nil {
@@ -91,33 +157,160 @@ func SetHomeNodeHeaders(r *http.Request, q *url.Values) {
 	if r.Header.Get("X-FORWARDED-FOR") != "" {
 		q.Set("X-FORWARDED-FOR", r.Header.Get("X-FORWARDED-FOR"))
 	}
+	if r.Header.Get(xrealip) != "" {
+		q.Set(xrealip, r.Header.Get(xrealip))
+	}
 	q.Set("remoteAddr", r.RemoteAddr)
 }
 
-func createURL(s *Services, r *http.Request) (string, error) {
+// SetState adds the state information to the values collection used to create
+// a storage operation. The state is returned unaltered in the State field of
+// the results. An error is returned if the state is longer than
+// MaxStateLength or contains a null character.
+func SetState(q *url.Values, s string) error {
+	err := validateState(s)
+	if err != nil {
+		return err
+	}
+	q.Set(stateParam, s)
+	return nil
+}
+
+// validateState returns an error if the state can not be carried by a storage
+// operation.
+func validateState(s string) error {
+	if len(s) > MaxStateLength {
+		return fmt.Errorf(
+			"State length '%d' exceeds maximum '%d'",
+			len(s),
+			MaxStateLength)
+	}
+	if strings.IndexByte(s, 0) >= 0 {
+		return fmt.Errorf("State must not contain a null character")
+	}
+	return nil
+}
+
+// getAccessNetwork returns the name of the network to use for an operation
+// started by the access node. If the access node belongs to more than one
+// network then the network parameter must be used to select one.
+func getAccessNetwork(a *node, r *http.Request) (string, error) {
+	n := r.Form.Get(networkParam)
+	if n == "" {
+		if len(a.networks) == 1 {
+			return a.networks[0], nil
+		}
+		return "", fmt.Errorf(
+			"Access node '%s' belongs to '%d' networks. Use the '%s' "+
+				"parameter to select the network",
+			a.domain,
+			len(a.networks),
+			networkParam)
+	}
+	if a.inNetwork(n) == false {
+		return "", fmt.Errorf(
+			"Access node '%s' is not in network '%s'",
+			a.domain,
+			n)
+	}
+	return n, nil
+}
+
+// getCreateAsJSON returns true if the caller has requested the create response
+// as JSON either via the format parameter or the Accept header.
+func getCreateAsJSON(r *http.Request) bool {
+	if r.Form.Get(formatParam) != "" {
+		return r.Form.Get(formatParam) == "json"
+	}
+	for _, a := range strings.Split(r.Header.Get("Accept"), ",") {
+		m := strings.TrimSpace(strings.Split(a, ";")[0])
+		if m == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+// getCreateAsRedirect returns true if the caller has requested that the create
+// response redirects the browser to the storage operation via the format
+// parameter.
+func getCreateAsRedirect(r *http.Request) bool {
+	return r.Form.Get(formatParam) == "redirect"
+}
+
+// createURL returns the operation and the first URL of the storage operation.
+func createURL(s *Services, r *http.Request) (*operation, string, error) {
+	o, err := createOperation(s, r)
+	if err != nil {
+		return nil, "", err
+	}
+	err = o.setValuesFromForm(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if r.Form.Get(useCookiesParam) != "" {
+		c, err := strconv.ParseBool(r.Form.Get(useCookiesParam))
+		if err != nil {
+			return nil, "", err
+		}
+		if c {
+			err = o.setValuesFromCookies(r)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	u, err := o.getFirstURL(r)
+	if err != nil {
+		return nil, "", err
+	}
+	m := s.config.MaxURLLength
+	if m > 0 && len(u) > m {
+		return nil, "", fmt.Errorf(
+			"%w: length '%d' exceeds maximum '%d' with '%d' values, reduce "+
+				"the number or size of the values",
+			ErrURLTooLong,
+			len(u),
+			m,
+			len(o.values))
+	}
+
+	// Only record the table once the operation is known to be valid so that
+	// rejected requests do not add tables.
+	err = s.addTable(r.Context(), o.table)
+	if err != nil {
+		return nil, "", err
+	}
+	return o, u, nil
+}
+
+// createOperation returns a new operation for the access node associated with
+// the request with all the parameters other than the key value pairs set from
+// the form values or the configuration.
+func createOperation(s *Services, r *http.Request) (*operation, error) {
 
 	// Get the node associated with the request.
-	a, err := s.store.getNode(r.Host)
+	a, err := s.store.getNode(r.Context(), r.Host)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if a == nil {
-		return "", fmt.Errorf("Host '%s' is not a Swift node", r.Host)
+		return nil, fmt.Errorf("Host '%s': %w", r.Host, ErrNotSwiftNode)
 	}
 
 	// If the node is not an access node then return an error.
 	if a.role != roleAccess {
-		return "", fmt.Errorf("Domain '%s' is not an access node", a.domain)
+		return nil, fmt.Errorf("Domain '%s': %w", a.domain, ErrNotAccessNode)
 	}
 
-	// Create the operation.
+	// Create the operation with a nonce that is used to ensure the results
+	// can only be used once.
 	o := newOperation(s, a)
-
-	// Set the network for the operation.
-	o.network, err = s.store.getNodes(a.network)
+	n, err := randomBytes(16)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	o.nonce = base64.RawURLEncoding.EncodeToString(n)
 
 	// Set the access node domain so that the end operation can be called
 	// to decrypt the data in the return url.
@@ -126,47 +319,113 @@ func createURL(s *Services, r *http.Request) (string, error) {
 	// Add the parameters to the operation.
 	err = r.ParseForm()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// Set the network for the operation.
+	o.networkName, err = getAccessNetwork(a, r)
+	if err != nil {
+		return nil, err
+	}
+	o.network, err = s.store.getNodes(r.Context(), o.networkName)
+	if err != nil {
+		return nil, err
+	}
+	if o.network == nil {
+		return nil, fmt.Errorf("Network '%s' does not exist", o.networkName)
 	}
 
 	// Set the node count.
 	if r.Form.Get(bounces) != "" {
 		c, err := strconv.Atoi(r.Form.Get(bounces))
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		if c <= 0 {
-			return "", fmt.Errorf("Bounces must be greater than 0")
-		} else if c < 255 {
-			o.nodeCount = byte(c)
-		} else {
-			return "", fmt.Errorf("Bounces '%d' must be less than 255", c)
+		if c < s.config.minBounces() {
+			return nil, fmt.Errorf(
+				"Bounces '%d' must be at least '%d'",
+				c,
+				s.config.minBounces())
+		} else if c > s.config.maxBounces() {
+			return nil, fmt.Errorf(
+				"Bounces '%d' must not exceed '%d'",
+				c,
+				s.config.maxBounces())
 		}
+		o.nodeCount = byte(c)
 	} else {
 		o.nodeCount = s.config.NodeCount
 	}
 
+	// Set the number of storage nodes the values are written to. The home node
+	// is visited first and last with the replicas visited before the last
+	// visit so the node count must allow for all of them.
+	if r.Form.Get(redundancyParam) != "" {
+		c, err := strconv.Atoi(r.Form.Get(redundancyParam))
+		if err != nil {
+			return nil, err
+		}
+		if c < 1 || c >= s.config.maxBounces() {
+			return nil, fmt.Errorf(
+				"Redundancy '%d' must be between '1' and '%d'",
+				c,
+				s.config.maxBounces()-1)
+		}
+		o.redundancy = byte(c)
+	} else {
+		o.redundancy = byte(s.config.redundancy())
+	}
+	if o.redundancy > 1 && o.nodeCount <= o.redundancy {
+		o.nodeCount = o.redundancy + 1
+	}
+
 	// Set the return URL that will have the encrypted data appended to it.
 	ru, err := url.Parse(r.Form.Get(returnURLParam))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if ru.Host == "" {
-		return "", fmt.Errorf("Missing host from URL '%s'", ru)
+		return nil, fmt.Errorf("Missing host from URL '%s'", ru)
 	}
 	if ru.Scheme == "" {
-		return "", fmt.Errorf("Missing scheme from URL '%s'", ru)
+		return nil, fmt.Errorf("Missing scheme from URL '%s'", ru)
 	}
 	o.returnURL = ru.String()
 
 	// Set any state information if provided.
-	o.state = r.Form.Get(stateParam)
+	err = o.setState(r.Form.Get(stateParam))
+	if err != nil {
+		return nil, err
+	}
 
 	// Set the table that will be used for the storage of the key value
 	// pairs.
 	o.table = r.Form.Get(tableParam)
 	if o.table == "" {
-		return "", fmt.Errorf("Missing table name")
+		return nil, ErrMissingTable
+	}
+	d, err := s.getTableDisabled(r.Context(), o.table)
+	if err != nil {
+		return nil, err
+	}
+	if d {
+		return nil, fmt.Errorf("Table '%s': %w", o.table, ErrTableDisabled)
+	}
+
+	// Set the webhook the results are also posted to if provided.
+	if v := r.Form.Get(webhookURLParam); v != "" {
+		err = validateWebhookURL(v)
+		if err != nil {
+			return nil, err
+		}
+		o.webhookURL = v
+	}
+
+	// Sign the fields that determine where the results are delivered so that
+	// any changes can be detected.
+	err = o.sign(a)
+	if err != nil {
+		return nil, err
 	}
 
 	// Set the browser warning probability if provided.
@@ -204,33 +463,162 @@ func createURL(s *Services, r *http.Request) (string, error) {
 		o.HTML.ProgressColor = s.config.ProgressColor
 	}
 
-	// Add the key value pairs from the form parameters.
-	for k, v := range r.Form {
+	return o, nil
+}
+
+// setValuesFromForm adds the key value pairs from the form parameters that are
+// not reserved to the operation. The values of keys listed in the binary
+// parameter must be binary data in URL safe base 64 and can not be added to
+// lists. Values are validated and then transformed by any transformer for the
+// key.
+func (o *operation) setValuesFromForm(r *http.Request) error {
+
+	// Get the keys whose values are binary data.
+	b := make(map[string]bool)
+	for _, v := range r.Form[binaryParam] {
+		for _, k := range strings.Split(v, ",") {
+			b[o.services.config.normalize(strings.TrimSpace(k))] = true
+		}
+	}
+
+	// Add the key value pairs from the form parameters in the order of the
+	// parameter names so that the values are always in the same order.
+	n := make([]string, 0, len(r.Form))
+	for k := range r.Form {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	l := 0
+	for _, k := range n {
+		v := r.Form[k]
 		if isReserved(k) == false && len(v) > 0 {
-			p, err := createPair(k, v[0])
+			p, err := createPair(
+				k,
+				v[0],
+				o.services.now(),
+				&o.services.config)
 			if err != nil {
-				return "", err
+				return err
 			}
 			if p.conflict == conflictInvalid {
-				return "", fmt.Errorf(
+				return fmt.Errorf(
 					"Pair does not contain valid conflict flag")
 			}
+			p.expires = o.services.jitterExpiry(p.expires, p.created)
+			if b[p.key] {
+				_, err = base64.RawURLEncoding.DecodeString(p.value)
+				if err != nil {
+					return fmt.Errorf(
+						"Binary value for key '%s' must be URL safe base 64",
+						p.key)
+				}
+
+				// List values are joined with a separator that the base 64
+				// decoder ignores so binary values can not be merged.
+				if p.conflict == conflictAdd || p.conflict == conflictUnique {
+					return fmt.Errorf(
+						"Binary value for key '%s' must not use '+' or '*'",
+						p.key)
+				}
+				p.binary = true
+			}
+			err = o.services.validatePair(o.table, p)
+			if err != nil {
+				return err
+			}
+			err = o.services.transformPair(o.table, p)
+			if err != nil {
+				return err
+			}
 			o.values = append(o.values, p)
+			l += len(p.value)
 		}
 	}
 
-	// For this network and request find the home node.
-	xff := r.Form.Get(xforwarededfor)
-	if xff == "" {
-		xff = r.Header.Get("X-FORWARDED-FOR")
+	// Check the pairs are within the limits for a single operation.
+	if len(o.values) > o.services.config.maxPairs() {
+		return fmt.Errorf(
+			"'%d' pairs exceeds the maximum of '%d'",
+			len(o.values),
+			o.services.config.maxPairs())
 	}
-	ra := r.Form.Get(remoteAddr)
-	if ra == "" {
-		ra = r.RemoteAddr
+	if l > o.services.config.maxValueBytes() {
+		return fmt.Errorf(
+			"'%d' value bytes exceeds the maximum of '%d'",
+			l,
+			o.services.config.maxValueBytes())
 	}
-	o.nextNode, err = o.network.getHomeNode(xff, ra)
-	if err != nil {
-		return "", err
+
+	return nil
+}
+
+// setValuesFromCookies merges the values in the request's cookies for this node
+// with the values from the form. Conflicts are resolved in the same way as they
+// are during the storage operation. Cookies that can not be decrypted, or that
+// do not relate to the key they contain, are ignored. An error is returned if
+// the values from the cookies would exceed the maximum number of pairs.
+func (o *operation) setValuesFromCookies(r *http.Request) error {
+	for _, c := range r.Cookies() {
+		v, err := o.getValueFromCookie(r, c)
+		if err != nil {
+			continue
+		}
+		m := false
+		for _, n := range o.getCookieNames(v.key) {
+			m = m || c.Name == n
+		}
+		if m == false {
+			continue
+		}
+		if v.isExpiredAt(o.services.now()) {
+			continue
+		}
+		f := false
+		for _, p := range o.values {
+			if p.key == v.key {
+				f = true
+				res, err := resolveConflict(p, v, o.services.now())
+				if err != nil {
+					o.services.logger.Debug("%s", err)
+				} else if res != p {
+					*p = *res
+				}
+				break
+			}
+		}
+		if f == false {
+			if len(o.values) >= o.services.config.maxPairs() {
+				return fmt.Errorf(
+					"Values from cookies exceed the maximum of '%d' pairs",
+					o.services.config.maxPairs())
+			}
+			o.values = append(o.values, v)
+		}
+	}
+	return nil
+}
+
+// getFirstURL finds the home node for the request and returns the URL the
+// browser must navigate to in order to start the storage operation.
+func (o *operation) getFirstURL(r *http.Request) (string, error) {
+	var err error
+
+	// Use the home node requested if provided, otherwise for this network and
+	// request find the home node.
+	if r.Form.Get(homeNodeParam) != "" {
+		o.nextNode, err = o.getHomeNodeOverride(r.Form.Get(homeNodeParam))
+		if err != nil {
+			return "", err
+		}
+	} else {
+		xff, ra := o.getClientAddress(r)
+		o.nextNode, err = o.network.getHomeNodeByStrategy(
+			o.services.homeNode,
+			xff,
+			ra)
+		if err != nil {
+			return "", err
+		}
 	}
 
 	// Store the home node for the operation in case something changes about the
@@ -246,22 +634,128 @@ func createURL(s *Services, r *http.Request) (string, error) {
 	return u.String(), nil
 }
 
-func createPair(k string, v string) (*pair, error) {
+// getClientAddress returns the forwarded for and remote addresses used to find
+// the home node. The values provided by SetHomeNodeHeaders take precedence over
+// the request's own headers. The client's hop of X-Forwarded-For is used if
+// present, then X-Real-IP if UseRealIP is enabled, then the remote address.
+func (o *operation) getClientAddress(r *http.Request) (string, string) {
+	xff := r.Form.Get(xforwarededfor)
+	if xff == "" {
+		xff = r.Header.Get("X-FORWARDED-FOR")
+	}
+	xff = getForwardedFor(xff, o.services.config.TrustedProxies)
+	if xff != "" {
+		return xff, ""
+	}
+	if o.services.config.UseRealIP {
+		x := r.Form.Get(xrealip)
+		if x == "" {
+			x = r.Header.Get(xrealip)
+		}
+		if x != "" {
+			return "", x
+		}
+	}
+	ra := r.Form.Get(remoteAddr)
+	if ra == "" {
+		ra = r.RemoteAddr
+	}
+	return "", ra
+}
+
+// getForwardedFor returns the X-Forwarded-For entry added by the first of the
+// trusted proxies, or empty if there are not enough entries. If there are no
+// trusted proxies then the header is returned unaltered so that the first entry
+// is used.
+func getForwardedFor(xff string, proxies int) string {
+	if proxies <= 0 || xff == "" {
+		return xff
+	}
+	e := strings.Split(xff, ",")
+	if len(e) < proxies {
+		return ""
+	}
+	return strings.TrimSpace(e[len(e)-proxies])
+}
+
+// getHomeNodeOverride returns the storage node in the operation's network with
+// the domain provided. Used to pin the home node for testing or sticky routing.
+func (o *operation) getHomeNodeOverride(domain string) (*node, error) {
+	n := o.network.dict[domain]
+	if n == nil {
+		return nil, fmt.Errorf(
+			"Home node '%s' is not in network '%s'",
+			domain,
+			o.networkName)
+	}
+	if n.role != roleStorage {
+		return nil, fmt.Errorf("Home node '%s' is not a storage node", domain)
+	}
+	return n, nil
+}
+
+// normalizeKey returns the key normalized if NormalizeUnicode is enabled, or
+// an error if the key is not valid UTF-8.
+func normalizeKey(k string, c *Configuration) (string, error) {
+	if utf8.ValidString(k) == false {
+		return "", fmt.Errorf("Key %q must be valid UTF-8", k)
+	}
+	return c.normalize(k), nil
+}
+
+// createPair returns the pair for the key and value created at the time
+// provided. If the configuration DefaultExpiry is greater than zero then a key
+// without a conflict character is newest wins and expires that many days after
+// the time provided, otherwise an error is returned for keys without a conflict
+// character. If MaxExpiry is greater than zero then expiry dates more than that
+// many days after the time provided are rejected. Keys and values must be valid
+// UTF-8 and are normalized if NormalizeUnicode is enabled.
+func createPair(
+	k string,
+	v string,
+	t time.Time,
+	c *Configuration) (*pair, error) {
 	var err error
 	var p pair
+	if initError != nil {
+		return nil, initError
+	}
+
+	// Reject text that is not UTF-8 so that the same key always has the same
+	// bytes once normalized.
+	k, err = normalizeKey(k, c)
+	if err != nil {
+		return nil, err
+	}
+	if utf8.ValidString(v) == false {
+		return nil, fmt.Errorf("Value for key %q must be valid UTF-8", k)
+	}
+	v = c.normalize(v)
 
 	// Get the command for the storage operation.
 	i := operationCharacterRegEx.FindStringIndex(k)
+	if i == nil && c.DefaultExpiry > 0 {
+		p.conflict = conflictNewest
+		p.expires = t.AddDate(0, 0, c.DefaultExpiry)
+		p.created = t
+		p.key = k
+		p.value = v
+		return &p, nil
+	}
 	if i == nil {
 		return nil, fmt.Errorf("Key '%s' must include a '+' to add the value "+
-			"to a list of values, or '<' (oldest wins) or '>' (newest wins) "+
+			"to a list of values, '*' to add the value to a list of unique "+
+			"values, '?' to only store the value if none exists, or '<' "+
+			"(oldest wins) or '>' (newest wins) "+
 			"character to determine how to resolve two values for the same "+
 			"key, followed by a date in YYYY-MM-DD format to indicate when "+
 			"the value expires and is automatically deleted", k)
 	}
 	if len(i) > 2 || i[1]-i[0] != 1 {
 		return nil, fmt.Errorf(
-			"Key '%s' must contained only one '+', '<' or '>' character", k)
+			"Key '%s' must contained only one '+', '*', '?', '<' or '>' "+
+				"character",
+			k)
 	}
 
 	// Set how multipe values for the same key are handled.
@@ -269,12 +763,18 @@ func createPair(k string, v string) (*pair, error) {
 	case '+':
 		p.conflict = conflictAdd
 		break
+	case '*':
+		p.conflict = conflictUnique
+		break
 	case '<':
 		p.conflict = conflictOldest
 		break
 	case '>':
 		p.conflict = conflictNewest
 		break
+	case '?':
+		p.conflict = conflictAbsent
+		break
 	default:
 		return nil, fmt.Errorf("Character '%c' invalid", k[i[0]])
 	}
@@ -285,18 +785,49 @@ func createPair(k string, v string) (*pair, error) {
 	if err != nil {
 		return nil, err
 	}
-	if p.expires.Before(time.Now().UTC()) {
+	if p.isExpiredAt(t) {
 		return nil, fmt.Errorf(
 			"Key expiry date '%s' must be in the future", k[i[0]+1:])
 	}
+	if c.MaxExpiry > 0 && p.expires.After(t.AddDate(0, 0, c.MaxExpiry)) {
+		return nil, fmt.Errorf(
+			"Key expiry date '%s' must be within '%d' days",
+			k[i[0]+1:],
+			c.MaxExpiry)
+	}
 
 	// Complete the data for the pair.
-	p.created = time.Now().UTC()
+	p.created = t
 	p.key = k[:i[0]]
 	p.value = v
 	return &p, err
 }
 
+// jitterExpiry returns the expiry time provided moved randomly by up to
+// ExpiryJitter seconds either way. The result is never more than MaxExpiry days
+// after the created time, and if moving the expiry would place it before the
+// created time then the expiry is returned unaltered.
+func (s *Services) jitterExpiry(e time.Time, created time.Time) time.Time {
+	if s.config.ExpiryJitter <= 0 {
+		return e
+	}
+	j := time.Duration(
+		(float64(s.getRandomFloat32())*2 - 1) *
+			float64(s.config.ExpiryJitter) *
+			float64(time.Second))
+	r := e.Add(j)
+	if r.After(created) == false {
+		return e
+	}
+	if s.config.MaxExpiry > 0 {
+		m := created.AddDate(0, 0, s.config.MaxExpiry)
+		if r.After(m) {
+			r = m
+		}
+	}
+	return r
+}
+
 func isReserved(s string) bool {
 	return s == titleParam ||
 		s == messageParam ||
@@ -307,8 +838,16 @@ func isReserved(s string) bool {
 		s == tableParam ||
 		s == browserWarningParam ||
 		s == xforwarededfor ||
+		s == xrealip ||
 		s == remoteAddr ||
 		s == bounces ||
 		s == stateParam ||
-		s == accessKey
+		s == accessKey ||
+		s == formatParam ||
+		s == binaryParam ||
+		s == networkParam ||
+		s == useCookiesParam ||
+		s == homeNodeParam ||
+		s == redundancyParam ||
+		s == webhookURLParam
 }
@@ -0,0 +1,1136 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreatePairLimit(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.MaxPairs = 2
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	q.Set(testKey("b"), "2")
+	w := testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	q.Set(testKey("c"), "3")
+	w = testCreate(s, q)
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+		return
+	}
+	if strings.Contains(w.Body.String(), "maximum") == false {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestCreateValueBytesLimit(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.MaxValueBytes = 10
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "12345")
+	q.Set(testKey("b"), "12345")
+	w := testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	q.Set(testKey("b"), "123456")
+	w = testCreate(s, q)
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
+
+func TestCreateJSONResponse(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	r := newCreateRequestTest(q)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	HandlerCreate(s)(w, r)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		fmt.Println(w.Header().Get("Content-Type"))
+		t.Fail()
+	}
+	var c CreateResponse
+	err = json.Unmarshal(w.Body.Bytes(), &c)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The home node must be the one the network selects for the request.
+	ns, err := s.store.getNodes(context.Background(), testNetwork)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	h, err := ns.getHomeNode("", r.RemoteAddr)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if c.HomeNode != h.domain {
+		fmt.Printf("Home node '%s' should be '%s'\n", c.HomeNode, h.domain)
+		t.Fail()
+	}
+	if strings.HasPrefix(c.URL, "https://"+h.domain+"/") == false {
+		fmt.Printf("URL '%s' should start with home node '%s'\n",
+			c.URL,
+			h.domain)
+		t.Fail()
+	}
+}
+
+func TestCreateFormatParam(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+
+	// Plain text is returned by default.
+	w := testCreate(s, q)
+	if w.Code != http.StatusOK ||
+		strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") == false {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+
+	// The format parameter requests JSON and is not treated as a pair.
+	q.Set(formatParam, "json")
+	w = testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var c CreateResponse
+	err = json.Unmarshal(w.Body.Bytes(), &c)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if c.URL == "" || c.HomeNode == "" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestCreateRedirect(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	q.Set(formatParam, "redirect")
+	w := testCreate(s, q)
+	if w.Code != http.StatusFound {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusFound, w.Code)
+		t.Fail()
+		return
+	}
+	o, err := testOperationFromURL(s, w.Header().Get("Location"))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(o.values) != 1 || o.values[0].value != "1" {
+		fmt.Println("Location should start the storage operation")
+		t.Fail()
+	}
+}
+
+func TestCreateMultipleNetworks(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	v := s.store.(*Volatile)
+	_, err = v.testAddNode("other", "other-1.com", roleStorage)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, err = v.testAddNode(
+		testNetwork+networkSeparator+"other",
+		testAccess,
+		roleAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+
+	// The network must be selected when the access node is in two networks.
+	w := testCreate(s, q)
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+		return
+	}
+
+	// The home node must come from the network selected.
+	q.Set(networkParam, "other")
+	w = testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	o, err := testOperationFromURL(s, w.Body.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if o.thisNode.domain != "other-1.com" || o.networkName != "other" {
+		fmt.Printf("Node '%s' in network '%s' incorrect\n",
+			o.thisNode.domain,
+			o.networkName)
+		t.Fail()
+	}
+
+	// A network the access node is not in is rejected.
+	q.Set(networkParam, "missing")
+	w = testCreate(s, q)
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
+
+func TestCreateTableScope(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.AccessKeyTables = map[string][]string{
+		testAccessKey: {"allowed", "tenant-*"}}
+	for k, e := range map[string]int{
+		"allowed":  http.StatusOK,
+		"denied":   http.StatusForbidden,
+		"tenant-a": http.StatusOK,
+		"tenant":   http.StatusForbidden} {
+		q := newCreateValuesTest()
+		q.Set(testKey("a"), "1")
+		q.Set(tableParam, k)
+		w := testCreate(s, q)
+		if w.Code != e {
+			fmt.Printf("Table '%s' expected '%d' but got '%d'\n", k, e, w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestCreateUseCookies(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := s.store.getNode(context.Background(), testAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Cookies for an older value of the key in the form, and a key that is not
+	// in the form.
+	e := newOperation(s, a)
+	e.values = []*pair{
+		testPair("a", "old", conflictNewest, -time.Hour),
+		testPair("b", "existing", conflictNewest, -time.Hour)}
+	c := testCookies(t, e)
+
+	// The form uses oldest wins so the older value in the cookie should win.
+	// Corrupt cookies are ignored.
+	q := newCreateValuesTest()
+	q.Set("a<"+time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02"), "new")
+	q.Set(useCookiesParam, "true")
+	r := newCreateRequestTest(q)
+	for _, v := range c {
+		r.AddCookie(v)
+	}
+	r.AddCookie(&http.Cookie{Name: c[0].Name + "x", Value: "corrupt"})
+	r.AddCookie(&http.Cookie{Name: "other", Value: testCorrupt(c[1].Value)})
+	w := httptest.NewRecorder()
+	HandlerCreate(s)(w, r)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	o, err := testOperationFromURL(s, w.Body.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	v := make(map[string]string)
+	for _, p := range o.values {
+		v[p.key] = p.value
+	}
+	if len(v) != 2 || v["a"] != "old" || v["b"] != "existing" {
+		fmt.Println(v)
+		t.Fail()
+	}
+}
+
+func TestCreateUseCookiesPairLimit(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.MaxPairs = 2
+	a, err := s.store.getNode(context.Background(), testAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e := newOperation(s, a)
+	e.values = []*pair{
+		testPair("b", "1", conflictNewest, -time.Hour),
+		testPair("c", "2", conflictNewest, -time.Hour)}
+	c := testCookies(t, e)
+
+	// The form and the cookies together exceed the maximum so an error is
+	// returned rather than existing values being dropped.
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	q.Set(useCookiesParam, "true")
+	r := newCreateRequestTest(q)
+	for _, v := range c {
+		r.AddCookie(v)
+	}
+	w := httptest.NewRecorder()
+	HandlerCreate(s)(w, r)
+	if w.Code != http.StatusBadRequest ||
+		strings.Contains(w.Body.String(), "maximum") == false {
+		fmt.Printf("Expected '%d' but got '%d' '%s'\n",
+			http.StatusBadRequest,
+			w.Code,
+			w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestCreateBounces(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.MinBounces = 2
+	s.config.MaxBounces = 4
+	s.config.NodeCount = 3
+	for b, e := range map[string]int{
+		"1": http.StatusBadRequest,
+		"2": http.StatusOK,
+		"4": http.StatusOK,
+		"5": http.StatusBadRequest} {
+		q := newCreateValuesTest()
+		q.Set(testKey("a"), "1")
+		q.Set(bounces, b)
+		w := testCreate(s, q)
+		if w.Code != e {
+			fmt.Printf("Bounces '%s' expected '%d' but got '%d'\n", b, e, w.Code)
+			t.Fail()
+		}
+	}
+
+	// The configured node count is used when bounces is not provided.
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	w := testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	o, err := testOperationFromURL(s, w.Body.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if o.nodeCount != 3 {
+		fmt.Printf("Node count '%d' should be '3'\n", o.nodeCount)
+		t.Fail()
+	}
+}
+
+func TestCreateRateLimit(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n := time.Now()
+	b := newTokenBucket(1, 2)
+	b.now = func() time.Time { return n }
+	s.SetRateLimiter(b)
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+
+	// Exhaust the bucket.
+	for _, e := range []int{
+		http.StatusOK,
+		http.StatusOK,
+		http.StatusTooManyRequests} {
+		w := testCreate(s, q)
+		if w.Code != e {
+			fmt.Printf("Expected '%d' but got '%d'\n", e, w.Code)
+			t.Fail()
+		}
+	}
+
+	// A different access key has its own bucket.
+	s.config.AccessKeys = []string{"other"}
+	o := newCreateValuesTest()
+	o.Set(testKey("a"), "1")
+	o.Set(accessKey, "other")
+	w := testCreate(s, o)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+
+	// After a second a token is available again.
+	n = n.Add(time.Second)
+	w = testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+	w = testCreate(s, q)
+	if w.Code != http.StatusTooManyRequests {
+		fmt.Printf("Expected '%d' but got '%d'\n",
+			http.StatusTooManyRequests,
+			w.Code)
+		t.Fail()
+	}
+}
+
+func TestCreateContextCancelled(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.store = &blockingStoreTest{s.store}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+
+	// Cancel the request context while the store lookup is blocked.
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newCreateRequestTest(q).WithContext(ctx)
+	w := httptest.NewRecorder()
+	c := make(chan bool)
+	go func() {
+		HandlerCreate(s)(w, r)
+		close(c)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		fmt.Println("Handler did not return after the context was cancelled")
+		t.Fail()
+		return
+	}
+	if w.Code == http.StatusOK {
+		fmt.Println("Cancelled request should not succeed")
+		t.Fail()
+	}
+}
+
+func TestCreateHomeNode(t *testing.T) {
+	v, err := newVolatileNetworkTest(5)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, err = v.testAddNode("other", "other-1.com", roleStorage)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	q.Set(formatParam, "json")
+
+	// Without the parameter the home node is selected by hashing.
+	ns, err := v.getNodes(context.Background(), testNetwork)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	h, err := ns.getHomeNode("", newCreateRequestTest(q).RemoteAddr)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c, err := testCreateHomeNode(s, q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if c.HomeNode != h.domain {
+		fmt.Printf("Home node '%s' should be '%s'\n", c.HomeNode, h.domain)
+		t.Fail()
+	}
+
+	// Every storage node in the network can be chosen explicitly.
+	for i := 1; i <= 5; i++ {
+		d := fmt.Sprintf("storage-%d.com", i)
+		q.Set(homeNodeParam, d)
+		c, err := testCreateHomeNode(s, q)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if c.HomeNode != d {
+			fmt.Printf("Home node '%s' should be '%s'\n", c.HomeNode, d)
+			t.Fail()
+		}
+		if strings.HasPrefix(c.URL, "https://"+d+"/") == false {
+			fmt.Printf("URL '%s' should start with home node '%s'\n", c.URL, d)
+			t.Fail()
+		}
+	}
+
+	// Nodes outside the network, or that are not storage nodes, are errors.
+	for _, d := range []string{"other-1.com", testAccess, "missing.com"} {
+		q.Set(homeNodeParam, d)
+		w := testCreate(s, q)
+		if w.Code == http.StatusOK {
+			fmt.Printf("Home node '%s' should not be allowed\n", d)
+			t.Fail()
+		}
+	}
+}
+
+func TestCreateState(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	u := "eyJhbGciOiJIUzI1NiJ9.e30.sig+/=?&#% \"<>'\u00e9\u20ac\r\n"
+	l := strings.Repeat(u, MaxStateLength/len(u))
+	l += strings.Repeat("x", MaxStateLength-len(l))
+	for _, v := range []string{u, l} {
+		q := newCreateValuesTest()
+		q.Set(testKey("a"), "1")
+		err = SetState(&q, v)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		w := testCreate(s, q)
+		if w.Code != http.StatusOK {
+			fmt.Println(w.Body.String())
+			t.Fail()
+			return
+		}
+		o, err := testOperationFromURL(s, w.Body.String())
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if o.State() != v {
+			fmt.Printf("State '%s' should be '%s'\n", o.State(), v)
+			t.Fail()
+		}
+
+		// The state must be returned unaltered in the results.
+		b, err := encodeResults(o.newResults())
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		r, err := DecodeResults(b)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if r.State != v {
+			fmt.Printf("Results state '%s' should be '%s'\n", r.State, v)
+			t.Fail()
+		}
+	}
+}
+
+func TestCreateStateInvalid(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	for _, v := range []string{
+		strings.Repeat("x", MaxStateLength+1),
+		"a\x00b"} {
+		if SetState(&q, v) == nil {
+			fmt.Printf("State of length '%d' should be invalid\n", len(v))
+			t.Fail()
+		}
+
+		// The create handler rejects invalid state set directly.
+		q.Set(testKey("a"), "1")
+		q.Set(stateParam, v)
+		w := testCreate(s, q)
+		if w.Code != http.StatusBadRequest {
+			fmt.Printf("Expected '%d' but got '%d'\n",
+				http.StatusBadRequest,
+				w.Code)
+			t.Fail()
+		}
+	}
+}
+
+// testCreateHomeNode calls the create handler expecting a JSON response.
+func testCreateHomeNode(s *Services, q url.Values) (*CreateResponse, error) {
+	var c CreateResponse
+	w := testCreate(s, q)
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("Status '%d': %s", w.Code, w.Body.String())
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// blockingStoreTest is a store where node lookups block until the context is
+// cancelled.
+type blockingStoreTest struct {
+	Store
+}
+
+func (b *blockingStoreTest) getNode(
+	ctx context.Context,
+	domain string) (*node, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCreateTableSecrets(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.TableSecrets = true
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	c := testCreate(s, q)
+	if c.Code != http.StatusOK {
+		fmt.Println(c.Body.String())
+		t.Fail()
+		return
+	}
+	u, err := url.Parse(c.Body.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	o, err := testOperationFromURL(s, u.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if o.table != "table" {
+		fmt.Printf("Expected 'table' but got '%s'\n", o.table)
+		t.Fail()
+	}
+
+	// The operation can not be decrypted with another table's keys.
+	a := strings.Split(u.Path, "/")
+	a[len(a)-2] = o.scramble(o.thisNode, "other")
+	u.Path = strings.Join(a, "/")
+	_, err = testOperationFromURL(s, u.String())
+	if err == nil {
+		fmt.Println("Operation should not decrypt with table 'other'")
+		t.Fail()
+	}
+}
+
+func TestCreateMaxURLLength(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.MaxURLLength = 2000
+
+	// A small value is within the limit.
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	c := testCreate(s, q)
+	if c.Code != http.StatusOK {
+		fmt.Println(c.Body.String())
+		t.Fail()
+		return
+	}
+	if len(c.Body.String()) > s.config.MaxURLLength {
+		fmt.Printf("URL length '%d' exceeds limit\n", len(c.Body.String()))
+		t.Fail()
+	}
+
+	// Random bytes do not compress so the URL exceeds the limit.
+	b, err := randomBytes(2000)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q.Set(testKey("a"), base64.RawURLEncoding.EncodeToString(b))
+	c = testCreate(s, q)
+	if c.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n",
+			http.StatusBadRequest,
+			c.Code)
+		t.Fail()
+	}
+	r := newCreateRequestTest(q)
+	r.ParseForm()
+	_, _, err = createURL(s, r)
+	if errors.Is(err, ErrURLTooLong) == false {
+		fmt.Printf("Expected '%v' but got '%v'\n", ErrURLTooLong, err)
+		t.Fail()
+	}
+}
+
+func TestCreatePayloadUtilization(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// A small value has no warning.
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	c := testCreate(s, q)
+	if c.Code != http.StatusOK {
+		fmt.Println(c.Body.String())
+		t.Fail()
+		return
+	}
+	if v := c.Header().Get(PayloadUtilizationHeader); v != "" {
+		fmt.Printf("Unexpected utilization '%s'\n", v)
+		t.Fail()
+	}
+
+	// A value that nearly fills the default maximum URL length is advised.
+	b, err := randomBytes(1200)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q.Set(testKey("a"), base64.RawURLEncoding.EncodeToString(b))
+	c = testCreate(s, q)
+	if c.Code != http.StatusOK {
+		fmt.Println(c.Body.String())
+		t.Fail()
+		return
+	}
+	e := fmt.Sprintf("%d%%", len(c.Body.String())*100/defaultURLLength)
+	if v := c.Header().Get(PayloadUtilizationHeader); v != e {
+		fmt.Printf("Expected utilization '%s' but got '%s'\n", e, v)
+		t.Fail()
+	}
+
+	// The warning can be disabled.
+	s.config.PayloadWarning = -1
+	c = testCreate(s, q)
+	if v := c.Header().Get(PayloadUtilizationHeader); v != "" {
+		fmt.Printf("Unexpected utilization '%s'\n", v)
+		t.Fail()
+	}
+}
+
+func TestCreateClientAddressForwardedFor(t *testing.T) {
+	testCreateClientAddress(t, true, 0, "1.1.1.1, 9.9.9.9", "", "1.1.1.1")
+}
+
+func TestCreateClientAddressRealIP(t *testing.T) {
+	testCreateClientAddress(t, true, 0, "", "2.2.2.2", "2.2.2.2")
+}
+
+func TestCreateClientAddressRealIPDisabled(t *testing.T) {
+	testCreateClientAddress(t, false, 0, "", "2.2.2.2", "3.3.3.3")
+}
+
+func TestCreateClientAddressRemoteAddr(t *testing.T) {
+	testCreateClientAddress(t, true, 0, "", "", "3.3.3.3")
+}
+
+func TestCreateClientAddressPrecedence(t *testing.T) {
+	testCreateClientAddress(t, true, 0, "1.1.1.1", "2.2.2.2", "1.1.1.1")
+}
+
+func TestCreateClientAddressTrustedProxies(t *testing.T) {
+	testCreateClientAddress(
+		t,
+		false,
+		2,
+		"6.6.6.6, 1.1.1.1, 7.7.7.7",
+		"",
+		"1.1.1.1")
+}
+
+func TestCreateClientAddressTrustedProxiesShort(t *testing.T) {
+	testCreateClientAddress(t, false, 2, "1.1.1.1", "", "3.3.3.3")
+}
+
+func TestCreateClientAddressForm(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.UseRealIP = true
+
+	// Values relayed via SetHomeNodeHeaders are used over the request's.
+	b := httptest.NewRequest("GET", "https://"+testAccess+"/", nil)
+	b.Header.Set(xrealip, "4.4.4.4")
+	b.RemoteAddr = "5.5.5.5:1234"
+	q := url.Values{}
+	SetHomeNodeHeaders(b, &q)
+	r := newCreateRequestTest(q)
+	r.Header.Set(xrealip, "2.2.2.2")
+	r.ParseForm()
+	testClientAddress(t, newOperation(s, nil), r, "4.4.4.4")
+}
+
+func TestCreateBinaryInvalid(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(binaryParam, "bitmap")
+	q.Set(testKey("bitmap"), "not base 64!")
+	w := testCreate(s, q)
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
+
+func TestCreateBinaryList(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d := time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02")
+	for _, c := range []string{"+", "*"} {
+		q := newCreateValuesTest()
+		q.Set(binaryParam, "bitmap")
+		q.Set("bitmap"+c+d, "YQ")
+		w := testCreate(s, q)
+		if w.Code != http.StatusBadRequest {
+			fmt.Printf("Expected '%d' for '%s' but got '%d'\n",
+				http.StatusBadRequest,
+				c,
+				w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestCreateExpiryJitter(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.ExpiryJitter = 3600
+	s.SetRandomSource(rand.NewSource(1))
+	q := newCreateValuesTest()
+	for i := 0; i < 10; i++ {
+		q.Set(testKey(fmt.Sprintf("key%d", i)), "1")
+	}
+	o, _, err := createURL(s, newCreateRequestTest(q))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err := time.Parse(
+		"2006-01-02",
+		time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02"))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := time.Second * time.Duration(s.config.ExpiryJitter)
+	d := make(map[time.Time]bool)
+	for _, p := range o.values {
+		if p.expires.Before(e.Add(-w)) || p.expires.After(e.Add(w)) {
+			fmt.Printf("Expiry '%s' outside window around '%s'\n", p.expires, e)
+			t.Fail()
+		}
+		d[p.expires] = true
+	}
+	if len(d) < 2 {
+		fmt.Println("Expiry times should be spread out")
+		t.Fail()
+	}
+}
+
+func TestCreateExpiryJitterMaxExpiry(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.ExpiryJitter = 3600
+	s.config.MaxExpiry = 2
+	s.SetRandomSource(rand.NewSource(1))
+	q := newCreateValuesTest()
+	x := time.Now().UTC().AddDate(0, 0, 2).Format("2006-01-02")
+	for i := 0; i < 10; i++ {
+		q.Set(fmt.Sprintf("key%d>%s", i, x), "1")
+	}
+	o, _, err := createURL(s, newCreateRequestTest(q))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, p := range o.values {
+		m := p.created.AddDate(0, 0, s.config.MaxExpiry)
+		if p.expires.After(m) {
+			fmt.Printf("Expiry '%s' after MaxExpiry '%s'\n", p.expires, m)
+			t.Fail()
+		}
+	}
+}
+
+func TestCreateRequestTooLarge(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.MaxRequestBytes = 1024
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), strings.Repeat("a", 2048))
+	w := testCreate(s, q)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		fmt.Printf("Expected '%d' but got '%d'\n",
+			http.StatusRequestEntityTooLarge,
+			w.Code)
+		t.Fail()
+	}
+}
+
+// testCreateClientAddress checks the address used to find the home node when
+// the X-Forwarded-For and X-Real-IP headers are set if not empty with the
+// number of trusted proxies. The remote address is always 3.3.3.3.
+func testCreateClientAddress(
+	t *testing.T,
+	useRealIP bool,
+	proxies int,
+	xff string,
+	realIP string,
+	expected string) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.UseRealIP = useRealIP
+	s.config.TrustedProxies = proxies
+	r := httptest.NewRequest("GET", "https://"+testAccess+"/", nil)
+	r.RemoteAddr = "3.3.3.3:1234"
+	if xff != "" {
+		r.Header.Set(xforwarededfor, xff)
+	}
+	if realIP != "" {
+		r.Header.Set(xrealip, realIP)
+	}
+	r.ParseForm()
+	testClientAddress(t, newOperation(s, nil), r, expected)
+}
+
+func testClientAddress(
+	t *testing.T,
+	o *operation,
+	r *http.Request,
+	expected string) {
+	if a := getRemoteAddr(o.getClientAddress(r)); a != expected {
+		fmt.Printf("Expected '%s' but got '%s'\n", expected, a)
+		t.Fail()
+	}
+}
+
+// newCreateTest returns services for a test network with storage nodes that
+// can be used to create storage operations.
+func newCreateTest() (*Services, error) {
+	v, err := newVolatileNetworkTest(5)
+	if err != nil {
+		return nil, err
+	}
+	return newServicesTest(v)
+}
+
+// newCreateValuesTest returns the parameters needed for a valid create request
+// excluding any key value pairs.
+func newCreateValuesTest() url.Values {
+	q := url.Values{}
+	q.Set(accessKey, testAccessKey)
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	return q
+}
+
+// testKey returns a newest wins key that expires in the future.
+func testKey(k string) string {
+	return k + ">" + time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02")
+}
+
+func newCreateRequestTest(q url.Values) *http.Request {
+	r := httptest.NewRequest(
+		"POST",
+		"https://"+testAccess+"/swift/api/v1/create",
+		strings.NewReader(q.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func testCreate(s *Services, q url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	HandlerCreate(s)(w, newCreateRequestTest(q))
+	return w
+}
+
+// testOperationFromURL returns the operation that the node for the URL would
+// process.
+func testOperationFromURL(s *Services, u string) (*operation, error) {
+	r := httptest.NewRequest("GET", u, nil)
+	return newOperationFromRequest(s, httptest.NewRecorder(), r)
+}
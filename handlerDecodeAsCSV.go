@@ -0,0 +1,123 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"time"
+)
+
+// HandlerDecodeAsCSV returns the incoming request as CSV data with a header
+// row followed by a row for each value containing the key, value and expiry
+// time. The query string contains the data which must be turned into a byte
+// array, decrypted and validated in the same way as the decode as JSON
+// handler.
+func HandlerDecodeAsCSV(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the node associated with the request.
+		n, err := getAccessNode(s, r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Get the data from the body or the query string.
+		d, err := getDataFromRequest(r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Decode, decrypt and validate the results.
+		a, err := decryptResults(r, s, n, d)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Check the access key can be used with the table.
+		if s.getTableAllowed(w, r, a.Table) == false {
+			return
+		}
+
+		// Check the results have not already been used.
+		if s.getNonceAllowed(w, a) == false {
+			return
+		}
+
+		// Remove any values that have expired since the results were created.
+		a.removeExpired(s.now())
+
+		// Turn the values into CSV rows after the header row.
+		b, err := getResultsCSV(a)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Cache-Control", s.config.cacheControl("decode-as-csv"))
+		err = sendResponse(w, r, b)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// getResultsCSV returns the values in the results as CSV with a header row.
+// Values are quoted where needed by the CSV writer.
+func getResultsCSV(a *Results) ([]byte, error) {
+	var b bytes.Buffer
+	c := csv.NewWriter(&b)
+	err := c.Write([]string{"key", "value", "expires"})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range a.Values {
+		err = c.Write([]string{
+			v.Key,
+			v.Value,
+			v.Expires.Format(time.RFC3339)})
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.Flush()
+	return b.Bytes(), c.Error()
+}
@@ -0,0 +1,72 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeAsCSV(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newResultsTest(2)
+	r.Values[1].Value = "a,b\nc"
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := httptest.NewRecorder()
+	HandlerDecodeAsCSV(s)(w, newDecodeRequestTest(d))
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") == false {
+		fmt.Println(w.Header().Get("Content-Type"))
+		t.Fail()
+	}
+	if strings.HasPrefix(w.Body.String(), "key,value,expires\n") == false {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+	if strings.Contains(w.Body.String(), "\"a,b\nc\"") == false {
+		fmt.Println("Value with a comma should be quoted")
+		t.Fail()
+	}
+	a, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != 3 || a[1][0] != "key0" || a[2][1] != "a,b\nc" {
+		fmt.Println(a)
+		t.Fail()
+	}
+}
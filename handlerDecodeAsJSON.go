@@ -17,19 +17,27 @@
 package swift
 
 import (
-	"encoding/base64"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // HandlerDecodeAsJSON returns the incoming request as JSON data. The query
-// string contains the data which must be turned into a byte array, decryped and
-// the resulting data turned into JSON.
+// string or the body of a POST request contains the data which must be turned
+// into a byte array, decryped and the resulting data turned into JSON.
 func HandlerDecodeAsJSON(s *Services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
 		err := r.ParseForm()
 		if err != nil {
 			returnAPIError(s, w, err, http.StatusInternalServerError)
@@ -38,9 +46,6 @@ func HandlerDecodeAsJSON(s *Services) http.HandlerFunc {
 
 		// Check caller can access
 		if s.getAccessAllowed(w, r) == false {
-			returnAPIError(s, w,
-				errors.New("Not authorized"),
-				http.StatusUnauthorized)
 			return
 		}
 
@@ -51,45 +56,33 @@ func HandlerDecodeAsJSON(s *Services) http.HandlerFunc {
 			return
 		}
 
-		// Decode the query string to form the byte array.
-		in, err := base64.RawURLEncoding.DecodeString(r.Form.Get("data"))
+		// Get the data from the body or the query string.
+		d, err := getDataFromRequest(r)
 		if err != nil {
 			returnAPIError(s, w, err, http.StatusBadRequest)
 			return
 		}
 
-		// Decrypt the byte array using the node.
-		d, err := n.decrypt(in)
+		// Decode, decrypt and validate the results.
+		a, err := decryptResults(r, s, n, d)
 		if err != nil {
 			returnAPIError(s, w, err, http.StatusBadRequest)
 			return
 		}
-		if d == nil {
-			returnAPIError(
-				s,
-				w,
-				fmt.Errorf("Could not decrypt input"),
-				http.StatusBadRequest)
-			return
-		}
 
-		// Decode the byte array to become a results array.
-		a, err := DecodeResults(d)
-		if err != nil {
-			returnAPIError(s, w, err, http.StatusBadRequest)
+		// Check the access key can be used with the table.
+		if s.getTableAllowed(w, r, a.Table) == false {
 			return
 		}
 
-		// Validate that the timestamp has not expired.
-		if a.IsTimeStampValid() == false {
-			returnAPIError(
-				s,
-				w,
-				fmt.Errorf("Results expired and can no longer be decrypted"),
-				http.StatusBadRequest)
+		// Check the results have not already been used.
+		if s.getNonceAllowed(w, a) == false {
 			return
 		}
 
+		// Remove any values that have expired since the results were created.
+		a.removeExpired(s.now())
+
 		// Turn the array into a JSON string.
 		json, err := json.Marshal(a.Values)
 		if err != nil {
@@ -99,13 +92,118 @@ func HandlerDecodeAsJSON(s *Services) http.HandlerFunc {
 
 		// The output is a json string.
 		b := []byte(json)
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b)))
-		_, err = w.Write(b)
+		w.Header().Set("Cache-Control", s.config.cacheControl("decode-as-json"))
+		err = sendResponse(w, r, b)
 		if err != nil {
 			returnAPIError(s, w, err, http.StatusInternalServerError)
 		}
 	}
 }
+
+// decryptResults turns the base64 data string into a byte array, decrypts it
+// with the access node and decodes the results. An error is returned if any of
+// these steps fail or if the results have expired. The outcome is recorded in
+// the metrics. If table secrets are enabled the keys for the table in the
+// request are used.
+func decryptResults(
+	r *http.Request,
+	s *Services,
+	n *node,
+	data string) (*Results, error) {
+	a, err := decryptResultsData(
+		r.Context(),
+		s,
+		n,
+		data,
+		s.getSecretTable(r.Form.Get(tableParam)))
+	if err != nil {
+		s.logger.Error("Results could not be decoded: %s", err)
+		s.metrics.IncDecodeError()
+	} else {
+		s.metrics.IncDecoded()
+	}
+	return a, err
+}
+
+func decryptResultsData(
+	ctx context.Context,
+	s *Services,
+	n *node,
+	data string,
+	table string) (*Results, error) {
+
+	// Decode the string to form the byte array.
+	in, err := decodeValue(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decrypt the byte array using the node or the other access nodes.
+	t := time.Now()
+	d, err := decryptWithAccessNodes(ctx, s, n, in, table)
+	s.metrics.ObserveDecryptDuration(time.Since(t))
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, fmt.Errorf("Could not decrypt input")
+	}
+
+	// Decode the byte array to become a results array.
+	a, err := DecodeResults(d)
+	if err != nil {
+		return nil, err
+	}
+	a.setClock(s.clock)
+
+	// Validate that the timestamp has not expired.
+	if a.isTimeStampValidAt(s.now(), s.config.clockSkew()) == false {
+		return nil, fmt.Errorf(
+			"Results expired and can no longer be decrypted")
+	}
+
+	// Values from tables that are disabled are not returned.
+	x, err := s.getTableDisabled(ctx, a.Table)
+	if err != nil {
+		return nil, err
+	}
+	if x {
+		a.Values = nil
+	}
+	return a, nil
+}
+
+// decryptWithAccessNodes returns the data decrypted with the access node, or if
+// that fails with the first of the configured DecodeAccessNodes that succeeds.
+// If none succeed then the error from the access node is returned. The keys
+// for the table are used if the table is not empty.
+func decryptWithAccessNodes(
+	ctx context.Context,
+	s *Services,
+	n *node,
+	in []byte,
+	table string) ([]byte, error) {
+	d, err := n.decryptForTable(in, table)
+	if err == nil {
+		return d, nil
+	}
+	for _, v := range s.config.DecodeAccessNodes {
+		if v == n.domain {
+			continue
+		}
+		a, e := s.store.getNode(ctx, v)
+		if e != nil {
+			return nil, e
+		}
+		if a == nil || a.role != roleAccess {
+			s.logger.Warn("Decode access node '%s' is not an access node", v)
+			continue
+		}
+		d, e = a.decryptForTable(in, table)
+		if e == nil {
+			return d, nil
+		}
+	}
+	return nil, err
+}
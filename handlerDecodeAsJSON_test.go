@@ -0,0 +1,725 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeAsJSONGzip(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d, err := testEncryptResults(n, newResultsTest(100))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Get the uncompressed response.
+	p := testDecode(s, newDecodeRequestTest(d))
+	if p.Code != http.StatusOK {
+		fmt.Println(p.Body.String())
+		t.Fail()
+		return
+	}
+	if p.Header().Get("Content-Encoding") != "" {
+		fmt.Println("Plain response should not be encoded")
+		t.Fail()
+	}
+	if p.Header().Get("Content-Length") !=
+		fmt.Sprintf("%d", p.Body.Len()) {
+		fmt.Println("Plain response Content-Length invalid")
+		t.Fail()
+	}
+
+	// Get the compressed response.
+	r := newDecodeRequestTest(d)
+	r.Header.Set("Accept-Encoding", "deflate, gzip;q=1.0")
+	g := testDecode(s, r)
+	if g.Code != http.StatusOK {
+		fmt.Println(g.Body.String())
+		t.Fail()
+		return
+	}
+	if g.Header().Get("Content-Encoding") != "gzip" {
+		fmt.Println("Response should be gzip encoded")
+		t.Fail()
+		return
+	}
+	if g.Header().Get("Content-Length") != "" {
+		fmt.Println("Compressed response should not have a Content-Length")
+		t.Fail()
+	}
+	z, err := gzip.NewReader(g.Body)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b, err := ioutil.ReadAll(z)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if bytes.Compare(b, p.Body.Bytes()) != 0 {
+		fmt.Println(string(b))
+		fmt.Println(p.Body.String())
+		t.Fail()
+	}
+}
+
+func TestDecodeAsJSONGzipRefused(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d, err := testEncryptResults(n, newResultsTest(1))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newDecodeRequestTest(d)
+	r.Header.Set("Accept-Encoding", "gzip;q=0")
+	w := testDecode(s, r)
+	if w.Header().Get("Content-Encoding") != "" {
+		fmt.Println("Response should not be encoded when gzip has q=0")
+		t.Fail()
+	}
+}
+
+func TestDecodeAsJSONTableScope(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.AccessKeyTables = map[string][]string{
+		testAccessKey: {"tenant-*"}}
+	for k, e := range map[string]int{
+		"tenant-a": http.StatusOK,
+		"other":    http.StatusForbidden} {
+		r := newResultsTest(1)
+		r.Table = k
+		d, err := testEncryptResults(n, r)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		w := testDecode(s, newDecodeRequestTest(d))
+		if w.Code != e {
+			fmt.Printf("Table '%s' expected '%d' but got '%d'\n", k, e, w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestDecodeAsJSONExpiredValues(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newResultsTest(2)
+	r.Values[1].Expires = time.Now().UTC().AddDate(0, 0, -1)
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var v []*Result
+	err = json.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(v) != 1 || v[0].Key != "key0" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestDecodeAsJSONTable(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newResultsTest(2)
+	r.Table = "known"
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var v []*Result
+	err = json.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(v) != 2 {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	for _, e := range v {
+		if e.Table != "known" {
+			fmt.Printf("Value '%s' table '%s' should be 'known'\n",
+				e.Key,
+				e.Table)
+			t.Fail()
+		}
+	}
+}
+
+func TestDecodeAsJSONCORSAllowedOrigin(t *testing.T) {
+	s, n, err := newDecodeCORSTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d, err := testEncryptResults(n, newResultsTest(1))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newDecodeRequestTest(d)
+	r.Header.Set("Origin", "https://allowed.com")
+	w := testDecode(s, r)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://allowed.com" {
+		fmt.Printf("Origin '%s' incorrect\n",
+			w.Header().Get("Access-Control-Allow-Origin"))
+		t.Fail()
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		fmt.Println("Credentials should be allowed")
+		t.Fail()
+	}
+}
+
+func TestDecodeAsJSONCORSDisallowedOrigin(t *testing.T) {
+	s, n, err := newDecodeCORSTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d, err := testEncryptResults(n, newResultsTest(1))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newDecodeRequestTest(d)
+	r.Header.Set("Origin", "https://other.com")
+	w := testDecode(s, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		fmt.Println("Origin should not be allowed")
+		t.Fail()
+	}
+}
+
+func TestDecodeAsJSONCORSPreflight(t *testing.T) {
+	s, _, err := newDecodeCORSTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for o, e := range map[string]int{
+		"https://allowed.com": http.StatusNoContent,
+		"https://other.com":   http.StatusForbidden} {
+		r := httptest.NewRequest(
+			"OPTIONS",
+			"https://"+testAccess+"/swift/api/v1/decode-as-json",
+			nil)
+		r.Header.Set("Origin", o)
+		r.Header.Set("Access-Control-Request-Method", "GET")
+		r.Header.Set("Access-Control-Request-Headers", "Authorization")
+		w := testDecode(s, r)
+		if w.Code != e {
+			fmt.Printf("Origin '%s' expected '%d' but got '%d'\n", o, e, w.Code)
+			t.Fail()
+		}
+		if e == http.StatusNoContent &&
+			(w.Header().Get("Access-Control-Allow-Origin") != o ||
+				w.Header().Get("Access-Control-Allow-Methods") == "" ||
+				w.Header().Get("Access-Control-Allow-Headers") !=
+					"Authorization") {
+			fmt.Printf("Preflight headers for '%s' incorrect\n", o)
+			t.Fail()
+		}
+	}
+}
+
+func TestDecodeAsJSONReplay(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Create an operation and get the results it would return.
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	c := testCreate(s, q)
+	if c.Code != http.StatusOK {
+		fmt.Println(c.Body.String())
+		t.Fail()
+		return
+	}
+	o, err := testOperationFromURL(s, c.Body.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if o.nonce == "" {
+		fmt.Println("Operation should have a nonce")
+		t.Fail()
+		return
+	}
+	d, err := testEncryptResults(n, o.newResults())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The first completion succeeds and the second is rejected.
+	for _, e := range []int{http.StatusOK, http.StatusConflict} {
+		w := testDecode(s, newDecodeRequestTest(d))
+		if w.Code != e {
+			fmt.Printf("Expected '%d' but got '%d'\n", e, w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestDecodeAsJSONPostBody(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Create results large enough to exceed common URL length limits.
+	a := newResultsTest(200)
+	for _, v := range a.Values {
+		b, err := randomBytes(64)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		v.Value = fmt.Sprintf("%x", b)
+	}
+	d, err := testEncryptResults(n, a)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(d) < 16384 {
+		fmt.Printf("Data length '%d' should be large\n", len(d))
+		t.Fail()
+		return
+	}
+	g := testDecode(s, newDecodeRequestTest(d))
+	if g.Code != http.StatusOK {
+		fmt.Println(g.Body.String())
+		t.Fail()
+		return
+	}
+
+	// Post the data as the raw body and as a form field.
+	q := url.Values{}
+	q.Set(accessKey, testAccessKey)
+	u := "https://" + testAccess + "/swift/api/v1/decode-as-json?" + q.Encode()
+	f := url.Values{}
+	f.Set("data", d)
+	for c, b := range map[string]string{
+		"text/plain":                        d,
+		"application/x-www-form-urlencoded": f.Encode()} {
+		r := httptest.NewRequest("POST", u, bytes.NewBufferString(b))
+		r.Header.Set("Content-Type", c)
+		p := testDecode(s, r)
+		if p.Code != http.StatusOK {
+			fmt.Printf("Content type '%s' failed '%s'\n", c, p.Body.String())
+			t.Fail()
+			continue
+		}
+		if bytes.Equal(g.Body.Bytes(), p.Body.Bytes()) == false {
+			fmt.Printf("Content type '%s' decoded differently\n", c)
+			t.Fail()
+		}
+	}
+}
+
+// newDecodeCORSTest returns services that allow credentialed requests from a
+// single origin.
+func newDecodeCORSTest() (*Services, *node, error) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.config.AllowedOrigins = []string{"https://allowed.com"}
+	s.config.AllowCredentials = true
+	return s, n, nil
+}
+
+func TestDecodeAsJSONMigrationAccessNodes(t *testing.T) {
+	s, _, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	v := s.store.(*Volatile)
+	o, err := v.testAddNode(testNetwork, "old-access.com", roleAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d, err := testEncryptResults(o, newResultsTest(1))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Without the old access node configured the data can not be decrypted.
+	w := testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+		return
+	}
+
+	// With both access nodes configured the old node's secrets are tried.
+	s.config.DecodeAccessNodes = []string{testAccess, "old-access.com"}
+	w = testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusOK, w.Code)
+		t.Fail()
+		return
+	}
+	var a []*Result
+	err = json.Unmarshal(w.Body.Bytes(), &a)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != 1 || a[0].Value != "value0" {
+		fmt.Printf("Expected 'value0' but got '%s'\n", w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestDecodeAsJSONCacheControl(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.CacheControl = map[string]string{
+		"decode-as-json": "private, max-age=60"}
+	d, err := testEncryptResults(n, newResultsTest(1))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusOK, w.Code)
+		t.Fail()
+		return
+	}
+	testCacheControl(t, w, "private, max-age=60")
+
+	// Handlers that are not configured keep the default.
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	c := testCreate(s, q)
+	if c.Code != http.StatusOK {
+		fmt.Println(c.Body.String())
+		t.Fail()
+		return
+	}
+	testCacheControl(t, c, defaultCacheControl)
+}
+
+func TestDecodeAsJSONTableSecrets(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.TableSecrets = true
+	r := newResultsTest(1)
+	r.Table = "known"
+	b, err := encodeResults(r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err := n.encryptForTable(b, zlib.DefaultCompression, r.Table)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d := base64.RawURLEncoding.EncodeToString(e)
+	for v, c := range map[string]int{
+		"known": http.StatusOK,
+		"other": http.StatusBadRequest,
+		"":      http.StatusBadRequest} {
+		q := newDecodeRequestTest(d)
+		p := q.URL.Query()
+		p.Set(tableParam, v)
+		q.URL.RawQuery = p.Encode()
+		w := testDecode(s, q)
+		if w.Code != c {
+			fmt.Printf("Table '%s' expected '%d' but got '%d'\n",
+				v,
+				c,
+				w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestDecodeAsJSONDeterministic(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Create two operations at the same time from the same parameters.
+	s.SetClock(&clockTest{time.Now().UTC()})
+	q := newCreateValuesTest()
+	for _, k := range []string{"c", "a", "e", "b", "d"} {
+		q.Set(testKey(k), k)
+	}
+	var d []string
+	for i := 0; i < 2; i++ {
+		o, _, err := createURL(s, newCreateRequestTest(q))
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		v, err := testEncryptResults(n, o.newResults())
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		d = append(d, v)
+	}
+
+	// Decode the results of each operation and check the JSON is identical
+	// even though each operation has its own nonce.
+	var b []byte
+	for _, v := range d {
+		w := testDecode(s, newDecodeRequestTest(v))
+		if w.Code != http.StatusOK {
+			fmt.Println(w.Body.String())
+			t.Fail()
+			return
+		}
+		if b != nil && bytes.Equal(b, w.Body.Bytes()) == false {
+			fmt.Println("Decoded JSON should be identical")
+			t.Fail()
+			return
+		}
+		b = w.Body.Bytes()
+	}
+
+	// The results can still only be decoded once.
+	w := testDecode(s, newDecodeRequestTest(d[0]))
+	if w.Code != http.StatusConflict {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusConflict, w.Code)
+		t.Fail()
+	}
+}
+
+func TestDecodeAsJSONRequestTooLarge(t *testing.T) {
+	s, _, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.MaxRequestBytes = 1024
+	for _, c := range []string{
+		"application/x-www-form-urlencoded",
+		"text/plain"} {
+		r := httptest.NewRequest(
+			"POST",
+			"https://"+testAccess+"/swift/api/v1/decode-as-json?"+
+				accessKey+"="+testAccessKey,
+			strings.NewReader("data="+strings.Repeat("a", 2048)))
+		r.Header.Set("Content-Type", c)
+		w := testDecode(s, r)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			fmt.Printf("Content type '%s' expected '%d' but got '%d'\n",
+				c,
+				http.StatusRequestEntityTooLarge,
+				w.Code)
+			t.Fail()
+		}
+	}
+}
+
+// newDecodeTest returns services for a test network and the access node that
+// will be used to encrypt results.
+func newDecodeTest() (*Services, *node, error) {
+	v, err := newVolatileNetworkTest(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := v.getNode(context.Background(), testAccess)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, n, nil
+}
+
+// newResultsTest returns results with the number of values requested that
+// have not yet expired.
+func newResultsTest(count int) *Results {
+	var r Results
+	r.Expires = time.Now().UTC().Add(time.Minute)
+	r.State = "state"
+	for i := 0; i < count; i++ {
+		r.Values = append(r.Values, &Result{
+			fmt.Sprintf("key%d", i),
+			time.Now().UTC(),
+			time.Now().UTC().AddDate(0, 1, 0),
+			fmt.Sprintf("value%d", i),
+			"",
+			conflictNewest,
+			false,
+			nil})
+	}
+	return &r
+}
+
+// testEncryptResults encodes and encrypts the results with the node returning
+// the string that would be provided in the data parameter.
+func testEncryptResults(n *node, r *Results) (string, error) {
+	b, err := encodeResults(r)
+	if err != nil {
+		return "", err
+	}
+	e, err := n.encrypt(b, zlib.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(e), nil
+}
+
+func newDecodeRequestTest(d string) *http.Request {
+	q := url.Values{}
+	q.Set("data", d)
+	q.Set(accessKey, testAccessKey)
+	return httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/decode-as-json?"+q.Encode(),
+		nil)
+}
+
+func testCacheControl(
+	t *testing.T,
+	w *httptest.ResponseRecorder,
+	expected string) {
+	if v := w.Header().Get("Cache-Control"); v != expected {
+		fmt.Printf("Expected '%s' but got '%s'\n", expected, v)
+		t.Fail()
+	}
+}
+
+func testDecode(s *Services, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	HandlerDecodeAsJSON(s)(w, r)
+	return w
+}
@@ -0,0 +1,131 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// KeyValue is the value of a single key returned by the decode key handler.
+type KeyValue struct {
+	Key     string    // The name of the key
+	Value   string    // The value of the key, or empty if not found
+	Expires time.Time // The UTC time that the value will expire
+	Error   string    // The reason the value could not be found, or empty
+}
+
+// HandlerDecodeKey returns the value and expiry time of a single key in the
+// encrypted results as JSON so that the other values are not sent to the
+// browser. The query string or the body of a POST request contains the data
+// returned from the storage operation and the key required. If the key is not
+// present in the results, or has expired, then the status code is not found.
+func HandlerDecodeKey(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the key that the value is needed for.
+		k := r.Form.Get(keyParam)
+		if k == "" {
+			returnAPIError(s, w,
+				errors.New("Missing key"),
+				http.StatusBadRequest)
+			return
+		}
+
+		// Get the node associated with the request.
+		n, err := getAccessNode(s, r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Get the data from the body or the query string.
+		d, err := getDataFromRequest(r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Decode, decrypt and validate the results.
+		a, err := decryptResults(r, s, n, d)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Check the access key can be used with the table.
+		if s.getTableAllowed(w, r, a.Table) == false {
+			return
+		}
+
+		// Check the results have not already been used.
+		if s.getNonceAllowed(w, a) == false {
+			return
+		}
+
+		// Remove any values that have expired since the results were created.
+		a.removeExpired(s.now())
+
+		// Get the value for the key.
+		v := KeyValue{Key: k}
+		c := http.StatusOK
+		e := a.Get(k)
+		if e == nil {
+			v.Error = fmt.Sprintf("Key '%s' not found", k)
+			c = http.StatusNotFound
+		} else {
+			v.Value = e.Value
+			v.Expires = e.Expires
+		}
+
+		// Turn the value into a JSON string.
+		b, err := json.Marshal(&v)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", s.config.cacheControl("decode-key"))
+		err = sendResponseWithStatus(w, r, b, c)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDecodeKeyPresent(t *testing.T) {
+	r := newResultsTest(3)
+	v, w := testDecodeKey(t, r, "key1")
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	if v.Key != "key1" || v.Value != "value1" || v.Error != "" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+
+	// Only the date of expiry is encoded in the results.
+	e := r.Values[1].Expires.Format("2006-01-02")
+	if v.Expires.Format("2006-01-02") != e {
+		fmt.Printf("Expires '%s' should be '%s'\n", v.Expires, e)
+		t.Fail()
+	}
+
+	// The other values must not be returned.
+	var m map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &m)
+	if err != nil || len(m) != 4 {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestDecodeKeyAbsent(t *testing.T) {
+	v, w := testDecodeKey(t, newResultsTest(1), "missing")
+	if w.Code != http.StatusNotFound {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusNotFound, w.Code)
+		t.Fail()
+	}
+	if v.Key != "missing" || v.Value != "" || v.Error == "" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+// testDecodeKey encrypts the results and requests the value of the key
+// returning the response and the decoded JSON.
+func testDecodeKey(
+	t *testing.T,
+	r *Results,
+	k string) (*KeyValue, *httptest.ResponseRecorder) {
+	var a KeyValue
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	q := url.Values{}
+	q.Set("data", d)
+	q.Set(keyParam, k)
+	q.Set(accessKey, testAccessKey)
+	w := httptest.NewRecorder()
+	HandlerDecodeKey(s)(w, httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/decode-key?"+q.Encode(),
+		nil))
+	err = json.Unmarshal(w.Body.Bytes(), &a)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	return &a, w
+}
@@ -0,0 +1,111 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// KeyExpiry is the name and expiry time of a key returned by the decode keys
+// handler without the value.
+type KeyExpiry struct {
+	Key     string    // The name of the key
+	Expires time.Time // The UTC time that the value will expire
+}
+
+// HandlerDecodeKeys returns the names and expiry times of the keys in the
+// encrypted results as JSON. The values are never returned so that sensitive
+// data is not exposed to the browser. Keys that have expired are not included.
+// The query string or the body of a POST request contains the data returned
+// from the storage operation. The results can only be used once.
+func HandlerDecodeKeys(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the node associated with the request.
+		n, err := getAccessNode(s, r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Get the data from the body or the query string.
+		d, err := getDataFromRequest(r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Decode, decrypt and validate the results.
+		a, err := decryptResults(r, s, n, d)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Check the access key can be used with the table.
+		if s.getTableAllowed(w, r, a.Table) == false {
+			return
+		}
+
+		// Check the results have not already been used.
+		if s.getNonceAllowed(w, a) == false {
+			return
+		}
+
+		// Remove any values that have expired since the results were created.
+		a.removeExpired(s.now())
+
+		// Turn the keys and expiry times into a JSON string.
+		k := make([]*KeyExpiry, 0, len(a.Values))
+		for _, v := range a.Values {
+			k = append(k, &KeyExpiry{v.Key, v.Expires})
+		}
+		b, err := json.Marshal(k)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", s.config.cacheControl("decode-keys"))
+		err = sendResponse(w, r, b)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newResultsTest(3)
+	r.Values[1].Expires = time.Now().UTC().AddDate(0, 0, -1)
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := url.Values{}
+	q.Set("data", d)
+	q.Set(accessKey, testAccessKey)
+	w := httptest.NewRecorder()
+	HandlerDecodeKeys(s)(w, httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/decode-keys?"+q.Encode(),
+		nil))
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var k []*KeyExpiry
+	err = json.Unmarshal(w.Body.Bytes(), &k)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The expired key is excluded.
+	if len(k) != 2 || k[0].Key != "key0" || k[1].Key != "key2" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+
+	// None of the values are returned.
+	for _, v := range r.Values {
+		if bytes.Contains(w.Body.Bytes(), []byte(v.Value)) {
+			fmt.Printf("Value '%s' should not be returned\n", v.Value)
+			t.Fail()
+		}
+	}
+}
+
+// TestDecodeKeysReplay checks that the handlers that return the keys without
+// the values can not be used to read the results more than once.
+func TestDecodeKeysReplay(t *testing.T) {
+	for p, h := range map[string]func(*Services) http.HandlerFunc{
+		"decode-keys": HandlerDecodeKeys,
+		"has-keys":    HandlerHasKeys,
+		"key-ttl":     HandlerKeyTTL} {
+		s, n, err := newDecodeTest()
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		r := newResultsTest(1)
+		r.nonce = "replay"
+		d, err := testEncryptResults(n, r)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		q := url.Values{}
+		q.Set("data", d)
+		q.Set(keyParam, "key0")
+		q.Set(accessKey, testAccessKey)
+		for _, e := range []int{http.StatusOK, http.StatusConflict} {
+			w := httptest.NewRecorder()
+			h(s)(w, httptest.NewRequest(
+				"GET",
+				"https://"+testAccess+"/swift/api/v1/"+p+"?"+q.Encode(),
+				nil))
+			if w.Code != e {
+				fmt.Printf("Handler '%s' expected '%d' but got '%d'\n",
+					p,
+					e,
+					w.Code)
+				t.Fail()
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// DecodedResults is the outcome of decoding one of the data strings provided
+// to the decode many handler.
+type DecodedResults struct {
+	Values []*Result // The values if the data was decoded, otherwise nil
+	Error  string    // The reason the data could not be decoded, or empty
+}
+
+// HandlerDecodeManyAsJSON returns the results for many storage operations as
+// a JSON array. The request body contains a JSON array of the data strings that
+// would otherwise be provided individually to the decode as JSON handler. The
+// response contains an entry for each of the data strings in the same order.
+// If a data string can not be decoded then the entry contains the error rather
+// than the values.
+func HandlerDecodeManyAsJSON(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the node associated with the request.
+		n, err := getAccessNode(s, r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Get the array of data strings from the request body.
+		in, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+		var d []string
+		err = json.Unmarshal(in, &d)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Decode each of the data strings recording any errors. Results from
+		// tables the access key can not be used with are not returned.
+		k := getAccessKey(r)
+		o := make([]*DecodedResults, len(d))
+		for i, v := range d {
+			var e DecodedResults
+			a, err := decryptResults(r, s, n, v)
+			if err != nil {
+				e.Error = err.Error()
+			} else if s.config.getTableAllowed(k, a.Table) == false {
+				e.Error = fmt.Sprintf("Access denied to table '%s'", a.Table)
+			} else if err = s.useNonce(a); err != nil {
+				e.Error = err.Error()
+			} else {
+				a.removeExpired(s.now())
+				e.Values = a.Values
+			}
+			o[i] = &e
+		}
+
+		// Turn the array into a JSON string.
+		b, err := json.Marshal(o)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", s.config.cacheControl("decode-many-as-json"))
+		err = sendResponse(w, r, b)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecodeManyAsJSONPartial(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d, err := testEncryptResults(n, newResultsTest(2))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	in, err := json.Marshal([]string{d, "corrupt" + d})
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := httptest.NewRequest(
+		"POST",
+		"https://"+testAccess+"/swift/api/v1/decode-many-as-json?"+
+			accessKey+"="+testAccessKey,
+		bytes.NewReader(in))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	HandlerDecodeManyAsJSON(s)(w, r)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var o []*DecodedResults
+	err = json.Unmarshal(w.Body.Bytes(), &o)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(o) != 2 {
+		fmt.Printf("Expected 2 results but got %d\n", len(o))
+		t.Fail()
+		return
+	}
+	if o[0].Error != "" || len(o[0].Values) != 2 {
+		fmt.Printf("First result error '%s'\n", o[0].Error)
+		t.Fail()
+	}
+	if o[0].Values[0].Key != "key0" || o[0].Values[1].Value != "value1" {
+		fmt.Println("First result values incorrect")
+		t.Fail()
+	}
+	if o[1].Error == "" || o[1].Values != nil {
+		fmt.Println("Second result should contain an error")
+		t.Fail()
+	}
+}
+
+func TestDecodeManyAsJSONInvalidBody(t *testing.T) {
+	s, _, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := httptest.NewRequest(
+		"POST",
+		"https://"+testAccess+"/swift/api/v1/decode-many-as-json?"+
+			accessKey+"="+testAccessKey,
+		bytes.NewReader([]byte("not json")))
+	w := httptest.NewRecorder()
+	HandlerDecodeManyAsJSON(s)(w, r)
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
@@ -17,8 +17,6 @@
 package swift
 
 import (
-	"encoding/base64"
-	"errors"
 	"fmt"
 	"net/http"
 )
@@ -29,11 +27,16 @@ import (
 func HandlerDecrypt(s *Services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
 		// Check caller can access
 		if s.getAccessAllowed(w, r) == false {
-			returnAPIError(s, w,
-				errors.New("Not authorized"),
-				http.StatusUnauthorized)
 			return
 		}
 
@@ -51,14 +54,19 @@ func HandlerDecrypt(s *Services) http.HandlerFunc {
 		}
 
 		// Decode the query string to form the byte array.
-		in, err := base64.RawURLEncoding.DecodeString(r.Form.Get("data"))
+		in, err := decodeValue(r.Form.Get("data"))
 		if err != nil {
 			returnAPIError(s, w, err, http.StatusBadRequest)
 			return
 		}
 
-		// Decrypt the byte array using the node.
-		d, err := n.decrypt(in)
+		// Decrypt the byte array using the node or the other access nodes.
+		d, err := decryptWithAccessNodes(
+			r.Context(),
+			s,
+			n,
+			in,
+			s.getSecretTable(r.Form.Get(tableParam)))
 		if err != nil {
 			returnAPIError(s, w, err, http.StatusBadRequest)
 			return
@@ -73,9 +81,8 @@ func HandlerDecrypt(s *Services) http.HandlerFunc {
 		}
 
 		// The output as a byte array.
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Cache-Control", s.config.cacheControl("decrypt"))
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(d)))
 		_, err = w.Write(d)
 		if err != nil {
@@ -0,0 +1,122 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The number of days a tombstone for a deleted value is retained. Browsers
+// limit the lifetime of cookies to 400 days.
+const deleteExpiryDays = 400
+
+// HandlerDelete takes a Services pointer and returns a HTTP handler used by an
+// Access Node to obtain the initial URL for a storage operation that deletes
+// the values for the keys provided in the key parameter from the table.
+// The values are replaced with tombstones that win over any value created
+// before the delete and are excluded from the results.
+func HandlerDelete(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Check the access key can be used with the table.
+		if s.getTableAllowed(w, r, r.FormValue(tableParam)) == false {
+			return
+		}
+
+		// Check the caller has not exceeded the rate limit.
+		if s.getRateAllowed(w, r) == false {
+			return
+		}
+
+		u, err := deleteURL(s, r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+		b := []byte(u)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", s.config.cacheControl("delete"))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b)))
+		_, err = w.Write(b)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func deleteURL(s *Services, r *http.Request) (string, error) {
+	o, err := createOperation(s, r)
+	if err != nil {
+		return "", err
+	}
+	k := r.Form[keyParam]
+	if len(k) == 0 {
+		return "", fmt.Errorf("Missing key to delete")
+	}
+	if len(k) > s.config.maxPairs() {
+		return "", fmt.Errorf(
+			"'%d' keys to delete exceeds the maximum of '%d'",
+			len(k),
+			s.config.maxPairs())
+	}
+	for _, i := range k {
+		if i == "" {
+			return "", fmt.Errorf("Key to delete must not be empty")
+		}
+		i, err = normalizeKey(i, &s.config)
+		if err != nil {
+			return "", err
+		}
+		o.values = append(o.values, newDeletePair(i, s.now()))
+	}
+	u, err := o.getFirstURL(r)
+	if err != nil {
+		return "", err
+	}
+	err = s.addTable(r.Context(), o.table)
+	if err != nil {
+		return "", err
+	}
+	return u, nil
+}
+
+// newDeletePair returns a tombstone pair for the key created at the time
+// provided.
+func newDeletePair(k string, t time.Time) *pair {
+	var p pair
+	p.key = k
+	p.conflict = conflictDelete
+	p.created = t
+	p.expires = p.created.AddDate(0, 0, deleteExpiryDays)
+	return &p
+}
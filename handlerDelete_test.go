@@ -0,0 +1,294 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDeleteCreatesTombstone(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Add(keyParam, "a")
+	q.Add(keyParam, "b")
+	r := newCreateRequestTest(q)
+	w := httptest.NewRecorder()
+	HandlerDelete(s)(w, r)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	o, err := testOperationFromURL(s, w.Body.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(o.values) != 2 {
+		fmt.Printf("Expected 2 values but got %d\n", len(o.values))
+		t.Fail()
+		return
+	}
+	for _, p := range o.values {
+		if p.isDeleted() == false || p.value != "" {
+			fmt.Printf("Pair '%s' should be a tombstone\n", p.key)
+			t.Fail()
+		}
+	}
+}
+
+func TestDeleteMissingKey(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := httptest.NewRecorder()
+	HandlerDelete(s)(w, newCreateRequestTest(newCreateValuesTest()))
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
+
+func TestDeleteTableScope(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.AccessKeyTables = map[string][]string{testAccessKey: {"allowed"}}
+	for k, e := range map[string]int{
+		"allowed": http.StatusOK,
+		"denied":  http.StatusForbidden} {
+		q := newCreateValuesTest()
+		q.Set(tableParam, k)
+		q.Add(keyParam, "a")
+		w := httptest.NewRecorder()
+		HandlerDelete(s)(w, newCreateRequestTest(q))
+		if w.Code != e {
+			fmt.Printf("Table '%s' expected '%d' but got '%d'\n", k, e, w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestDeleteRateLimit(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n := time.Now()
+	b := newTokenBucket(1, 1)
+	b.now = func() time.Time { return n }
+	s.SetRateLimiter(b)
+	q := newCreateValuesTest()
+	q.Add(keyParam, "a")
+	for _, e := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		HandlerDelete(s)(w, newCreateRequestTest(q))
+		if w.Code != e {
+			fmt.Printf("Expected '%d' but got '%d'\n", e, w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestDeleteKeys(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.NormalizeUnicode = true
+
+	// Too many keys or keys that are not UTF-8 are rejected.
+	q := newCreateValuesTest()
+	for i := 0; i <= s.config.maxPairs(); i++ {
+		q.Add(keyParam, fmt.Sprint(i))
+	}
+	i := newCreateValuesTest()
+	i.Add(keyParam, "a\xff")
+	for _, v := range []url.Values{q, i} {
+		w := httptest.NewRecorder()
+		HandlerDelete(s)(w, newCreateRequestTest(v))
+		if w.Code != http.StatusBadRequest {
+			fmt.Printf("Expected '%d' but got '%d'\n",
+				http.StatusBadRequest,
+				w.Code)
+			t.Fail()
+		}
+	}
+
+	// Keys are normalized in the same way as when values are created.
+	q = newCreateValuesTest()
+	q.Add(keyParam, "cafe\u0301")
+	w := httptest.NewRecorder()
+	HandlerDelete(s)(w, newCreateRequestTest(q))
+	o, err := testOperationFromURL(s, w.Body.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(o.values) != 1 || o.values[0].key != "caf\u00e9" {
+		fmt.Println("Key to delete should be normalized")
+		t.Fail()
+	}
+}
+
+func TestDeleteRemovesFromResults(t *testing.T) {
+	s, a, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n, err := s.store.getNode(context.Background(), "storage-1.com")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Store the existing values for the keys in cookies.
+	e := newOperation(s, n)
+	e.table = "table"
+	e.values = []*pair{
+		testPair("a", "deleted", conflictOldest, -time.Hour),
+		testPair("b", "kept", conflictNewest, -time.Hour)}
+	c := testCookies(t, e)
+
+	// Process a delete operation for the first key against the cookies.
+	o := newOperation(s, n)
+	o.table = "table"
+	o.values = []*pair{
+		newDeletePair("a", time.Now().UTC()),
+		testPair("b", "kept", conflictNewest, -time.Hour)}
+	r := httptest.NewRequest("GET", "https://storage-1.com/", nil)
+	for _, i := range c {
+		r.AddCookie(i)
+	}
+	err = o.processCookies(httptest.NewRecorder(), r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if o.values[0].isDeleted() == false {
+		fmt.Println("Tombstone should win over the existing value")
+		t.Fail()
+	}
+
+	// Decode the results and confirm the deleted key is not present.
+	d, err := testEncryptResults(a, o.newResults())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var v []*Result
+	err = json.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(v) != 1 || v[0].Key != "b" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestDeleteReplacedByNewerValue(t *testing.T) {
+	d := newDeletePair("a", time.Now().UTC())
+	d.created = time.Now().UTC().Add(-time.Hour)
+	p := testPair("a", "new", conflictOldest, 0)
+	r, err := resolveConflict(p, d, time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if r != p {
+		fmt.Println("Value created after the tombstone should win")
+		t.Fail()
+	}
+	r, err = resolveConflict(
+		d,
+		testPair("a", "old", conflictNewest, -2*time.Hour),
+		time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if r != d {
+		fmt.Println("Tombstone should win over an older value")
+		t.Fail()
+	}
+}
+
+// testPair returns a pair created the offset from now which expires in a
+// month.
+func testPair(k string, v string, c byte, offset time.Duration) *pair {
+	var p pair
+	p.key = k
+	p.value = v
+	p.conflict = c
+	p.created = time.Now().UTC().Add(offset)
+	p.expires = time.Now().UTC().AddDate(0, 1, 0)
+	return &p
+}
+
+// testCookies returns the cookies the operation's node would write for the
+// operation's values.
+func testCookies(t *testing.T, o *operation) []*http.Cookie {
+	w := httptest.NewRecorder()
+	for _, p := range o.values {
+		err := o.setValueInCookie(w, httptest.NewRequest("GET", "/", nil), p)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+		}
+	}
+	return w.Result().Cookies()
+}
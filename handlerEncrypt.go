@@ -28,6 +28,14 @@ import (
 func HandlerEncrypt(s *Services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
 		err := r.ParseForm()
 		if err != nil {
 			returnAPIError(s, w, err, http.StatusInternalServerError)
@@ -48,17 +56,19 @@ func HandlerEncrypt(s *Services) http.HandlerFunc {
 			return
 		}
 
-		// Encrypt the byte array using the node.
-		out, err := n.encrypt(in)
+		// Encrypt the byte array using the node and the keys for the table.
+		out, err := n.encryptForTable(
+			in,
+			s.config.compressionLevel(),
+			s.getSecretTable(r.Form.Get(tableParam)))
 		if err != nil {
 			returnAPIError(s, w, err, http.StatusBadRequest)
 			return
 		}
 
 		// The output is a binary array.
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Cache-Control", s.config.cacheControl("encrypt"))
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(out)))
 
 		// Write the encrypted byte array to the output stream.
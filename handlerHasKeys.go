@@ -0,0 +1,121 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// HandlerHasKeys returns a JSON object with a boolean for each of the keys
+// requested that is true if the encrypted results contain a value for the key
+// that has not expired. The values are never returned so that sensitive data
+// is not exposed just to test if it is present. The keys are provided in one or
+// more key parameters separated by commas. The query string or the body of a
+// POST request contains the data returned from the storage operation. The
+// results can only be used once.
+func HandlerHasKeys(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the keys that are needed.
+		var k []string
+		for _, v := range r.Form[keyParam] {
+			for _, i := range strings.Split(v, ",") {
+				if i = strings.TrimSpace(i); i != "" {
+					k = append(k, i)
+				}
+			}
+		}
+		if len(k) == 0 {
+			returnAPIError(s, w,
+				errors.New("Missing key"),
+				http.StatusBadRequest)
+			return
+		}
+
+		// Get the node associated with the request.
+		n, err := getAccessNode(s, r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Get the data from the body or the query string.
+		d, err := getDataFromRequest(r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Decode, decrypt and validate the results.
+		a, err := decryptResults(r, s, n, d)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Check the access key can be used with the table.
+		if s.getTableAllowed(w, r, a.Table) == false {
+			return
+		}
+
+		// Check the results have not already been used.
+		if s.getNonceAllowed(w, a) == false {
+			return
+		}
+
+		// Turn the presence of each key into a JSON string.
+		h := make(map[string]bool, len(k))
+		t := s.now()
+		for _, i := range k {
+			h[i] = a.hasAt(i, t)
+		}
+		b, err := json.Marshal(h)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", s.config.cacheControl("has-keys"))
+		err = sendResponse(w, r, b)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHasKeys(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newResultsTest(2)
+	r.Values[1].Expires = time.Now().UTC().AddDate(0, 0, -1)
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testHasKeys(s, d, "key0,key1", "missing")
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var h map[string]bool
+	err = json.Unmarshal(w.Body.Bytes(), &h)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Only the present key that has not expired is true.
+	if len(h) != 3 || h["key0"] == false || h["key1"] || h["missing"] {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+
+	// None of the values are returned.
+	for _, v := range r.Values {
+		if bytes.Contains(w.Body.Bytes(), []byte(v.Value)) {
+			fmt.Printf("Value '%s' should not be returned\n", v.Value)
+			t.Fail()
+		}
+	}
+}
+
+func TestHasKeysMissingKey(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d, err := testEncryptResults(n, newResultsTest(1))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testHasKeys(s, d)
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
+
+func testHasKeys(
+	s *Services,
+	d string,
+	keys ...string) *httptest.ResponseRecorder {
+	q := url.Values{}
+	q.Set("data", d)
+	q.Set(accessKey, testAccessKey)
+	for _, k := range keys {
+		q.Add(keyParam, k)
+	}
+	w := httptest.NewRecorder()
+	HandlerHasKeys(s)(w, httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/has-keys?"+q.Encode(),
+		nil))
+	return w
+}
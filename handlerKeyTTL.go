@@ -0,0 +1,126 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// KeyTTL is the remaining time to live of a single key returned by the key TTL
+// handler.
+type KeyTTL struct {
+	Key     string    // The name of the key
+	Expires time.Time // The UTC time that the value will expire
+	Seconds int64     // Seconds until the value expires, or zero if expired
+	Error   string    // The reason the TTL could not be found, or empty
+}
+
+// HandlerKeyTTL returns the expiry time and the seconds remaining for the key
+// in the encrypted results as JSON. The query string contains the data
+// returned from the storage operation for the table and the key required. If
+// the key is not present in the results then the status code is not found. The
+// results can only be used once.
+func HandlerKeyTTL(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the key that the TTL is needed for.
+		k := r.Form.Get(keyParam)
+		if k == "" {
+			returnAPIError(s, w,
+				errors.New("Missing key"),
+				http.StatusBadRequest)
+			return
+		}
+
+		// Get the node associated with the request.
+		n, err := getAccessNode(s, r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Decode, decrypt and validate the results from the query string.
+		a, err := decryptResults(r, s, n, r.Form.Get("data"))
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Check the access key can be used with the table.
+		if s.getTableAllowed(w, r, a.Table) == false {
+			return
+		}
+
+		// Check the results have not already been used.
+		if s.getNonceAllowed(w, a) == false {
+			return
+		}
+
+		// Get the TTL for the key. Keys that have already expired report zero
+		// seconds remaining.
+		t := KeyTTL{Key: k}
+		c := http.StatusOK
+		v := a.Get(k)
+		if v == nil {
+			t.Error = fmt.Sprintf("Key '%s' not found", k)
+			c = http.StatusNotFound
+		} else {
+			t.Expires = v.Expires
+			d := v.Expires.Sub(s.now())
+			if d > 0 {
+				t.Seconds = int64(d / time.Second)
+			}
+		}
+
+		// Turn the TTL into a JSON string.
+		b, err := json.Marshal(&t)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", s.config.cacheControl("key-ttl"))
+		err = sendResponseWithStatus(w, r, b, c)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
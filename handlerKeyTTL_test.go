@@ -0,0 +1,110 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestKeyTTLLive(t *testing.T) {
+	r := newResultsTest(2)
+	k, w := testKeyTTL(t, r, "key1")
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+
+	// Only the date of expiry is encoded in the results.
+	e := r.Values[1].Expires.Format("2006-01-02")
+	if k.Expires.Format("2006-01-02") != e {
+		fmt.Printf("Expires '%s' should be '%s'\n", k.Expires, e)
+		t.Fail()
+	}
+	if k.Seconds <= 0 ||
+		k.Seconds > int64(time.Until(r.Values[1].Expires)/time.Second) {
+		fmt.Printf("Seconds '%d' incorrect\n", k.Seconds)
+		t.Fail()
+	}
+}
+
+func TestKeyTTLExpired(t *testing.T) {
+	r := newResultsTest(1)
+	r.Values[0].Expires = time.Now().UTC().AddDate(0, 0, -1)
+	k, w := testKeyTTL(t, r, "key0")
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	if k.Seconds != 0 {
+		fmt.Printf("Seconds '%d' should be zero for an expired key\n", k.Seconds)
+		t.Fail()
+	}
+}
+
+func TestKeyTTLMissing(t *testing.T) {
+	k, w := testKeyTTL(t, newResultsTest(1), "missing")
+	if w.Code != http.StatusNotFound {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusNotFound, w.Code)
+		t.Fail()
+	}
+	if k.Key != "missing" || k.Error == "" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+// testKeyTTL encrypts the results and requests the TTL of the key returning
+// the response and the decoded JSON.
+func testKeyTTL(
+	t *testing.T,
+	r *Results,
+	k string) (*KeyTTL, *httptest.ResponseRecorder) {
+	var a KeyTTL
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	q := url.Values{}
+	q.Set("data", d)
+	q.Set(keyParam, k)
+	q.Set(accessKey, testAccessKey)
+	w := httptest.NewRecorder()
+	HandlerKeyTTL(s)(w, httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/key-ttl?"+q.Encode(),
+		nil))
+	err = json.Unmarshal(w.Body.Bytes(), &a)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	return &a, w
+}
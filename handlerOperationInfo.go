@@ -0,0 +1,133 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The parameter containing the URL of the storage operation to inspect.
+const operationURLParam = "url"
+
+// OperationInfo is the progress of a storage operation returned by the
+// operation info handler. The values being stored are never included.
+type OperationInfo struct {
+	NodeCount    byte      `json:"nodeCount"`    // Nodes the operation visits
+	NodesVisited byte      `json:"nodesVisited"` // Nodes visited before the URL
+	Remaining    int       `json:"remaining"`    // Nodes still to be visited
+	NextNode     string    `json:"nextNode"`     // Domain the URL navigates to
+	HomeNode     string    `json:"homeNode"`     // Domain of the home node
+	Deadline     time.Time `json:"deadline"`     // When it must complete by
+}
+
+// HandlerOperationInfo returns the progress of the storage operation at the
+// URL provided in the url parameter as JSON. Used to debug operations that do
+// not complete. Only operations created by the access node can be inspected.
+func HandlerOperationInfo(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the node associated with the request.
+		a, err := getAccessNode(s, r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Decrypt the operation with the node the URL navigates to.
+		o, err := getOperationFromURL(s, r, r.FormValue(operationURLParam))
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+		if o.accessNode != a.domain {
+			returnAPIError(s, w,
+				fmt.Errorf("Operation not created by '%s'", a.domain),
+				http.StatusForbidden)
+			return
+		}
+
+		// Turn the progress of the operation into a JSON string.
+		i := OperationInfo{
+			o.nodeCount,
+			o.nodesVisited,
+			int(o.nodeCount) - int(o.nodesVisited),
+			o.thisNode.domain,
+			o.homeNode,
+			o.deadline}
+		if i.Remaining < 0 {
+			i.Remaining = 0
+		}
+		b, err := json.Marshal(&i)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", s.config.cacheControl("operation-info"))
+		err = sendResponse(w, r, b)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// getOperationFromURL returns the operation in the storage operation URL
+// decrypted with the node for the URL's host.
+func getOperationFromURL(
+	s *Services,
+	r *http.Request,
+	v string) (*operation, error) {
+	if v == "" {
+		return nil, fmt.Errorf("Missing operation URL")
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.store.getNode(r.Context(), u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, fmt.Errorf("Host '%s': %w", u.Host, ErrNotSwiftNode)
+	}
+	return newOperationFromPath(s, n, u.Path)
+}
@@ -0,0 +1,118 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOperationInfoCreated(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "secret-value")
+	q.Set(bounces, "3")
+	o, u, err := createURL(s, testOperationInfoParsed(newCreateRequestTest(q)))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testOperationInfo(s, testAccessKey, u)
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected '%d' but got '%d': %s\n",
+			http.StatusOK,
+			w.Code,
+			w.Body.String())
+		t.Fail()
+		return
+	}
+	if strings.Contains(w.Body.String(), "secret-value") {
+		fmt.Println("Values must not be returned")
+		t.Fail()
+	}
+	var i OperationInfo
+	err = json.Unmarshal(w.Body.Bytes(), &i)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if i.NodeCount != 3 ||
+		i.NodeCount != o.nodeCount ||
+		i.Remaining != int(o.nodeCount) ||
+		i.HomeNode != o.homeNode ||
+		i.NextNode != o.homeNode {
+		fmt.Printf("Info '%v' does not match operation\n", i)
+		t.Fail()
+	}
+}
+
+func TestOperationInfoNotAuthorized(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	_, u, err := createURL(s, testOperationInfoParsed(newCreateRequestTest(q)))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testOperationInfo(s, "wrong", u)
+	if w.Code == http.StatusOK {
+		fmt.Println("Invalid access key should be rejected")
+		t.Fail()
+	}
+}
+
+// testOperationInfoParsed returns the request after parsing the form.
+func testOperationInfoParsed(r *http.Request) *http.Request {
+	r.ParseForm()
+	return r
+}
+
+// testOperationInfo returns the response from the operation info handler for
+// the operation URL u using the access key k.
+func testOperationInfo(
+	s *Services,
+	k string,
+	u string) *httptest.ResponseRecorder {
+	q := url.Values{}
+	q.Set(accessKey, k)
+	q.Set(operationURLParam, u)
+	w := httptest.NewRecorder()
+	HandlerOperationInfo(s)(w, httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/operation-info?"+q.Encode(),
+		nil))
+	return w
+}
@@ -0,0 +1,101 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+)
+
+// HandlerRefresh takes a Services pointer and returns a HTTP handler used to
+// re-encrypt data provided in the data parameter under the current secret of
+// the access node. Data encrypted with any secret the access node, or the
+// configured DecodeAccessNodes, can still decrypt is accepted. The decrypted
+// data is not altered so the expiry of the results is unchanged. Used after
+// the secrets are rotated to keep data readable once the older secrets are
+// removed. The refreshed data is returned in URL safe base 64.
+func HandlerRefresh(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Get the node associated with the request.
+		n, err := getAccessNode(s, r)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Decode the query string to form the byte array.
+		in, err := decodeValue(r.Form.Get("data"))
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Decrypt the byte array with whichever secret works.
+		t := s.getSecretTable(r.Form.Get(tableParam))
+		d, err := decryptWithAccessNodes(r.Context(), s, n, in, t)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+		if d == nil {
+			returnAPIError(
+				s,
+				w,
+				fmt.Errorf("Could not decrypt input"),
+				http.StatusBadRequest)
+			return
+		}
+
+		// Encrypt the same byte array with the current secret.
+		out, err := n.encryptForTable(d, s.config.compressionLevel(), t)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// The output is the refreshed data as a URL safe string.
+		b := []byte(base64.RawURLEncoding.EncodeToString(out))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", s.config.cacheControl("refresh"))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b)))
+		_, err = w.Write(b)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRefreshAfterRotation(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newResultsTest(2)
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Rotate the secret retaining the old one so the data can be refreshed.
+	for _, x := range n.secrets {
+		x.timeStamp = x.timeStamp.Add(-time.Hour)
+	}
+	x, err := newSecret(time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n.rotateSecret(x, time.Hour)
+	w := testRefresh(s, d)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	f := w.Body.String()
+	if f == d {
+		fmt.Println("Refreshed data should differ")
+		t.Fail()
+		return
+	}
+
+	// Prune the old secret. Only the refreshed data can now be decoded.
+	n.secrets = []*secret{x}
+	if w = testDecode(s, newDecodeRequestTest(d)); w.Code == http.StatusOK {
+		fmt.Println("Data under the pruned secret should not decode")
+		t.Fail()
+		return
+	}
+	w = testDecode(s, newDecodeRequestTest(f))
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	a, err := decryptResultsData(context.Background(), s, n, f, "")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if a.Expires.Unix() != r.Expires.Unix() || len(a.Values) != 2 {
+		fmt.Println("Refreshed results should be unchanged")
+		t.Fail()
+	}
+}
+
+func TestRefreshInvalid(t *testing.T) {
+	s, _, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testRefresh(s, "AAAA")
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
+
+func testRefresh(s *Services, d string) *httptest.ResponseRecorder {
+	q := url.Values{}
+	q.Set("data", d)
+	q.Set(accessKey, testAccessKey)
+	r := httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/refresh?"+q.Encode(),
+		nil)
+	w := httptest.NewRecorder()
+	HandlerRefresh(s)(w, r)
+	return w
+}
@@ -17,6 +17,7 @@
 package swift
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -29,15 +30,18 @@ import (
 func HandlerRegister(s *Services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
 		var d Register
 		d.Services = s
 		d.Domain = r.Host
 		d.Network = ""
-		d.Expires = time.Now().UTC().AddDate(0, 3, 0)
+		d.Expires = s.now().AddDate(0, 3, 0)
 		d.Role = roleStorage
 
 		// Check that the domain has not already been registered.
-		n, err := s.store.getNode(r.Host)
+		n, err := s.store.getNode(r.Context(), r.Host)
 		if err != nil {
 			returnServerError(s, w, err)
 			return
@@ -67,8 +71,8 @@ func HandlerRegister(s *Services) http.HandlerFunc {
 			d.Role, err = strconv.Atoi(r.FormValue("role"))
 			if err != nil {
 				d.RoleError = err.Error()
-			} else if d.Role != roleAccess && d.Role != roleStorage {
-				d.RoleError = fmt.Sprintf("Role '%d' invalid", d.Role)
+			} else if isValidRole(d.Role) == false {
+				d.RoleError = fmt.Sprintf(roleInvalidMessage, d.Role)
 			}
 		}
 
@@ -77,7 +81,7 @@ func HandlerRegister(s *Services) http.HandlerFunc {
 			d.Expires, err = time.Parse("2006-01-02", r.FormValue("expires"))
 			if err != nil {
 				d.ExpiresError = err.Error()
-			} else if d.Expires.Before(time.Now().UTC()) {
+			} else if d.Expires.Before(s.now()) {
 				d.ExpiresError = "Expiry date must be in the future"
 			}
 		}
@@ -86,12 +90,12 @@ func HandlerRegister(s *Services) http.HandlerFunc {
 		if d.ExpiresError == "" &&
 			d.RoleError == "" &&
 			d.NetworkError == "" {
-			storeNode(s, &d)
+			storeNode(r.Context(), s, &d)
 		}
 
 		// Return the HTML page.
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Cache-Control", s.config.cacheControl("register"))
 		err = registerTemplate.Execute(w, &d)
 		if err != nil {
 			returnServerError(s, w, err)
@@ -99,10 +103,10 @@ func HandlerRegister(s *Services) http.HandlerFunc {
 	}
 }
 
-func storeNode(s *Services, d *Register) {
+func storeNode(ctx context.Context, s *Services, d *Register) {
 
 	// Create a new scrambler for this new node.
-	scrambler, err := newSecret()
+	scrambler, err := newSecret(s.now())
 	if err != nil {
 		d.Error = err.Error()
 		return
@@ -112,7 +116,7 @@ func storeNode(s *Services, d *Register) {
 	n, err := newNode(
 		d.Network,
 		d.Domain,
-		time.Now().UTC(),
+		s.now(),
 		d.Expires,
 		d.Role,
 		scrambler.key)
@@ -122,7 +126,7 @@ func storeNode(s *Services, d *Register) {
 	}
 
 	// Add the first secret to the node.
-	x, err := newSecret()
+	x, err := newSecretWithAEAD(s.config.aead(), s.now())
 	if err != nil {
 		d.Error = err.Error()
 		return
@@ -131,7 +135,7 @@ func storeNode(s *Services, d *Register) {
 
 	// Store the node and it successful mark the registration process as
 	// complete.
-	err = s.store.setNode(n)
+	err = s.store.setNode(ctx, n)
 	if err != nil {
 		d.Error = err.Error()
 	} else {
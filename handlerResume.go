@@ -0,0 +1,96 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The path of the handler that resumes an operation at the last node that
+// processed it successfully. Followed by the scrambled domain of the node that
+// failed, the scrambled table and the operation data.
+const resumePath = "/swift/resume/"
+
+// The response header that contains the URL used to resume the operation if
+// the next node fails.
+const resumeHeader = "X-Swift-Resume"
+
+// HandlerResume takes a Services pointer and returns a HTTP handler used when
+// the next node in a storage operation fails. The path contains the operation
+// as it was when this node last processed it, encrypted by this node so that
+// it can not be altered. The operation continues from this node with the
+// values it has accumulated to a different next node. Operations whose
+// deadline has passed, or whose results have already been used, are rejected.
+func HandlerResume(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Extract the operation parameters from the request.
+		o, err := getOperationFromRequest(s, r)
+		if err == nil && o.IsDeadlineValid() == false {
+			err = fmt.Errorf("Operation deadline '%s' passed", o.deadline)
+		}
+		if err == nil {
+			err = o.verifySignature(r.Context())
+		}
+		if err == nil && o.nonce != "" && s.nonceStore.Seen(o.nonce) {
+			err = fmt.Errorf("Operation '%s' already completed", o.nonce)
+		}
+		if err == nil {
+			o.skipNode, err = getResumeSkipNode(s, o.thisNode, r.URL.Path)
+		}
+		if err != nil {
+			s.logger.Debug("%s", err)
+			storeMalformed(s, w, r)
+			return
+		}
+
+		// Select a next node other than the one that failed and continue the
+		// operation.
+		err = o.setNextNode()
+		if err == nil && o.nextNode == nil {
+			err = fmt.Errorf("No next node available")
+		}
+		if err != nil {
+			returnServerError(s, w, err)
+			return
+		}
+		o.storeContinue(s, w, r)
+	}
+}
+
+// getResumeSkipNode returns the domain of the failed node from the third to
+// last segment of the path unscrambled by the node.
+func getResumeSkipNode(s *Services, n *node, path string) (string, error) {
+	a := strings.Split(s.trimBasePath(path), "/")
+	if len(a) < 3 {
+		return "", fmt.Errorf(
+			"Path '%s' contains insufficient segments",
+			path)
+	}
+	return n.unscramble(a[len(a)-3])
+}
+
+// getResumeURL returns the URL of the resume handler for this node containing
+// the next node that will be skipped if the operation is resumed and the
+// operation encrypted for this node.
+func (o *operation) getResumeURL() (*url.URL, error) {
+	return o.getThisNodeURL(
+		resumePath + o.scramble(o.thisNode, o.nextNode.domain) + "/")
+}
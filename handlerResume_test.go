@@ -0,0 +1,164 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+// Matches the next URL of the progress page.
+var testResumeNextURL = regexp.MustCompile("URL='([^']+)'")
+
+func TestResumeAfterNodeFailure(t *testing.T) {
+	_, n, err := NewTestNetwork(1, 4)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	q := url.Values{}
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	q.Set(testKey("a"), "1")
+	q.Set(testKey("b"), "2")
+	u, err := n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Visit the home node and the node after it successfully.
+	_, u, _ = testResumeGet(t, n, u)
+	p, u, r := testResumeGet(t, n, u)
+
+	// The next node fails so resume at the last node that succeeded.
+	f := testResumeHost(t, u)
+	c, v, _ := testResumeGet(t, n, r)
+	if c != p {
+		fmt.Printf("Expected resume at '%s' but got '%s'\n", p, c)
+		t.Fail()
+		return
+	}
+	if testResumeHost(t, v) == f {
+		fmt.Println("Resumed operation should not select the failed node")
+		t.Fail()
+		return
+	}
+
+	// The resumed operation completes with all the values.
+	e, err := n.Follow(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := n.Decode(e)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != 2 || a[0].Value != "1" || a[1].Value != "2" {
+		fmt.Printf("Unexpected results '%v'\n", a)
+		t.Fail()
+	}
+}
+
+func TestResumeTampered(t *testing.T) {
+	_, n, err := NewTestNetwork(1, 3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	q := url.Values{}
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	q.Set(testKey("a"), "1")
+	u, err := n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, _, r := testResumeGet(t, n, u)
+	b := []byte(r)
+	b[len(b)-2] ^= 1
+	g, err := n.Client.Get(string(b))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	g.Body.Close()
+	if g.StatusCode != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n",
+			http.StatusBadRequest,
+			g.StatusCode)
+		t.Fail()
+	}
+}
+
+// testResumeGet requests the URL which must return a progress page returning
+// the host that responded, the next URL and the resume URL.
+func testResumeGet(
+	t *testing.T,
+	n *TestNetwork,
+	u string) (string, string, string) {
+	r, err := n.Client.Get(u)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	defer r.Body.Close()
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	if r.StatusCode != http.StatusOK {
+		fmt.Println(string(b))
+		t.FailNow()
+	}
+	m := testResumeNextURL.FindSubmatch(b)
+	if m == nil || r.Header.Get(resumeHeader) == "" {
+		fmt.Printf("Page for '%s' has no next or resume URL\n", u)
+		t.FailNow()
+	}
+	return testResumeHost(t, u),
+		html.UnescapeString(string(m[1])),
+		r.Header.Get(resumeHeader)
+}
+
+// testResumeHost returns the host of the URL.
+func testResumeHost(t *testing.T, u string) string {
+	p, err := url.Parse(u)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	return p.Host
+}
@@ -0,0 +1,106 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SharedSecret is the scramble key material for a node that a trusted peer
+// needs to unscramble the values the node scrambles.
+type SharedSecret struct {
+	Domain  string `json:"domain"`  // The domain of the node
+	Key     string `json:"key"`     // The scrambler key for the node
+	Nonce   string `json:"nonce"`   // The fixed nonce as base64 URL encoding
+	Version int    `json:"version"` // The version byte of scrambled values
+}
+
+// HandlerShareSecret returns the scramble key material for the node as JSON.
+// Only peer nodes presenting one of the PeerKeys from the configuration can
+// use the handler. Public access keys are never accepted and cross origin
+// requests are not supported so browsers can not obtain the material.
+func HandlerShareSecret(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		err := r.ParseForm()
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Check the caller is a peer node.
+		if s.getPeerAllowed(r) == false {
+			returnAPIError(s, w,
+				ErrNotAuthorized,
+				http.StatusUnauthorized)
+			return
+		}
+
+		// Get the node associated with the request.
+		n, err := s.store.getNode(r.Context(), r.Host)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+		if n == nil {
+			returnAPIError(s, w,
+				fmt.Errorf("Host '%s': %w", r.Host, ErrNotSwiftNode),
+				http.StatusBadRequest)
+			return
+		}
+
+		b, err := json.Marshal(&SharedSecret{
+			n.domain,
+			n.scrambler.key,
+			base64.RawURLEncoding.EncodeToString(n.nonce),
+			scrambleVersionCurrent})
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		err = sendResponse(w, r, b)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// getPeerAllowed returns true if the access key in the request is one of the
+// peer keys. The keys are compared in constant time.
+func (s *Services) getPeerAllowed(r *http.Request) bool {
+	k := []byte(getAccessKey(r))
+	if len(k) == 0 {
+		return false
+	}
+	f := false
+	for _, p := range s.config.PeerKeys {
+		if subtle.ConstantTimeCompare(k, []byte(p)) == 1 {
+			f = true
+		}
+	}
+	return f
+}
@@ -0,0 +1,128 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShareSecretUnauthenticated(t *testing.T) {
+	s, err := newShareSecretTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Neither no key nor a public access key can obtain the material.
+	for _, h := range []string{"", "Bearer " + testAccessKey, "Bearer wrong"} {
+		w := httptest.NewRecorder()
+		HandlerShareSecret(s)(w, newShareSecretRequestTest(h))
+		if w.Code != http.StatusUnauthorized {
+			fmt.Printf("Header '%s' expected '%d' but got '%d'\n",
+				h,
+				http.StatusUnauthorized,
+				w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestShareSecretPeer(t *testing.T) {
+	s, err := newShareSecretTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := httptest.NewRecorder()
+	HandlerShareSecret(s)(w, newShareSecretRequestTest("Bearer peer"))
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusOK, w.Code)
+		t.Fail()
+		return
+	}
+	var m SharedSecret
+	err = json.Unmarshal(w.Body.Bytes(), &m)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n, err := s.store.getNode(
+		newShareSecretRequestTest("").Context(),
+		"storage-1.com")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if m.Domain != n.domain ||
+		m.Version != scrambleVersionCurrent ||
+		m.Nonce != base64.RawURLEncoding.EncodeToString(n.nonce) {
+		fmt.Printf("Material '%v' incorrect\n", m)
+		t.Fail()
+		return
+	}
+
+	// A peer with the key can unscramble values the node scrambles.
+	p, err := newNode(
+		testNetwork,
+		m.Domain,
+		n.created,
+		n.expires,
+		roleStorage,
+		m.Key)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	v, err := p.unscramble(n.scramble(encodingBase64URL, "table"))
+	if err != nil || v != "table" {
+		fmt.Printf("Expected 'table' but got '%s' (%v)\n", v, err)
+		t.Fail()
+	}
+}
+
+// newShareSecretTest returns services for a test network with a peer key.
+func newShareSecretTest() (*Services, error) {
+	s, err := newCreateTest()
+	if err != nil {
+		return nil, err
+	}
+	s.config.PeerKeys = []string{"peer"}
+	return s, nil
+}
+
+// newShareSecretRequestTest returns a request to the share secret handler at
+// the first storage node with the Authorization header h if not empty.
+func newShareSecretRequestTest(h string) *http.Request {
+	r := httptest.NewRequest(
+		"GET",
+		"https://storage-1.com/swift/api/v1/share-secret",
+		nil)
+	if h != "" {
+		r.Header.Set("Authorization", h)
+	}
+	return r
+}
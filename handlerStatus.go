@@ -0,0 +1,94 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Status of the node associated with the request returned by the status
+// handler.
+type Status struct {
+	Domain         string   `json:"domain"`         // The domain of the node
+	Role           int      `json:"role"`           // Role in the network
+	Networks       []string `json:"networks"`       // Networks the node is in
+	ActiveSecrets  int      `json:"activeSecrets"`  // Secrets usable now
+	ExpiredSecrets int      `json:"expiredSecrets"` // Superseded secrets
+	StoreReachable bool     `json:"storeReachable"` // True if store responded
+	Active         bool     `json:"active"`         // True if not expired
+	Alive          bool     `json:"alive"`          // Last health check result
+	Ready          bool     `json:"ready"`          // Can handle requests
+	Error          string   `json:"error"`          // Why not ready, or empty
+}
+
+// HandlerStatus returns the status of the node associated with the request as
+// JSON for use with liveness and readiness probes. The access key is not
+// required. If the node is not ready to process requests then the status code
+// is service unavailable.
+func HandlerStatus(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var t Status
+		t.Domain = r.Host
+
+		// Get the node from the store confirming the store is reachable.
+		n, err := s.store.getNode(r.Context(), r.Host)
+		if err != nil {
+			t.Error = err.Error()
+		} else {
+			t.StoreReachable = true
+			if n == nil {
+				t.Error = fmt.Sprintf("Host '%s' is not a Swift node", r.Host)
+			} else {
+				t.Role = n.role
+				t.Networks = n.networks
+				t.ActiveSecrets = n.getActiveSecretCount()
+				_, t.ExpiredSecrets = n.SecretStats()
+				t.Active = n.isActive()
+				t.Alive = n.isAlive()
+				if t.ActiveSecrets == 0 {
+					t.Error = fmt.Sprintf(
+						"No active secrets for node '%s'",
+						n.domain)
+				} else if t.Active == false {
+					t.Error = fmt.Sprintf("Node '%s' has expired", n.domain)
+				} else {
+					t.Ready = true
+				}
+			}
+		}
+
+		// Turn the status into a JSON string.
+		b, err := json.Marshal(&t)
+		if err != nil {
+			returnServerError(s, w, err)
+			return
+		}
+
+		c := http.StatusOK
+		if t.Ready == false {
+			c = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", s.config.cacheControl("status"))
+		err = sendResponseWithStatus(w, r, b, c)
+		if err != nil {
+			returnServerError(s, w, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusReady(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, w := testStatus(t, s, testAccess)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	if a.Ready == false ||
+		a.StoreReachable == false ||
+		a.ActiveSecrets != 1 ||
+		a.ExpiredSecrets != 0 ||
+		a.Role != roleAccess ||
+		len(a.Networks) != 1 ||
+		a.Networks[0] != testNetwork {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestStatusNoSecrets(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n, err := s.store.getNode(context.Background(), "storage-1.com")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n.secrets = nil
+	a, w := testStatus(t, s, n.domain)
+	if w.Code != http.StatusServiceUnavailable {
+		fmt.Printf("Expected '%d' but got '%d'\n",
+			http.StatusServiceUnavailable,
+			w.Code)
+		t.Fail()
+	}
+	if a.Ready || a.ActiveSecrets != 0 || a.Error == "" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+// testStatus calls the status handler for the domain returning the status and
+// the response.
+func testStatus(
+	t *testing.T,
+	s *Services,
+	domain string) (*Status, *httptest.ResponseRecorder) {
+	var a Status
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(
+		"GET",
+		"https://"+domain+"/swift/api/v1/status",
+		nil)
+	HandlerStatus(s)(w, r)
+	err := json.Unmarshal(w.Body.Bytes(), &a)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+	return &a, w
+}
@@ -17,11 +17,10 @@
 package swift
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"html/template"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"time"
@@ -40,7 +39,14 @@ func HandlerStore(
 
 		// Extract the operation parameters from the request.
 		o, err := newOperationFromRequest(s, w, r)
+		if err == nil && o.IsDeadlineValid() == false {
+			err = fmt.Errorf("Operation deadline '%s' passed", o.deadline)
+		}
+		if err == nil {
+			err = o.verifySignature(r.Context())
+		}
 		if err != nil {
+			s.logger.Debug("%s", err)
 			if e == nil {
 				storeMalformed(s, w, r)
 			} else {
@@ -49,35 +55,11 @@ func HandlerStore(
 			return
 		}
 
-		// If there are still more nodes to try and the operation is not out of
-		// time then select the next node.
-		if o.nodesVisited < o.nodeCount && o.IsTimeStampValid() {
-
-			// If this is the penultimate operation in the storage operation
-			// then go back to the home node that will be the first one in those
-			// visited to ensure it has the most current copy of the data.
-			if o.nodesVisited == o.nodeCount-1 {
-				o.nextNode = o.HomeNode()
-			}
-
-			// If no node is set then find a random storage node that is not the
-			// home node.
-			if o.nextNode == nil {
-				o.nextNode = o.network.getRandomNode(func(i *node) bool {
-					return i.role == roleStorage && i != o.HomeNode()
-				})
-			}
-
-			// If there is still no node them use the home node.
-			if o.nextNode == nil {
-				o.nextNode = o.HomeNode()
-			}
-
-			// If there is still no node then generate an error.
-			if o.nextNode == nil {
-				returnServerError(s, w, fmt.Errorf("No next node available"))
-				return
-			}
+		// Select the next node if there is one.
+		err = o.setNextNode()
+		if err != nil {
+			returnServerError(s, w, err)
+			return
 		}
 
 		if o.nextNode != nil {
@@ -85,14 +67,16 @@ func HandlerStore(
 			// Process any cookies to make sure this node stores the current
 			// version of the data.
 			err = o.processCookies(w, r)
-			if err != nil && s.config.Debug {
-				log.Println(err.Error())
+			if err != nil {
+				s.logger.Debug("%s", err)
 			}
 
 			// If this is the first node and all the cookies are valid then
 			// there is no need to continue bouncing.
 			if o.nodesVisited <= 1 && o.getCookiesValid() {
 				o.storeReturn(s, w, r, blankTemplate)
+			} else if o.getBrowserWarning(r) {
+				o.storeBrowserWarning(s, w, r)
 			} else {
 				o.storeContinue(s, w, r)
 			}
@@ -102,8 +86,8 @@ func HandlerStore(
 			// Process any cookies to make sure this node stores the current
 			// version of the data.
 			err = o.processCookies(w, r)
-			if err != nil && s.config.Debug {
-				log.Println(err.Error())
+			if err != nil {
+				s.logger.Debug("%s", err)
 			}
 
 			// If this is the home node and the last operation then validate
@@ -113,13 +97,81 @@ func HandlerStore(
 			if o.getCookiesPresent() == false {
 				o.storeWarning(s, w, r)
 			} else {
-				o.storeReturn(s, w, r, progressTemplate)
+				o.storeReturn(s, w, r, s.getProgressTemplate())
 			}
 		}
 
 	}
 }
 
+// setNextNode selects the next node if there are still more nodes to try and
+// the operation is not out of time. Otherwise the next node is left as nil.
+func (o *operation) setNextNode() error {
+	if o.nodesVisited >= o.nodeCount || o.IsTimeStampValid() == false {
+		return nil
+	}
+
+	// If this is the penultimate operation in the storage operation then go
+	// back to the home node that will be the first one in those visited to
+	// ensure it has the most current copy of the data.
+	if o.nodesVisited == o.nodeCount-1 {
+		o.nextNode = o.HomeNode()
+	}
+
+	// If the values are written to more than the home node then the visits
+	// before the last visit to the home node are to the replicas.
+	if o.nextNode == nil && o.redundancy > 1 {
+		o.nextNode = o.getReplicaNode()
+	}
+
+	// If this is the node after the home node then visit a node that is
+	// retiring so that the values it holds are carried to the home node.
+	if o.nextNode == nil && o.nodesVisited == 1 {
+		o.nextNode = o.network.getRandomNode(func(i *node) bool {
+			return i.role == roleStorage &&
+				i.retiring &&
+				i != o.HomeNode() &&
+				i.domain != o.skipNode
+		})
+	}
+
+	// If no node is set then find a random storage node that is not the home
+	// node or a node that has failed.
+	if o.nextNode == nil {
+		o.nextNode = o.network.getRandomNode(func(i *node) bool {
+			return i.role == roleStorage &&
+				i != o.HomeNode() &&
+				i.domain != o.skipNode
+		})
+	}
+
+	// If there is still no node them use the home node.
+	if o.nextNode == nil {
+		o.nextNode = o.HomeNode()
+	}
+
+	// If there is still no node then generate an error.
+	if o.nextNode == nil {
+		return fmt.Errorf("No next node available")
+	}
+	return nil
+}
+
+// getReplicaNode returns the replica of the home node to visit next, or nil if
+// the next visit is not to a replica or the replica has failed. The replicas
+// are visited in hash order ending with the visit before the home node.
+func (o *operation) getReplicaNode() *node {
+	i := int(o.nodesVisited) + int(o.redundancy) - int(o.nodeCount)
+	if i < 0 {
+		return nil
+	}
+	r := o.network.getReplicaNodes(o.HomeNode(), i+1)
+	if i >= len(r) || r[i].domain == o.skipNode {
+		return nil
+	}
+	return r[i]
+}
+
 // The operation is invalid return a malformed request.
 func storeMalformed(s *Services, w http.ResponseWriter, r *http.Request) {
 	var o operation
@@ -161,6 +213,45 @@ func (o *operation) storeWarning(
 	}
 }
 
+// getBrowserWarning returns true if the browser warning should be shown before
+// the operation continues, setting the warning HTML for the web browser. The
+// warning is only considered at the first node visited and is shown with the
+// probability set when the operation was created.
+func (o *operation) getBrowserWarning(r *http.Request) bool {
+	if o.nodesVisited != 1 ||
+		o.browserWarning <= 0 ||
+		o.services.browser == nil {
+		return false
+	}
+	if o.services.getRandomFloat32() >= o.browserWarning {
+		return false
+	}
+	o.warning = template.HTML(o.services.browser.GetWarningHTML(r))
+	return o.warning != ""
+}
+
+func (o *operation) storeBrowserWarning(
+	s *Services,
+	w http.ResponseWriter,
+	r *http.Request) {
+	var err error
+
+	// Get the URL that records the warning has been read and then continues
+	// the operation.
+	o.nextURL, err = o.getWarningContinueURL()
+	if err != nil {
+		returnServerError(s, w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	err = browserWarningTemplate.Execute(w, o)
+	if err != nil {
+		returnServerError(s, w, err)
+	}
+}
+
 func (o *operation) storeReturn(
 	s *Services,
 	w http.ResponseWriter,
@@ -171,12 +262,13 @@ func (o *operation) storeReturn(
 	if o.IsTimeStampValid() {
 		// The time stamp is valid so add the data to the end of the
 		// url.
-		x, err := o.getResults()
+		x, err := o.getResults(r.Context())
 		if err != nil {
 			returnServerError(s, w, err)
 			return
 		}
 		nu += x
+		o.sendWebhook(x)
 	}
 
 	// Turn the next URL string into a url.URL value.
@@ -207,6 +299,15 @@ func (o *operation) storeContinue(
 		return
 	}
 
+	// Get the URL that resumes the operation at this node if the next node
+	// fails.
+	o.resumeURL, err = o.getResumeURL()
+	if err != nil {
+		returnServerError(s, w, err)
+		return
+	}
+	w.Header().Set(resumeHeader, o.resumeURL.String())
+
 	// Set the preload header to trigger a DNS lookup on the next domain before
 	// the request to that domain occurs via the navigation change. Only do this
 	// if the next node is not the home node which will have already been
@@ -221,60 +322,64 @@ func (o *operation) storeContinue(
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
-	err = progressTemplate.Execute(w, o)
+	err = s.getProgressTemplate().Execute(w, o)
 	if err != nil {
 		returnServerError(s, w, err)
 	}
 }
 
-func (o *operation) getResults() (string, error) {
+// newResults returns the results of the operation. Pairs that are tombstones for
+// deleted values, or that have expired, are not included.
+func (o *operation) newResults() *Results {
 
 	// Build the results array of key value pairs.
 	var r Results
+	t := o.services.now()
 	for _, p := range o.values {
-		r.Values = append(
-			r.Values,
-			&Result{p.key, p.created, p.expires, p.value})
+		if p.isDeleted() == false && p.isExpiredAt(t) == false {
+			r.Values = append(r.Values, p.asResult(o.table))
+		}
 	}
 
 	// Add the expiry time for the results.
-	r.Expires = time.Now().UTC().Add(
+	r.Expires = t.Add(
 		time.Second * o.services.config.BundleTimeout)
 
 	// Add other state information from the storage operation.
 	r.State = o.state
+	r.Table = o.table
+	r.nonce = o.nonce
 
 	// Add HTML user interface parameters from the storage operation.
 	r.HTML = o.HTML
 
-	// Encode them as a byte array for encryption.
-	out, err := encodeResults(&r)
+	return &r
+}
+
+func (o *operation) getResults(ctx context.Context) (string, error) {
+
+	// Encode the results as a byte array for encryption.
+	out, err := encodeResults(o.newResults())
 	if err != nil {
 		return "", err
 	}
 
 	// Encrypt the result with the access node.
 	u, err := url.Parse(
-		o.services.config.Scheme + "://" + o.accessNode + "/swift/api/v1/encrypt")
+		o.services.getNodeURL(o.accessNode, "/swift/api/v1/encrypt"))
 	if err != nil {
 		return "", err
 	}
 	q := u.Query()
 	q.Set("data", base64.RawURLEncoding.EncodeToString(out))
+	q.Set(tableParam, o.table)
 	u.RawQuery = q.Encode()
 
-	res, err := http.Get(u.String())
+	in, err := o.services.getFromNode(ctx, u.String())
 	if err != nil {
 		return "", err
 	}
-	if res.StatusCode != http.StatusOK {
-		return "", newResponseError(u.String(), res)
-	}
-	in, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return "", err
-	}
-	return base64.RawURLEncoding.EncodeToString(in), nil
+	return encodeValue(o.services.config.encoding(), in), nil
 }
 
 func (o *operation) getNextURL() (*url.URL, error) {
@@ -286,11 +391,9 @@ func (o *operation) getNextURL() (*url.URL, error) {
 	if err != nil {
 		return nil, err
 	}
-	u, err := url.Parse(fmt.Sprintf("%s://%s/%s/%s",
-		o.services.config.Scheme,
+	u, err := url.Parse(o.services.getNodeURL(
 		o.nextNode.domain,
-		o.nextNode.scramble(o.table),
-		p))
+		"/"+o.scrambleTable(o.nextNode)+"/"+p))
 	if err != nil {
 		return nil, err
 	}
@@ -302,11 +405,14 @@ func (o *operation) asURLParameter() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	e, err := o.nextNode.encrypt(b)
+	e, err := o.nextNode.encryptForTable(
+		b,
+		o.services.config.compressionLevel(),
+		o.services.getSecretTable(o.table))
 	if err != nil {
 		return "", err
 	}
-	return base64.RawURLEncoding.EncodeToString(e), err
+	return encodeValue(o.services.config.encoding(), e), err
 }
 
 // For each of the keys that this operation is concerned with find the value
@@ -316,7 +422,14 @@ func (o *operation) processCookies(
 	w http.ResponseWriter,
 	r *http.Request) error {
 	for _, p := range o.values {
-		c, err := r.Cookie(o.thisNode.scramble(p.key))
+		var c *http.Cookie
+		var err error
+		for _, n := range o.getCookieNames(p.key) {
+			c, err = r.Cookie(n)
+			if err == nil {
+				break
+			}
+		}
 		if err != nil {
 
 			// If there was a problem getting the cookie then just write the
@@ -348,7 +461,7 @@ func processCookie(
 	c *http.Cookie) error {
 
 	// Decrypt the cookie value, and continue if valid.
-	v, err := o.thisNode.getValueFromCookie(c)
+	v, err := o.getValueFromCookie(r, c)
 	if err != nil {
 
 		// The current cookie is invalid and can't be used. Set the cookie to
@@ -359,7 +472,7 @@ func processCookie(
 
 		// Resolve the conflict between the operation's value and the one found
 		// in the cookie.
-		res, err := resolveConflict(p, v)
+		res, err := resolveConflict(p, v, o.services.now())
 		if err != nil {
 			return err
 		}
@@ -381,6 +494,7 @@ func processCookie(
 			p.expires = res.expires
 			p.key = res.key
 			p.value = res.value
+			p.binary = res.binary
 			p.cookieWriteTime = res.cookieWriteTime
 		}
 	}
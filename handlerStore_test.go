@@ -0,0 +1,481 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreProgressTemplateDefault(t *testing.T) {
+	s, o, err := newStoreContinueTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := httptest.NewRecorder()
+	o.storeContinue(s, w, httptest.NewRequest("GET", "/", nil))
+	b := w.Body.String()
+	if strings.Contains(b, "<title>Test Title</title>") == false {
+		fmt.Println(b)
+		t.Fail()
+	}
+}
+
+func TestStoreProgressTemplateCustom(t *testing.T) {
+	s, o, err := newStoreContinueTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.SetProgressTemplate(template.Must(template.New("custom").Parse(
+		`<html><h1 class="brand">{{.Title}}</h1>` +
+			`<a href="{{.NextURL}}">{{.Message}}</a></html>`)))
+	o.HTML.Message = "<script>alert(1)</script>"
+	w := httptest.NewRecorder()
+	o.storeContinue(s, w, httptest.NewRequest("GET", "/", nil))
+	b := w.Body.String()
+	if strings.Contains(b, `<h1 class="brand">Test Title</h1>`) == false {
+		fmt.Println(b)
+		t.Fail()
+	}
+	if strings.Contains(b, "<script>") {
+		fmt.Println("Message should be escaped")
+		t.Fail()
+	}
+	if strings.Contains(b, o.nextURL.Host) == false {
+		fmt.Println("Next URL should be present")
+		t.Fail()
+	}
+
+	// Setting nil restores the built in template.
+	s.SetProgressTemplate(nil)
+	if s.getProgressTemplate() != progressTemplate {
+		fmt.Println("Built in template should be used")
+		t.Fail()
+	}
+}
+
+func TestStoreBrowserWarningAlways(t *testing.T) {
+	w, err := testStoreBrowserWarning(1)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b := w.Body.String()
+	if strings.Contains(b, testBrowserWarning) == false {
+		fmt.Println(b)
+		t.Fail()
+	}
+	if strings.Contains(b, ">Continue</a>") == false {
+		fmt.Println("Warning should link to continue the operation")
+		t.Fail()
+	}
+}
+
+func TestStoreBrowserWarningNever(t *testing.T) {
+	w, err := testStoreBrowserWarning(0)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b := w.Body.String()
+	if strings.Contains(b, testBrowserWarning) {
+		fmt.Println(b)
+		t.Fail()
+	}
+	if strings.Contains(b, "<title>Test Title</title>") == false {
+		fmt.Println("Progress page should be shown")
+		t.Fail()
+	}
+}
+
+// The HTML returned by testBrowser for all requests.
+const testBrowserWarning = "<p>Test browser warning</p>"
+
+// testBrowser is a BrowserDetector that returns a warning for every request.
+type testBrowser struct{}
+
+func (testBrowser) GetWarningHTML(r *http.Request) string {
+	return testBrowserWarning
+}
+
+// testStoreBrowserWarning creates an operation with the browser warning
+// probability provided and returns the response from the first storage node.
+func testStoreBrowserWarning(
+	p float64) (*httptest.ResponseRecorder, error) {
+	s, err := newCreateTest()
+	if err != nil {
+		return nil, err
+	}
+	s.browser = testBrowser{}
+	s.SetRandomSource(rand.NewSource(1))
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	q.Set(browserWarningParam, fmt.Sprintf("%f", p))
+	c := testCreate(s, q)
+	if c.Code != http.StatusOK {
+		return nil, fmt.Errorf(c.Body.String())
+	}
+	w := httptest.NewRecorder()
+	HandlerStore(s, nil)(w, httptest.NewRequest("GET", c.Body.String(), nil))
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("Status code '%d' unexpected", w.Code)
+	}
+	return w, nil
+}
+
+// newStoreContinueTest returns an operation at the first storage node that is
+// ready to continue to the second storage node.
+func newStoreContinueTest() (*Services, *operation, error) {
+	v, err := newVolatileNetworkTest(2)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := v.getNode(context.Background(), "storage-1.com")
+	if err != nil {
+		return nil, nil, err
+	}
+	o := newOperation(s, n)
+	o.table = "table"
+	o.homeNode = n.domain
+	o.nodeCount = 3
+	o.nodesVisited = 1
+	o.HTML.Title = s.config.Title
+	o.HTML.Message = s.config.Message
+	o.nextNode, err = v.getNode(context.Background(), "storage-2.com")
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, o, nil
+}
+
+func TestStoreDeadlinePassed(t *testing.T) {
+	s, u, err := newStoreEndTest(-time.Minute)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := httptest.NewRecorder()
+	HandlerStore(s, nil)(w, httptest.NewRequest("GET", u, nil))
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
+
+func TestStoreDeadlineValid(t *testing.T) {
+	s, u, err := newStoreEndTest(time.Minute)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := httptest.NewRecorder()
+	HandlerStore(s, nil)(w, httptest.NewRequest("GET", u, nil))
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusOK, w.Code)
+		t.Fail()
+	}
+}
+
+func TestStoreSignature(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	c := testCreate(s, q)
+	if c.Code != http.StatusOK {
+		fmt.Println(c.Body.String())
+		t.Fail()
+		return
+	}
+	u := c.Body.String()
+
+	// The untampered operation is accepted by the home node.
+	w := httptest.NewRecorder()
+	HandlerStore(s, nil)(w, httptest.NewRequest("GET", u, nil))
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusOK, w.Code)
+		t.Fail()
+		return
+	}
+
+	// Each of the signed fields is rejected if changed.
+	for _, f := range []func(o *operation){
+		func(o *operation) { o.returnURL = "https://tampered.com/" },
+		func(o *operation) { o.table = "tampered" },
+		func(o *operation) { o.accessNode = "storage-1.com" },
+		func(o *operation) { o.webhookURL = "https://tampered.com/" }} {
+		o, err := testOperationFromURL(s, u)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		f(o)
+		o.nextNode = o.thisNode
+		n, err := o.getNextURL()
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		w = httptest.NewRecorder()
+		HandlerStore(s, nil)(w, httptest.NewRequest("GET", n.String(), nil))
+		if w.Code != http.StatusBadRequest {
+			fmt.Printf("Expected '%d' but got '%d'\n",
+				http.StatusBadRequest,
+				w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestStoreNextURLNoBasePath(t *testing.T) {
+	s, o, err := newStoreContinueTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testStoreNextURL(t, s, o, "/"+o.scrambleTable(o.nextNode)+"/")
+}
+
+func TestStoreNextURLBasePath(t *testing.T) {
+	s, o, err := newStoreContinueTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.SetBasePath("swift/")
+	testStoreNextURL(t, s, o, "/swift/"+o.scrambleTable(o.nextNode)+"/")
+
+	// Cookies are limited to the table path under the base path.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://storage-1.com/", nil)
+	err = o.setValueInCookie(w, r, testPair("a", "1", conflictNewest, 0))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	p := "/swift/" + o.scrambleTable(o.thisNode)
+	for _, c := range w.Result().Cookies() {
+		if c.Path != p {
+			fmt.Printf("Expected path '%s' but got '%s'\n", p, c.Path)
+			t.Fail()
+		}
+	}
+}
+
+func TestStoreRedundancy(t *testing.T) {
+	s, n, err := NewTestNetwork(1, 4)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	err = s.CheckNodeHealth(TestNetworkName)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Only visit the home node and its replica so that no other node stores
+	// the value.
+	k := "a<" + time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02")
+	q := url.Values{}
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	q.Set(bounces, "2")
+	q.Set(redundancyParam, "2")
+	q.Set(k, "1")
+	u, err := n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	h := testResumeHost(t, u)
+	_, v, _ := testResumeGet(t, n, u)
+	if testResumeHost(t, v) == h {
+		fmt.Println("Expected the replica to be visited after the home node")
+		t.Fail()
+		return
+	}
+	_, err = n.Follow(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Stop the home node. The replica becomes the home node and still holds
+	// the value.
+	for i, d := range n.StorageNodes {
+		if d == h {
+			n.servers[len(n.AccessNodes)+i].Close()
+		}
+	}
+	err = s.CheckNodeHealth(TestNetworkName)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q.Set(k, "2")
+	q.Del(redundancyParam)
+	u, err = n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if testResumeHost(t, u) == h {
+		fmt.Println("Stopped node should not be the home node")
+		t.Fail()
+		return
+	}
+	e, err := n.Follow(u)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := n.Decode(e)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != 1 || a[0].Value != "1" {
+		fmt.Printf("Expected the value from the replica but got '%v'\n", a)
+		t.Fail()
+	}
+}
+
+func TestStoreRedundancyInvalid(t *testing.T) {
+	s, n, err := NewTestNetwork(1, 2)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	for _, v := range []string{"0", "x", fmt.Sprint(s.config.maxBounces())} {
+		q := url.Values{}
+		q.Set(returnURLParam, "https://return.com/path?data=")
+		q.Set(tableParam, "table")
+		q.Set(redundancyParam, v)
+		_, err = n.Create(q)
+		if err == nil {
+			fmt.Printf("Expected redundancy '%s' to be rejected\n", v)
+			t.Fail()
+		}
+	}
+}
+
+// testStoreNextURL checks the next URL for the operation starts with the
+// prefix and that the next node can read the operation from the URL.
+func testStoreNextURL(t *testing.T, s *Services, o *operation, prefix string) {
+	u, err := o.getNextURL()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if u.Host != o.nextNode.domain ||
+		strings.HasPrefix(u.Path, prefix) == false {
+		fmt.Printf("URL '%s' should start with '%s'\n", u, prefix)
+		t.Fail()
+		return
+	}
+	n, err := testOperationFromURL(s, u.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if n.table != o.table {
+		fmt.Printf("Expected table '%s' but got '%s'\n", o.table, n.table)
+		t.Fail()
+	}
+}
+
+// newStoreEndTest returns the URL for the final step of an operation at the
+// home node with a deadline the offset from now.
+func newStoreEndTest(offset time.Duration) (*Services, string, error) {
+	v, err := newVolatileNetworkTest(1)
+	if err != nil {
+		return nil, "", err
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		return nil, "", err
+	}
+	a, err := v.getNode(context.Background(), testAccess)
+	if err != nil {
+		return nil, "", err
+	}
+	h, err := v.getNode(context.Background(), "storage-1.com")
+	if err != nil {
+		return nil, "", err
+	}
+	o := newOperation(s, a)
+	o.accessNode = a.domain
+	o.returnURL = "https://return.com/"
+	o.table = "table"
+	o.nodeCount = 1
+	o.homeNode = h.domain
+	o.nextNode = h
+	o.deadline = time.Now().UTC().Add(offset)
+	o.values = []*pair{testPair("a", "1", conflictNewest, 0)}
+	err = o.sign(a)
+	if err != nil {
+		return nil, "", err
+	}
+	u, err := o.getNextURL()
+	if err != nil {
+		return nil, "", err
+	}
+	return s, u.String(), nil
+}
@@ -0,0 +1,162 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTablesDistinct(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, n := range []string{"table", "other", "table"} {
+		q := newCreateValuesTest()
+		q.Set(tableParam, n)
+		q.Set(testKey("a"), "1")
+		if w := testCreate(s, q); w.Code != http.StatusOK {
+			fmt.Println(w.Body.String())
+			t.Fail()
+			return
+		}
+	}
+	a, err := s.Tables()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testTables(t, a, "other,table")
+	w := testTablesHandler(s)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var v []string
+	err = json.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testTables(t, v, "other,table")
+}
+
+func TestTablesInvalidRequest(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// A create with an invalid webhook must not record the table.
+	q := newCreateValuesTest()
+	q.Set(tableParam, "webhook")
+	q.Set(webhookURLParam, "ftp://"+testAccess)
+	q.Set(testKey("a"), "1")
+	if w := testCreate(s, q); w.Code == http.StatusOK {
+		fmt.Println("Invalid webhook should fail")
+		t.Fail()
+	}
+
+	// A create with an invalid key must not record the table.
+	q = newCreateValuesTest()
+	q.Set(tableParam, "pair")
+	q.Set(testKey("\xff"), "1")
+	if w := testCreate(s, q); w.Code == http.StatusOK {
+		fmt.Println("Invalid key should fail")
+		t.Fail()
+	}
+
+	// A delete without a key must not record the table.
+	q = newCreateValuesTest()
+	q.Set(tableParam, "delete")
+	w := httptest.NewRecorder()
+	HandlerDelete(s)(w, newCreateRequestTest(q))
+	if w.Code == http.StatusOK {
+		fmt.Println("Delete without a key should fail")
+		t.Fail()
+	}
+
+	a, err := s.Tables()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testTables(t, a, "")
+}
+
+func TestTablesAccessKeyScope(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, n := range []string{"table", "other"} {
+		q := newCreateValuesTest()
+		q.Set(tableParam, n)
+		q.Set(testKey("a"), "1")
+		if w := testCreate(s, q); w.Code != http.StatusOK {
+			fmt.Println(w.Body.String())
+			t.Fail()
+			return
+		}
+	}
+	s.config.AccessKeyTables = map[string][]string{testAccessKey: {"tab*"}}
+	w := testTablesHandler(s)
+	var v []string
+	err = json.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testTables(t, v, "table")
+}
+
+// testTables checks the tables match the comma separated names expected.
+func testTables(t *testing.T, a []string, expected string) {
+	if v := strings.Join(a, ","); v != expected {
+		fmt.Printf("Expected '%s' but got '%s'\n", expected, v)
+		t.Fail()
+	}
+}
+
+func testTablesHandler(s *Services) *httptest.ResponseRecorder {
+	q := url.Values{}
+	q.Set(accessKey, testAccessKey)
+	r := httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/tables?"+q.Encode(),
+		nil)
+	w := httptest.NewRecorder()
+	HandlerTables(s)(w, r)
+	return w
+}
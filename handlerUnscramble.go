@@ -0,0 +1,90 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HandlerUnscramble takes a Services pointer and returns a HTTP handler used
+// when troubleshooting to unscramble the value provided in the data parameter
+// with the node for the host of the request. The plain text is returned. The
+// handler is only available when Debug is enabled and otherwise responds with
+// not found.
+func HandlerUnscramble(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Only respond if debug is enabled.
+		if s.config.Debug == false {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Get the scrambled value.
+		v := r.Form.Get("data")
+		if v == "" {
+			returnAPIError(s, w,
+				errors.New("Missing data"),
+				http.StatusBadRequest)
+			return
+		}
+
+		// Get the node associated with the request.
+		n, err := s.store.getNode(r.Context(), r.Host)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+		if n == nil {
+			returnAPIError(s, w,
+				fmt.Errorf("Host '%s': %w", r.Host, ErrNotSwiftNode),
+				http.StatusBadRequest)
+			return
+		}
+
+		// Unscramble the value with the node.
+		u, err := n.unscramble(v)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Return the plain text.
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", s.config.cacheControl("unscramble"))
+		_, err = w.Write([]byte(u))
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestUnscrambleValid(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testUnscramble(s, n.scramble(encodingBase64URL, "table"))
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	if v := w.Body.String(); v != "table" {
+		fmt.Printf("Expected 'table' but got '%s'\n", v)
+		t.Fail()
+	}
+}
+
+func TestUnscrambleInvalid(t *testing.T) {
+	s, _, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w := testUnscramble(s, "not scrambled!")
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+}
+
+func TestUnscrambleDebugDisabled(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.Debug = false
+	w := testUnscramble(s, n.scramble(encodingBase64URL, "table"))
+	if w.Code != http.StatusNotFound {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusNotFound, w.Code)
+		t.Fail()
+	}
+}
+
+func testUnscramble(s *Services, d string) *httptest.ResponseRecorder {
+	q := url.Values{}
+	q.Set("data", d)
+	q.Set(accessKey, testAccessKey)
+	r := httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/unscramble?"+q.Encode(),
+		nil)
+	w := httptest.NewRecorder()
+	HandlerUnscramble(s)(w, r)
+	return w
+}
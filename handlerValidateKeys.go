@@ -0,0 +1,90 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// KeyValidation is the result of validating a single key submitted to the
+// validate keys handler.
+type KeyValidation struct {
+	Key   string // The key as submitted including the conflict character
+	Valid bool   // True if the key could be used to create a pair
+	Error string // The reason the key is invalid, or empty if valid
+}
+
+// HandlerValidateKeys takes a Services pointer and returns a HTTP handler used
+// to check the keys that would be provided to the create handler without
+// starting a storage operation. The response is a JSON array containing one
+// entry for each of the keys.
+func HandlerValidateKeys(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Limit the size of the request body before it is parsed.
+		limitRequestBody(s, w, r)
+
+		// Set the cross origin headers and respond to preflight requests.
+		if s.handleCORS(w, r) {
+			return
+		}
+
+		// Check caller can access
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Validate each of the keys that are not reserved.
+		v := make([]*KeyValidation, 0, len(r.Form))
+		for k, a := range r.Form {
+			if isReserved(k) == false && len(a) > 0 {
+				var i KeyValidation
+				i.Key = k
+				_, err := createPair(
+					k,
+					a[0],
+					s.now(),
+					&s.config)
+				if err != nil {
+					i.Error = err.Error()
+				} else {
+					i.Valid = true
+				}
+				v = append(v, &i)
+			}
+		}
+		sort.Slice(v, func(i, j int) bool {
+			return v[i].Key < v[j].Key
+		})
+
+		// Turn the array into a JSON string.
+		b, err := json.Marshal(v)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", s.config.cacheControl("validate-keys"))
+		err = sendResponse(w, r, b)
+		if err != nil {
+			returnAPIError(s, w, err, http.StatusInternalServerError)
+		}
+	}
+}
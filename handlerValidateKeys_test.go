@@ -0,0 +1,98 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateKeys(t *testing.T) {
+	s, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	f := time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02")
+	p := time.Now().UTC().AddDate(0, -1, 0).Format("2006-01-02")
+	q := url.Values{}
+	q.Set(accessKey, testAccessKey)
+	q.Set("a>"+f, "valid")
+	q.Set("b", "no conflict")
+	q.Set("c<"+p, "past")
+	r := httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/validate-keys?"+q.Encode(),
+		nil)
+	w := httptest.NewRecorder()
+	HandlerValidateKeys(s)(w, r)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	var v []*KeyValidation
+	err = json.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(v) != 3 {
+		fmt.Printf("Expected 3 results but got %d\n", len(v))
+		t.Fail()
+		return
+	}
+	if v[0].Valid == false || v[0].Error != "" {
+		fmt.Println("Valid key reported as invalid")
+		t.Fail()
+	}
+	if v[1].Valid || strings.Contains(v[1].Error, "must include") == false {
+		fmt.Printf("Key without conflict character error '%s'\n", v[1].Error)
+		t.Fail()
+	}
+	if v[2].Valid || strings.Contains(v[2].Error, "in the future") == false {
+		fmt.Printf("Key with past expiry error '%s'\n", v[2].Error)
+		t.Fail()
+	}
+}
+
+func TestValidateKeysNotAuthorized(t *testing.T) {
+	s, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := httptest.NewRequest(
+		"GET",
+		"https://"+testAccess+"/swift/api/v1/validate-keys?accessKey=wrong",
+		nil)
+	w := httptest.NewRecorder()
+	HandlerValidateKeys(s)(w, r)
+	if w.Code == http.StatusOK {
+		fmt.Println("Invalid access key should not be allowed")
+		t.Fail()
+	}
+}
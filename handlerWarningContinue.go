@@ -0,0 +1,96 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// The path of the handler that continues an operation once the browser warning
+// has been acknowledged. Followed by the scrambled table and operation data.
+const warningContinuePath = "/swift/warning-continue/"
+
+// HandlerWarningContinue takes a Services pointer and returns a HTTP handler
+// used when the user acknowledges the browser warning. The path contains the
+// operation as it was when the warning was shown by the node. The warning is
+// marked as acknowledged so that it is not shown again and the operation
+// continues to the next node. Operations whose deadline has passed, or whose
+// results have already been used, are rejected so that a replayed
+// acknowledgement can not restart a completed operation.
+func HandlerWarningContinue(s *Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Extract the operation parameters from the request.
+		o, err := getOperationFromRequest(s, r)
+		if err == nil && o.IsDeadlineValid() == false {
+			err = fmt.Errorf("Operation deadline '%s' passed", o.deadline)
+		}
+		if err == nil {
+			err = o.verifySignature(r.Context())
+		}
+		if err == nil && o.nonce != "" && s.nonceStore.Seen(o.nonce) {
+			err = fmt.Errorf("Operation '%s' already completed", o.nonce)
+		}
+		if err != nil {
+			s.logger.Debug("%s", err)
+			storeMalformed(s, w, r)
+			return
+		}
+
+		// The warning has been acknowledged and is not shown again.
+		o.browserWarning = 0
+
+		// Select the next node and continue the operation.
+		err = o.setNextNode()
+		if err == nil && o.nextNode == nil {
+			err = fmt.Errorf("No next node available")
+		}
+		if err != nil {
+			returnServerError(s, w, err)
+			return
+		}
+		o.storeContinue(s, w, r)
+	}
+}
+
+// getWarningContinueURL returns the URL of the warning continue handler for
+// this node containing the operation encrypted for this node.
+func (o *operation) getWarningContinueURL() (*url.URL, error) {
+	return o.getThisNodeURL(warningContinuePath)
+}
+
+// getThisNodeURL returns the URL for this node with the path provided followed
+// by the scrambled table and the operation encrypted for this node.
+func (o *operation) getThisNodeURL(p string) (*url.URL, error) {
+	b, err := o.asByteArray()
+	if err != nil {
+		return nil, err
+	}
+	d, err := o.thisNode.encryptForTable(
+		b,
+		o.services.config.compressionLevel(),
+		o.services.getSecretTable(o.table))
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(o.services.getNodeURL(
+		o.thisNode.domain,
+		p+o.scrambleTable(o.thisNode)+"/"+
+			encodeValue(o.services.config.encoding(), d)))
+}
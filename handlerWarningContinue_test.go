@@ -0,0 +1,113 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Matches the continue link of the browser warning page.
+var testWarningContinueURL = regexp.MustCompile(`<a href="([^"]+)"`)
+
+func TestWarningContinue(t *testing.T) {
+	s, n, err := NewTestNetwork(1, 3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	s.browser = testBrowser{}
+	q := url.Values{}
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	q.Set(browserWarningParam, "1")
+	q.Set(testKey("a"), "1")
+	u, err := n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The first node shows the warning with a link to acknowledge it.
+	c, b := testWarningContinueGet(t, n, u)
+	if strings.Contains(b, testBrowserWarning) == false {
+		fmt.Println(b)
+		t.Fail()
+		return
+	}
+	m := testWarningContinueURL.FindStringSubmatch(b)
+	if m == nil || strings.Contains(m[1], warningContinuePath) == false {
+		fmt.Println("Warning should link to the continue handler")
+		t.Fail()
+		return
+	}
+	a := html.UnescapeString(m[1])
+
+	// Acknowledging the warning continues the operation to completion.
+	e, err := n.Follow(a)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r, err := n.Decode(e)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(r) != 1 || r[0].Value != "1" {
+		fmt.Printf("Unexpected results '%v'\n", r)
+		t.Fail()
+		return
+	}
+
+	// Replaying the acknowledgement must not restart the operation.
+	if c, _ = testWarningContinueGet(t, n, a); c != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, c)
+		t.Fail()
+	}
+}
+
+// testWarningContinueGet requests the URL with the network's browser client
+// returning the status code and body.
+func testWarningContinueGet(
+	t *testing.T,
+	n *TestNetwork,
+	u string) (int, string) {
+	r, err := n.Client.Get(u)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	defer r.Body.Close()
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	return r.StatusCode, string(b)
+}
@@ -17,9 +17,12 @@
 package swift
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 // AddHandlers to the http default mux for shared web state.
@@ -28,12 +31,37 @@ import (
 func AddHandlers(
 	services *Services,
 	malformedHandler func(w http.ResponseWriter, r *http.Request)) {
-	http.HandleFunc("/swift/register", HandlerRegister(services))
-	http.HandleFunc("/swift/api/v1/create", HandlerCreate(services))
-	http.HandleFunc("/swift/api/v1/encrypt", HandlerEncrypt(services))
-	http.HandleFunc("/swift/api/v1/decrypt", HandlerDecrypt(services))
-	http.HandleFunc("/swift/api/v1/decode-as-json", HandlerDecodeAsJSON(services))
-	http.HandleFunc("/", HandlerStore(services, malformedHandler))
+	AddHandlersToMux(http.DefaultServeMux, services, malformedHandler)
+}
+
+// AddHandlersToMux is the same as AddHandlers but adds the handlers to the mux
+// provided rather than the http default mux.
+func AddHandlersToMux(
+	mux *http.ServeMux,
+	services *Services,
+	malformedHandler func(w http.ResponseWriter, r *http.Request)) {
+	mux.HandleFunc("/swift/register", HandlerRegister(services))
+	mux.HandleFunc("/swift/api/v1/create", HandlerCreate(services))
+	mux.HandleFunc("/swift/api/v1/delete", HandlerDelete(services))
+	mux.HandleFunc("/swift/api/v1/encrypt", HandlerEncrypt(services))
+	mux.HandleFunc("/swift/api/v1/decrypt", HandlerDecrypt(services))
+	mux.HandleFunc("/swift/api/v1/refresh", HandlerRefresh(services))
+	mux.HandleFunc("/swift/api/v1/decode-as-json", HandlerDecodeAsJSON(services))
+	mux.HandleFunc("/swift/api/v1/decode-many-as-json", HandlerDecodeManyAsJSON(services))
+	mux.HandleFunc("/swift/api/v1/decode-as-csv", HandlerDecodeAsCSV(services))
+	mux.HandleFunc("/swift/api/v1/validate-keys", HandlerValidateKeys(services))
+	mux.HandleFunc("/swift/api/v1/key-ttl", HandlerKeyTTL(services))
+	mux.HandleFunc("/swift/api/v1/decode-key", HandlerDecodeKey(services))
+	mux.HandleFunc("/swift/api/v1/decode-keys", HandlerDecodeKeys(services))
+	mux.HandleFunc("/swift/api/v1/has-keys", HandlerHasKeys(services))
+	mux.HandleFunc("/swift/api/v1/status", HandlerStatus(services))
+	mux.HandleFunc("/swift/api/v1/share-secret", HandlerShareSecret(services))
+	mux.HandleFunc("/swift/api/v1/operation-info", HandlerOperationInfo(services))
+	mux.HandleFunc("/swift/api/v1/unscramble", HandlerUnscramble(services))
+	mux.HandleFunc("/swift/api/v1/tables", HandlerTables(services))
+	mux.HandleFunc(warningContinuePath, HandlerWarningContinue(services))
+	mux.HandleFunc(resumePath, HandlerResume(services))
+	mux.HandleFunc("/", HandlerStore(services, malformedHandler))
 }
 
 func newResponseError(url string, resp *http.Response) error {
@@ -45,17 +73,150 @@ func newResponseError(url string, resp *http.Response) error {
 		url, resp.StatusCode, in)
 }
 
+// returnAPIError responds with the error and status code. Errors that can be
+// identified with errors.Is use the status code for the error. If debug is not
+// enabled then server errors respond with only the status text and the error
+// is logged. Client errors always include the error so the caller can correct
+// the request.
 func returnAPIError(
 	s *Services,
 	w http.ResponseWriter,
 	err error,
 	code int) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	code = getErrorStatus(err, code)
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	http.Error(w, err.Error(), code)
-	if s.config.Debug {
-		println(err.Error())
+	if code >= http.StatusInternalServerError && s.config.Debug == false {
+		// Server errors can contain details of the store or cryptography that
+		// must not be disclosed to the caller.
+		http.Error(w, http.StatusText(code), code)
+		s.logger.Error("%s", err)
+	} else {
+		http.Error(w, err.Error(), code)
+		s.logger.Debug("%s", err)
+	}
+}
+
+// handleCORS sets the cross origin headers for the API handlers. If no allowed
+// origins are configured any origin is allowed, otherwise the request's origin
+// is returned if it is allowed. Returns true if the request was a preflight
+// request that has been responded to and needs no further processing.
+func (s *Services) handleCORS(w http.ResponseWriter, r *http.Request) bool {
+	o := r.Header.Get("Origin")
+	a := true
+	if len(s.config.AllowedOrigins) == 0 {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Add("Vary", "Origin")
+		a = o != "" && s.config.getOriginAllowed(o)
+		if a {
+			w.Header().Set("Access-Control-Allow-Origin", o)
+			if s.config.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+	}
+	if r.Method != http.MethodOptions ||
+		r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	if a == false {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	if h := r.Header.Get("Access-Control-Request-Headers"); h != "" {
+		w.Header().Set("Access-Control-Allow-Headers", h)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// sendResponse writes the bytes to the response. If the requestor indicated
+// via the Accept-Encoding header that gzip is supported then the bytes are
+// compressed and the Content-Length header is not set. Otherwise the bytes are
+// written unaltered with a fixed Content-Length.
+func sendResponse(w http.ResponseWriter, r *http.Request, b []byte) error {
+	return sendResponseWithStatus(w, r, b, http.StatusOK)
+}
+
+// sendResponseWithStatus is the same as sendResponse but sets the status code
+// provided once all the headers have been set.
+func sendResponseWithStatus(
+	w http.ResponseWriter,
+	r *http.Request,
+	b []byte,
+	code int) error {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if getAcceptsGzip(r) == false {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b)))
+		w.WriteHeader(code)
+		_, err := w.Write(b)
+		return err
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(code)
+	z := gzip.NewWriter(w)
+	_, err := z.Write(b)
+	if err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// getAcceptsGzip returns true if the request's Accept-Encoding header includes
+// gzip with a quality value other than zero.
+func getAcceptsGzip(r *http.Request) bool {
+	for _, e := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		p := strings.Split(e, ";")
+		if strings.TrimSpace(p[0]) != "gzip" {
+			continue
+		}
+		for _, q := range p[1:] {
+			q = strings.TrimSpace(q)
+			if strings.HasPrefix(q, "q=") {
+				f, err := strconv.ParseFloat(q[2:], 32)
+				if err == nil && f == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// getDataFromRequest returns the encrypted data from the body of a POST request
+// if present, otherwise from the data form field. The body can either be form
+// encoded with a data field or contain only the data. Large data can be sent
+// in the body to avoid URL length limits. ParseForm must be called first.
+func getDataFromRequest(r *http.Request) (string, error) {
+	if r.Method == "POST" {
+		if v := r.PostForm.Get("data"); v != "" {
+			return v, nil
+		}
+		if r.Body != nil &&
+			strings.HasPrefix(
+				r.Header.Get("Content-Type"),
+				"application/x-www-form-urlencoded") == false {
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return "", err
+			}
+			if v := strings.TrimSpace(string(b)); v != "" {
+				return v, nil
+			}
+		}
+	}
+	return r.Form.Get("data"), nil
+}
+
+// limitRequestBody limits the number of bytes that can be read from the body of
+// the request to MaxRequestBytes. Reading more returns an error that responds
+// with request entity too large.
+func limitRequestBody(s *Services, w http.ResponseWriter, r *http.Request) {
+	if n := s.config.maxRequestBytes(); n > 0 && r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
 	}
 }
 
@@ -66,9 +227,7 @@ func returnServerError(s *Services, w http.ResponseWriter, err error) {
 	} else {
 		http.Error(w, "", http.StatusInternalServerError)
 	}
-	if s.config.Debug {
-		println(err.Error())
-	}
+	s.logger.Error("%s", err)
 }
 
 func getStorageNode(s *Services, r *http.Request) (*node, error) {
@@ -82,12 +241,19 @@ func getAccessNode(s *Services, r *http.Request) (*node, error) {
 func getNodeFromRequest(s *Services, r *http.Request, q int) (*node, error) {
 
 	// Get the node associated with the request.
-	n, err := s.store.getNode(r.Host)
+	n, err := s.store.getNode(r.Context(), r.Host)
 	if err != nil {
 		return nil, err
 	}
 
+	if n == nil {
+		return nil, fmt.Errorf("Host '%s': %w", r.Host, ErrNotSwiftNode)
+	}
+
 	// Verify that this node is the right type.
+	if n.role != q && q == roleAccess {
+		return nil, fmt.Errorf("Node '%s': %w", n.domain, ErrNotAccessNode)
+	}
 	if n.role != q {
 		return nil, fmt.Errorf("Node '%s' incorrect type", n.domain)
 	}
@@ -0,0 +1,93 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIErrorServerHidden(t *testing.T) {
+	s, _, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.Debug = false
+	s.store = &failingStoreTest{s.store}
+
+	// A store failure is a server error that includes internal details.
+	r := newDecodeRequestTest("data")
+	w := testDecode(s, r)
+	if w.Code != http.StatusInternalServerError {
+		fmt.Printf("Expected '%d' but got '%d'\n",
+			http.StatusInternalServerError,
+			w.Code)
+		t.Fail()
+		return
+	}
+	if strings.Contains(w.Body.String(), "store.internal") ||
+		strings.TrimSpace(w.Body.String()) !=
+			http.StatusText(http.StatusInternalServerError) {
+		fmt.Printf("Body '%s' should not contain details\n", w.Body.String())
+		t.Fail()
+	}
+
+	// With debug enabled the details are returned.
+	s.config.Debug = true
+	w = testDecode(s, r)
+	if strings.Contains(w.Body.String(), "store.internal") == false {
+		fmt.Printf("Body '%s' should contain details\n", w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestAPIErrorClientExplained(t *testing.T) {
+	s, _, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.Debug = false
+	w := testDecode(s, newDecodeRequestTest("!"))
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+		return
+	}
+	if strings.Contains(w.Body.String(), "base64") == false {
+		fmt.Printf("Body '%s' should explain the error\n", w.Body.String())
+		t.Fail()
+	}
+}
+
+// failingStoreTest is a store where node lookups fail with an error that
+// contains internal details.
+type failingStoreTest struct {
+	Store
+}
+
+func (f *failingStoreTest) getNode(
+	ctx context.Context,
+	domain string) (*node, error) {
+	return nil, fmt.Errorf("Store 'store.internal' unavailable")
+}
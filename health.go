@@ -0,0 +1,81 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	nodeHealthTimeout = 2 // Seconds to wait for a node to respond
+)
+
+// CheckNodeHealth issues a HTTP request to each of the storage nodes in the
+// network and marks them as alive if a response is received that does not
+// indicate a server error.
+func (s *Services) CheckNodeHealth(network string) error {
+	ns, err := s.store.getNodes(context.Background(), network)
+	if err != nil {
+		return err
+	}
+	if ns == nil {
+		return fmt.Errorf("Network '%s' does not exist", network)
+	}
+	c := http.Client{Timeout: time.Second * nodeHealthTimeout}
+	for _, n := range ns.all {
+		if n.role == roleStorage {
+			n.setAlive(s.getNodeReachable(&c, n))
+		}
+	}
+	return nil
+}
+
+// StartNodeHealth checks the health of the nodes in the network every
+// NodeHealthInterval seconds until the stop channel is closed. If the interval
+// is not configured then no checks are performed.
+func (s *Services) StartNodeHealth(network string, stop <-chan struct{}) {
+	if s.config.NodeHealthInterval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(time.Second * s.config.NodeHealthInterval)
+		defer t.Stop()
+		for {
+			err := s.CheckNodeHealth(network)
+			if err != nil {
+				s.logger.Warn("Node health check failed: %s", err)
+			}
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+func (s *Services) getNodeReachable(c *http.Client, n *node) bool {
+	r, err := c.Head(s.getNodeURL(n.domain, "/"))
+	if err != nil {
+		return false
+	}
+	r.Body.Close()
+	return r.StatusCode < http.StatusInternalServerError
+}
@@ -0,0 +1,136 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCheckNodeHealth(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer bad.Close()
+	v := newVolatile()
+	g, err := v.testAddNode(testNetwork, testServerHost(good), roleStorage)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b, err := v.testAddNode(testNetwork, testServerHost(bad), roleStorage)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b.setAlive(true)
+	s, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.Scheme = "http"
+	err = s.CheckNodeHealth(testNetwork)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if g.isAlive() == false {
+		fmt.Printf("Node '%s' should be alive\n", g.domain)
+		t.Fail()
+	}
+	if b.isAlive() {
+		fmt.Printf("Node '%s' should not be alive\n", b.domain)
+		t.Fail()
+	}
+}
+
+func TestCheckNodeHealthMissingNetwork(t *testing.T) {
+	s, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if s.CheckNodeHealth("missing") == nil {
+		fmt.Println("Missing network should return an error")
+		t.Fail()
+	}
+}
+
+func TestHomeNodePrefersAlive(t *testing.T) {
+	v, err := newVolatileNetworkTest(10)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	ns, err := v.getNodes(context.Background(), testNetwork)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// With no nodes alive the hashed node is used.
+	h, err := ns.getHomeNode("", "192.168.0.1")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Mark only a different node as alive and check that it is now used.
+	var a *node
+	for _, n := range ns.hash {
+		if n != h {
+			a = n
+			break
+		}
+	}
+	a.setAlive(true)
+	n, err := ns.getHomeNode("", "192.168.0.1")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if n != a {
+		fmt.Printf("Expected '%s' but got '%s'\n", a.domain, n.domain)
+		t.Fail()
+	}
+}
+
+// testServerHost returns the host and port of the test server.
+func testServerHost(s *httptest.Server) string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
@@ -0,0 +1,168 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The number of points on the ring for each node used by default with
+// consistent hashing.
+const defaultHashReplicas = 160
+
+// HomeNodeStrategy decides which storage node is the home node for a remote
+// address. If no strategy is set on the services then the node with the FNV
+// hash closest to the hash of the address is used, which can change the home
+// node for many addresses when a node is added or removed.
+type HomeNodeStrategy interface {
+	// Order returns the domains provided in the order they should be
+	// considered as the home node for the address. The first domain that is
+	// active and alive is used. The address is the IP address of the remote
+	// client or an empty string if not known.
+	Order(address string, domains []string) []string
+}
+
+// hashedDomains sorts domains by their hash values.
+type hashedDomains struct {
+	hashes  []uint32
+	domains []string
+}
+
+func (h hashedDomains) Len() int           { return len(h.hashes) }
+func (h hashedDomains) Less(i, j int) bool { return h.hashes[i] < h.hashes[j] }
+func (h hashedDomains) Swap(i, j int) {
+	h.hashes[i], h.hashes[j] = h.hashes[j], h.hashes[i]
+	h.domains[i], h.domains[j] = h.domains[j], h.domains[i]
+}
+
+// consistentHomeNodeStrategy places each node at many points on a ring. The
+// home node for an address is the node at the first point after the hash of
+// the address. Adding or removing a node only changes the home node for the
+// addresses nearest to the points of that node.
+type consistentHomeNodeStrategy struct {
+	replicas int         // The number of points for each node
+	key      string      // The domains the ring was built from
+	ring     hashedRing  // The points on the ring for the domains
+	mutex    *sync.Mutex // Guards the ring and key
+}
+
+// NewConsistentHomeNodeStrategy returns a home node strategy that uses
+// consistent hashing so that few addresses are assigned a different home node
+// when the nodes in the network change. Replicas is the number of points on the
+// ring for each node. Zero uses the default of 160.
+func NewConsistentHomeNodeStrategy(replicas int) HomeNodeStrategy {
+	if replicas <= 0 {
+		replicas = defaultHashReplicas
+	}
+	return &consistentHomeNodeStrategy{replicas: replicas, mutex: &sync.Mutex{}}
+}
+
+func (c *consistentHomeNodeStrategy) Order(
+	address string,
+	domains []string) []string {
+	r := c.getRing(domains)
+	if len(r.hashes) == 0 {
+		return nil
+	}
+	a := getRingHash(address)
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= a
+	})
+
+	// Walk the ring from the point found adding each domain the first time it
+	// is encountered.
+	o := make([]string, 0, len(domains))
+	f := make(map[string]bool, len(domains))
+	for j := 0; j < len(r.hashes) && len(o) < len(domains); j++ {
+		d := r.domains[(i+j)%len(r.hashes)]
+		if f[d] == false {
+			f[d] = true
+			o = append(o, d)
+		}
+	}
+	return o
+}
+
+// hashedRing contains the points on the ring in hash order.
+type hashedRing hashedDomains
+
+// getRing returns the ring for the domains reusing the previous ring if the
+// domains have not changed.
+func (c *consistentHomeNodeStrategy) getRing(domains []string) hashedRing {
+	k := strings.Join(domains, networkSeparator)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.key == k && c.ring.hashes != nil {
+		return c.ring
+	}
+	var r hashedRing
+	for _, d := range domains {
+		for i := 0; i < c.replicas; i++ {
+			r.hashes = append(r.hashes, getRingHash(d+"-"+strconv.Itoa(i)))
+			r.domains = append(r.domains, d)
+		}
+	}
+	sort.Sort(hashedDomains(r))
+	c.key = k
+	c.ring = r
+	return r
+}
+
+// getRingHash returns a uniformly distributed hash of the value.
+func getRingHash(v string) uint32 {
+	h := sha256.Sum256([]byte(v))
+	return binary.BigEndian.Uint32(h[:4])
+}
+
+// HomeNodeForIP returns the domain of the storage node that would be the home
+// node for a storage operation started in the network by a client with the IP
+// address provided. Used to analyze how addresses are distributed across the
+// nodes without creating storage operations. The same strategy and preference
+// for nodes that are alive are used as when an operation is created so the
+// result can change as nodes become unreachable.
+func (s *Services) HomeNodeForIP(network, ip string) (string, error) {
+	a := net.ParseIP(ip)
+	if a == nil {
+		return "", fmt.Errorf("IP address '%s' invalid", ip)
+	}
+
+	// IPv6 addresses are bracketed as they are in a request's remote address.
+	ra := a.String()
+	if a.To4() == nil {
+		ra = "[" + ra + "]"
+	}
+	ns, err := s.store.getNodes(context.Background(), network)
+	if err != nil {
+		return "", err
+	}
+	if ns == nil {
+		return "", fmt.Errorf("Network '%s' does not exist", network)
+	}
+	n, err := ns.getHomeNodeByStrategy(s.homeNode, "", ra)
+	if err != nil {
+		return "", err
+	}
+	return n.domain, nil
+}
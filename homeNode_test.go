@@ -0,0 +1,198 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHomeNodeConsistentAddNode(t *testing.T) {
+	h := NewConsistentHomeNodeStrategy(0)
+	d, err := testHomeNodeReassigned(nil)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c, err := testHomeNodeReassigned(h)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Adding one node to ten should ideally reassign one in eleven addresses.
+	if c > testHomeNodeAddresses*2/11 {
+		fmt.Printf("Consistent hashing reassigned '%d' addresses\n", c)
+		t.Fail()
+	}
+	if c*2 > d {
+		fmt.Printf("Consistent hashing reassigned '%d' addresses which is "+
+			"not far fewer than the default '%d'\n", c, d)
+		t.Fail()
+	}
+}
+
+func TestHomeNodeConsistentSkipsExpired(t *testing.T) {
+	ns, err := newNodesTest(10)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	h := NewConsistentHomeNodeStrategy(0)
+	a, err := ns.getHomeNodeByStrategy(h, "", "10.0.0.1")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The same node is returned each time for the address.
+	b, err := ns.getHomeNodeByStrategy(h, "", "10.0.0.1")
+	if err != nil || a != b {
+		fmt.Println("Home node should be the same for the same address")
+		t.Fail()
+		return
+	}
+
+	// If the node expires another is used.
+	a.expires = time.Now().UTC().Add(-time.Hour)
+	b, err = ns.getHomeNodeByStrategy(h, "", "10.0.0.1")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if a == b {
+		fmt.Println("Expired node should not be the home node")
+		t.Fail()
+	}
+}
+
+func TestHomeNodeForIP(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, a := range []string{"10.1.2.3", "172.16.0.9", "2001:db8::1"} {
+		d, err := s.HomeNodeForIP(testNetwork, a)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		e, err := s.HomeNodeForIP(testNetwork, a)
+		if err != nil || d != e {
+			fmt.Printf("Address '%s' mapped to '%s' and '%s'\n", a, d, e)
+			t.Fail()
+		}
+
+		// The home node must be the one selected for a storage operation.
+		r := newCreateRequestTest(newCreateValuesTest())
+		r.RemoteAddr = net.JoinHostPort(a, "1234")
+		o, _, err := createURL(s, r)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if o.homeNode != d {
+			fmt.Printf("Expected '%s' but operation used '%s'\n", d, o.homeNode)
+			t.Fail()
+		}
+	}
+}
+
+func TestHomeNodeForIPInvalid(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if _, err = s.HomeNodeForIP(testNetwork, "not an ip"); err == nil {
+		fmt.Println("Invalid IP address should fail")
+		t.Fail()
+	}
+	if _, err = s.HomeNodeForIP("missing", "10.1.2.3"); err == nil {
+		fmt.Println("Unknown network should fail")
+		t.Fail()
+	}
+}
+
+// The number of addresses used to test reassignment.
+const testHomeNodeAddresses = 2000
+
+// testHomeNodeReassigned returns the number of addresses that have a different
+// home node after a node is added to a network of ten nodes.
+func testHomeNodeReassigned(h HomeNodeStrategy) (int, error) {
+	v := newVolatile()
+	for i := 0; i < 10; i++ {
+		_, err := v.testAddNode(
+			testNetwork,
+			fmt.Sprintf("storage-%d.com", i),
+			roleStorage)
+		if err != nil {
+			return 0, err
+		}
+	}
+	b, err := testHomeNodeAssign(v, h)
+	if err != nil {
+		return 0, err
+	}
+	_, err = v.testAddNode(testNetwork, "storage-new.com", roleStorage)
+	if err != nil {
+		return 0, err
+	}
+	a, err := testHomeNodeAssign(v, h)
+	if err != nil {
+		return 0, err
+	}
+	c := 0
+	for k, d := range b {
+		if a[k] != d {
+			c++
+		}
+	}
+	return c, nil
+}
+
+func testHomeNodeAssign(v *Volatile, h HomeNodeStrategy) (
+	map[string]string,
+	error) {
+	ns, err := v.getNodes(context.Background(), testNetwork)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	for i := 0; i < testHomeNodeAddresses; i++ {
+		a := fmt.Sprintf("10.%d.%d.%d", i/65536, (i/256)%256, i%256)
+		n, err := ns.getHomeNodeByStrategy(h, "", a)
+		if err != nil {
+			return nil, err
+		}
+		m[a] = n.domain
+	}
+	return m, nil
+}
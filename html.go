@@ -52,7 +52,7 @@ func (h *HTML) write(b *bytes.Buffer) error {
 	return nil
 }
 
-func (h *HTML) set(b *bytes.Buffer) error {
+func (h *HTML) set(b byteReader) error {
 	var err error
 	h.Title, err = readString(b)
 	if err != nil {
@@ -214,7 +214,7 @@ var registerTemplate = newHTMLTemplate("register", `
 			<td>
 				<p><input type="radio" id="access" name="role" value="0" {{if .ReadOnly}}disabled{{end}} {{if eq .Role 0}}checked{{end}}></p>
 			</td>
-			<td rowspan="2">
+			<td rowspan="3">
 				{{if .DisplayErrors}}
 				<p>{{.RoleError}}</p>
 				{{end}}
@@ -228,6 +228,14 @@ var registerTemplate = newHTMLTemplate("register", `
 				<p><input type="radio" id="storage" name="role" value="1" {{if .ReadOnly}}disabled{{end}} {{if eq .Role 1}}checked{{end}}></p>
 			</td>
 		</tr>
+		<tr>
+			<td>
+				<p><label for="2">Observer Node</label></p>
+			</td>
+			<td>
+				<p><input type="radio" id="observer" name="role" value="2" {{if .ReadOnly}}disabled{{end}} {{if eq .Role 2}}checked{{end}}></p>
+			</td>
+		</tr>
 		<tr>
 			<td colspan="3">
 				{{if .DisplayErrors}}
@@ -316,6 +324,73 @@ var warningTemplate = newHTMLTemplate("warning", `
 </body>
 </html>`)
 
+var browserWarningTemplate = newHTMLTemplate("browserWarning", `
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8" />
+	<title>{{.Title}}</title>
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<link rel="icon" href="data:;base64,=">
+</head>
+<body style="margin: 0;
+	padding: 0;
+	font-family: nunito, sans-serif;
+	font-size: 16px;
+	font-weight: 600;
+	background-color: {{.BackgroundColor}};
+	color: {{.MessageColor}};
+	height: 100vh;         
+	display: flex;
+	justify-content: center;
+	align-items: center;">
+	<table style="text-align: center; background-color: white; padding: 1em; border: solid black 2px;">
+		<tr>
+			<td>
+				{{.BrowserWarning}}
+			</td>
+		</tr>
+		<tr>
+			<td style="padding: 0.5em;">
+				<a href="{{.NextURL}}" style="display: inline; padding: 0.5em; background-color:black; text-decoration: none; color: white; border: none;">Continue</a>
+			</td>
+		</tr>
+		{{if .Debug}}
+		<tr>
+			<td>
+				<style>
+					.debug {
+						text-align:left;
+						font-weight:initial;
+					}
+					.debug tr td {
+						word-wrap:break-word;
+						word-break:break-all;
+					}
+				</style>
+				<table class="debug">
+					<tr><th>TimeStamp:</th><td>{{.TimeStamp}}</td></tr>
+					<tr><th>TimeValid:</th><td>{{.IsTimeStampValid}}</td></tr>
+					<tr><th>ReturnUrl:</th><td>{{.ReturnURL}}</td></tr>
+					<tr><th>AccessNode:</th><td>{{.AccessNode}}</td></tr>
+					<tr><th>HomeNode:</th><td>{{.HomeNode}}</td></tr>
+					<tr><th>NodesVisited:</th><td>{{.NodesVisited}}</td></tr>
+					<tr><th>NodeCount:</th><td>{{.NodeCount}}</td></tr>
+					<tr><th>NextURL:</th><td>{{.NextURL}}</td></tr>
+				</table>
+				<table class="debug">
+				<tr><th>Key</th><th>Value</th><th>Created</th><th>Expires</th><th>Conflict</th></tr>
+				{{range .Values}} 
+				<tr><td>{{.Key}}</td><td>{{.Value}}</td><td>{{.Created}}</td><td>{{.Expires}}</td><td>{{.Conflict}}</td></tr>
+				{{end}}
+				</table>
+			</td>
+		</tr>
+		{{end}}
+	</table>
+</body>
+</html>`)
+
 func newHTMLTemplate(n string, h string) *template.Template {
 	c := removeHTMLWhiteSpace(h)
 	return template.Must(template.New(n).Parse(c))
@@ -20,13 +20,22 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"time"
 )
 
 // The base year for all dates encoded with the io time methods.
 var ioDateBase = time.Date(2020, time.Month(1), 1, 0, 0, 0, 0, time.UTC)
 
-func readString(b *bytes.Buffer) (string, error) {
+// byteReader is implemented by bytes.Buffer and bufio.Reader. Used by the read
+// methods so that data can be read from a byte array or a stream.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+	ReadBytes(delim byte) ([]byte, error)
+}
+
+func readString(b byteReader) (string, error) {
 	s, err := b.ReadBytes(0)
 	if err == nil {
 		return string(s[0 : len(s)-1]), err
@@ -34,12 +43,20 @@ func readString(b *bytes.Buffer) (string, error) {
 	return "", err
 }
 
-func readByteArray(b *bytes.Buffer) ([]byte, error) {
+func readByteArray(b byteReader) ([]byte, error) {
 	l, err := readUint32(b)
 	if err != nil {
 		return nil, err
 	}
-	return b.Next(int(l)), err
+	var d bytes.Buffer
+	c, err := io.CopyN(&d, b, int64(l))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"'%d' bytes incorrect for byte array of length '%d'",
+			c,
+			l)
+	}
+	return d.Bytes(), nil
 }
 
 func writeByteArray(b *bytes.Buffer, v []byte) error {
@@ -59,7 +76,7 @@ func writeByteArray(b *bytes.Buffer, v []byte) error {
 	return err
 }
 
-func readTime(b *bytes.Buffer) (time.Time, error) {
+func readTime(b byteReader) (time.Time, error) {
 	var t time.Time
 	d, err := readByteArray(b)
 	if err == nil {
@@ -76,7 +93,7 @@ func writeTime(b *bytes.Buffer, t time.Time) error {
 	return writeByteArray(b, d)
 }
 
-func readDate(b *bytes.Buffer) (time.Time, error) {
+func readDate(b byteReader) (time.Time, error) {
 	h, err := b.ReadByte()
 	if err != nil {
 		return time.Time{}, err
@@ -98,22 +115,23 @@ func writeDate(b *bytes.Buffer, t time.Time) error {
 	return writeByte(b, byte(i&0x00FF))
 }
 
-func readByte(b *bytes.Buffer) (byte, error) {
-	d := b.Next(1)
-	if len(d) != 1 {
-		return 0, fmt.Errorf("'%d' bytes incorrect for Byte", len(d))
+func readByte(b byteReader) (byte, error) {
+	d, err := b.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("'0' bytes incorrect for Byte")
 	}
-	return d[0], nil
+	return d, nil
 }
 
 func writeByte(b *bytes.Buffer, i byte) error {
 	return b.WriteByte(i)
 }
 
-func readUint64(b *bytes.Buffer) (uint64, error) {
-	d := b.Next(8)
-	if len(d) != 8 {
-		return 0, fmt.Errorf("'%d' bytes incorrect for Uint64", len(d))
+func readUint64(b byteReader) (uint64, error) {
+	d := make([]byte, 8)
+	l, err := io.ReadFull(b, d)
+	if err != nil {
+		return 0, fmt.Errorf("'%d' bytes incorrect for Uint64", l)
 	}
 	return binary.LittleEndian.Uint64(d), nil
 }
@@ -133,10 +151,11 @@ func writeUint64(b *bytes.Buffer, i uint64) error {
 	return err
 }
 
-func readUint32(b *bytes.Buffer) (uint32, error) {
-	d := b.Next(4)
-	if len(d) != 4 {
-		return 0, fmt.Errorf("'%d' bytes incorrect for Uint32", len(d))
+func readUint32(b byteReader) (uint32, error) {
+	d := make([]byte, 4)
+	l, err := io.ReadFull(b, d)
+	if err != nil {
+		return 0, fmt.Errorf("'%d' bytes incorrect for Uint32", l)
 	}
 	return binary.LittleEndian.Uint32(d), nil
 }
@@ -0,0 +1,64 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import "log"
+
+// Logger interface for recording messages from the SWIFT handlers at different
+// levels. An implementation can be provided to Services to direct the messages
+// to a structured logging system. The format and values are the same as those
+// used with fmt.Printf.
+type Logger interface {
+
+	// Debug is used for information that is only needed when diagnosing
+	// problems.
+	Debug(format string, v ...interface{})
+
+	// Info is used for information about normal operation.
+	Info(format string, v ...interface{})
+
+	// Warn is used when something unexpected happened that can be recovered
+	// from.
+	Warn(format string, v ...interface{})
+
+	// Error is used when a request could not be completed.
+	Error(format string, v ...interface{})
+}
+
+// stdLogger is the default implementation of Logger that uses the standard log
+// package. Debug messages are only written if debug is true.
+type stdLogger struct {
+	debug bool
+}
+
+func (l stdLogger) Debug(format string, v ...interface{}) {
+	if l.debug {
+		log.Printf("SWIFT:DEBUG: "+format, v...)
+	}
+}
+
+func (l stdLogger) Info(format string, v ...interface{}) {
+	log.Printf("SWIFT:INFO: "+format, v...)
+}
+
+func (l stdLogger) Warn(format string, v ...interface{}) {
+	log.Printf("SWIFT:WARN: "+format, v...)
+}
+
+func (l stdLogger) Error(format string, v ...interface{}) {
+	log.Printf("SWIFT:ERROR: "+format, v...)
+}
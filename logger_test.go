@@ -0,0 +1,104 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// loggerTest captures the messages logged at each level.
+type loggerTest struct {
+	messages map[string][]string
+}
+
+func newLoggerTest() *loggerTest {
+	return &loggerTest{make(map[string][]string)}
+}
+
+func (l *loggerTest) log(level string, format string, v ...interface{}) {
+	l.messages[level] = append(l.messages[level], fmt.Sprintf(format, v...))
+}
+
+func (l *loggerTest) Debug(format string, v ...interface{}) {
+	l.log("debug", format, v...)
+}
+
+func (l *loggerTest) Info(format string, v ...interface{}) {
+	l.log("info", format, v...)
+}
+
+func (l *loggerTest) Warn(format string, v ...interface{}) {
+	l.log("warn", format, v...)
+}
+
+func (l *loggerTest) Error(format string, v ...interface{}) {
+	l.log("error", format, v...)
+}
+
+func TestLoggerDecodeError(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	l := newLoggerTest()
+	s.SetLogger(l)
+	d, err := testEncryptResults(n, newResultsTest(1))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// A valid decode does not log an error.
+	w := testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusOK || len(l.messages["error"]) != 0 {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+
+	// Corrupt data logs an error.
+	w = testDecode(s, newDecodeRequestTest(testCorrupt(d)))
+	if w.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+	if len(l.messages["error"]) != 1 ||
+		strings.Contains(l.messages["error"][0], "decoded") == false {
+		fmt.Println(l.messages)
+		t.Fail()
+	}
+}
+
+func TestLoggerDefault(t *testing.T) {
+	s, _, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.SetLogger(nil)
+	if _, ok := s.logger.(stdLogger); ok == false {
+		fmt.Println("Standard logger should be used when nil is set")
+		t.Fail()
+	}
+}
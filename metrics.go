@@ -0,0 +1,51 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import "time"
+
+// Metrics interface for recording the activity of the SWIFT handlers. An
+// implementation can be provided to Services to expose the metrics to a
+// monitoring system such as Prometheus.
+type Metrics interface {
+
+	// IncCreated is called when a storage operation is created.
+	IncCreated()
+
+	// IncDecoded is called when results are successfully decoded.
+	IncDecoded()
+
+	// IncDecodeError is called when results could not be decoded.
+	IncDecodeError()
+
+	// ObserveDecryptDuration is called with the time taken to decrypt results.
+	ObserveDecryptDuration(d time.Duration)
+
+	// IncCookieDecryptError is called with the domain of the node when a
+	// cookie value could not be decrypted with any of the node's secrets. An
+	// increasing count usually means secrets were rotated incorrectly.
+	IncCookieDecryptError(domain string)
+}
+
+// noMetrics is the default implementation of Metrics that discards the values.
+type noMetrics struct{}
+
+func (noMetrics) IncCreated()                            {}
+func (noMetrics) IncDecoded()                            {}
+func (noMetrics) IncDecodeError()                        {}
+func (noMetrics) ObserveDecryptDuration(d time.Duration) {}
+func (noMetrics) IncCookieDecryptError(domain string)    {}
@@ -0,0 +1,184 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// metricsTest counts the calls made to the metrics interface.
+type metricsTest struct {
+	created     int
+	decoded     int
+	decodeError int
+	decrypts    int
+	cookies     map[string]int
+}
+
+func (m *metricsTest) IncCreated()     { m.created++ }
+func (m *metricsTest) IncDecoded()     { m.decoded++ }
+func (m *metricsTest) IncDecodeError() { m.decodeError++ }
+func (m *metricsTest) ObserveDecryptDuration(d time.Duration) {
+	m.decrypts++
+}
+func (m *metricsTest) IncCookieDecryptError(domain string) {
+	if m.cookies == nil {
+		m.cookies = make(map[string]int)
+	}
+	m.cookies[domain]++
+}
+
+func TestMetricsCreate(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	var m metricsTest
+	s.SetMetrics(&m)
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	w := testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	q.Del(tableParam)
+	testCreate(s, q)
+	if m.created != 1 {
+		fmt.Printf("Expected 1 created but got %d\n", m.created)
+		t.Fail()
+	}
+}
+
+func TestMetricsDecode(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	var m metricsTest
+	s.SetMetrics(&m)
+	d, err := testEncryptResults(n, newResultsTest(1))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testDecode(s, newDecodeRequestTest(d))
+	testDecode(s, newDecodeRequestTest(testCorrupt(d)))
+	testDecode(s, newDecodeRequestTest("!"+d))
+	if m.decoded != 1 {
+		fmt.Printf("Expected 1 decoded but got %d\n", m.decoded)
+		t.Fail()
+	}
+	if m.decodeError != 2 {
+		fmt.Printf("Expected 2 decode errors but got %d\n", m.decodeError)
+		t.Fail()
+	}
+	if m.decrypts != 2 {
+		fmt.Printf("Expected 2 decrypt durations but got %d\n", m.decrypts)
+		t.Fail()
+	}
+}
+
+func TestMetricsCookieDecryptError(t *testing.T) {
+	s, u, err := newStoreEndTest(time.Minute)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	var m metricsTest
+	s.SetMetrics(&m)
+	o, err := testOperationFromURL(s, u)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Write the cookie with a secret the node does not have.
+	x, err := newSecret(time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n := *o.thisNode
+	n.secrets = []*secret{x}
+	o.thisNode = &n
+	c := httptest.NewRecorder()
+	err = o.setValueInCookie(c, o.request, o.values[0])
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := httptest.NewRequest("GET", u, nil)
+	for _, v := range c.Result().Cookies() {
+		r.AddCookie(v)
+	}
+
+	// The error explains that all the secrets were tried.
+	h, err := s.store.getNode(r.Context(), r.Host)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, err = h.getValueFromCookie(r, r.Cookies()[0], "")
+	if errors.Is(err, ErrDecryptFailed) == false ||
+		strings.Contains(err.Error(), "tried 1 secrets") == false ||
+		strings.Contains(err.Error(), h.domain) == false {
+		fmt.Printf("Error '%v' not informative\n", err)
+		t.Fail()
+	}
+
+	// The operation still completes and the failure is counted for the node.
+	w := httptest.NewRecorder()
+	HandlerStore(s, nil)(w, r)
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusOK, w.Code)
+		t.Fail()
+	}
+	if m.cookies[h.domain] != 1 {
+		fmt.Printf("Expected 1 cookie error but got %d\n", m.cookies[h.domain])
+		t.Fail()
+	}
+}
+
+// testCorrupt returns the base64 data string with one of the characters
+// changed so that it still decodes but will not decrypt.
+func testCorrupt(d string) string {
+	b := []byte(d)
+	if b[20] == 'A' {
+		b[20] = 'B'
+	} else {
+		b[20] = 'A'
+	}
+	return string(b)
+}
@@ -18,21 +18,62 @@ package swift
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"hash/fnv"
 	"net/http"
 	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	roleAccess  = iota // The node responds to server initiated access requests
-	roleStorage = iota // The node can be used for storage operations
+	roleAccess   = iota // The node responds to server initiated access requests
+	roleStorage  = iota // The node can be used for storage operations
+	roleObserver = iota // The node can inspect data but never stores it
 )
 
+// The message used when a role is not one of the valid roles.
+const roleInvalidMessage = "Role '%d' invalid, must be 0 (access), " +
+	"1 (storage) or 2 (observer)"
+
+// isValidRole returns true if the role is one of the node roles.
+func isValidRole(r int) bool {
+	return r == roleAccess || r == roleStorage || r == roleObserver
+}
+
+// The weight of a node when none has been set. Nodes with a weight of zero are
+// never home nodes.
+const defaultNodeWeight = 1
+
+// getWeight returns the weight provided or the default weight if nil. Used
+// when reading nodes persisted before the weight was added.
+func getWeight(w *int) int {
+	if w == nil {
+		return defaultNodeWeight
+	}
+	return *w
+}
+
+// Separates the network names when a node belongs to more than one network.
+const networkSeparator = ","
+
+const (
+	// Scrambled values encrypted with a nonce formed from the repeated domain
+	// bytes. These do not start with a version byte.
+	scrambleVersionLegacy = iota
+	// Scrambled values encrypted with a nonce derived from a hash of the domain
+	// and scrambler key. These start with the version byte.
+	scrambleVersionHash = iota
+)
+
+// The version used when scrambling new values.
+const scrambleVersionCurrent = scrambleVersionHash
+
 type node struct {
-	network   string    // The name of the network the node belongs to
+	networks  []string  // The names of the networks the node belongs to
 	domain    string    // The domain name associated with the node
 	hash      uint32    // Number used to relate client IPs to node
 	created   time.Time // The time that the node first came online
@@ -41,11 +82,17 @@ type node struct {
 	secrets   []*secret // All the secrets associated with the node
 	scrambler *secret   // Secret used to scramble data with fixed nonce
 	nonce     []byte    // Fixed nonce used with the scrambler
-	alive     bool      // True if the node is reachable via a HTTP request
+	legacy    []byte    // Fixed nonce used with the legacy scrambler
+	alive     int32     // 1 if the node is reachable via a HTTP request
+	clock     Clock     // Source of the current time, or nil for the system
+	weight    int       // Relative capacity when selecting the home node
+	retiring  bool      // True if the node is being retired from the network
 }
 
 func (n *node) Domain() string { return n.domain }
 
+// newNode creates a new node. The network is the name of the network the node
+// belongs to, or a list of network names separated by networkSeparator.
 func newNode(
 	network string,
 	domain string,
@@ -60,7 +107,7 @@ func newNode(
 		return nil, err
 	}
 	n := node{
-		network,
+		parseNetworks(network),
 		domain,
 		h.Sum32(),
 		created,
@@ -69,11 +116,27 @@ func newNode(
 		make([]*secret, 0),
 		s,
 		makeNonce(s, []byte(domain)),
+		makeLegacyNonce(s, []byte(domain)),
+		0,
+		nil,
+		defaultNodeWeight,
 		false}
 	return &n, nil
 }
 
+// makeNonce returns a fixed nonce for the scrambler that is uniformly
+// distributed. The SHA-256 hash of the domain and the scrambler key is
+// truncated to the nonce size.
 func makeNonce(s *secret, d []byte) []byte {
+	h := sha256.New()
+	h.Write(d)
+	h.Write([]byte(s.key))
+	return h.Sum(nil)[:s.crypto.gcm.NonceSize()]
+}
+
+// makeLegacyNonce returns the fixed nonce formed by repeating the domain bytes
+// that was used before scrambled values included a version byte.
+func makeLegacyNonce(s *secret, d []byte) []byte {
 	n := make([]byte, s.crypto.gcm.NonceSize())
 	c := 0
 	for i := 0; i < len(n); i++ {
@@ -86,53 +149,306 @@ func makeNonce(s *secret, d []byte) []byte {
 	return n
 }
 
+// parseNetworks returns the distinct network names in the list provided.
+func parseNetworks(s string) []string {
+	var a []string
+	for _, v := range strings.Split(s, networkSeparator) {
+		v = strings.TrimSpace(v)
+		f := false
+		for _, e := range a {
+			if e == v {
+				f = true
+				break
+			}
+		}
+		if v != "" && f == false {
+			a = append(a, v)
+		}
+	}
+	return a
+}
+
+// joinNetworks returns the network names as a single string in the form used
+// when the node is persisted.
+func joinNetworks(a []string) string {
+	return strings.Join(a, networkSeparator)
+}
+
+// getNetwork returns the network names as a single string in the form used
+// when the node is persisted.
+func (n *node) getNetwork() string {
+	return joinNetworks(n.networks)
+}
+
+// inNetwork returns true if the node belongs to the network.
+func (n *node) inNetwork(network string) bool {
+	for _, v := range n.networks {
+		if v == network {
+			return true
+		}
+	}
+	return false
+}
+
+// now returns the current UTC time from the node's clock.
+func (n *node) now() time.Time {
+	return nowFrom(n.clock)
+}
+
+// homeWeight returns the weight used when selecting the home node. Observer and
+// retiring nodes are never home nodes.
+func (n *node) homeWeight() int {
+	if n.role == roleObserver || n.retiring {
+		return 0
+	}
+	return n.weight
+}
+
 func (n *node) isActive() bool {
-	return n.expires.After(time.Now().UTC()) && len(n.secrets) > 0
+	return n.expires.After(n.now()) && len(n.secrets) > 0
+}
+
+// isAlive returns true if the last health check found the node reachable.
+func (n *node) isAlive() bool {
+	return atomic.LoadInt32(&n.alive) == 1
 }
 
+// setAlive records the result of a health check against the node.
+func (n *node) setAlive(alive bool) {
+	var v int32
+	if alive {
+		v = 1
+	}
+	atomic.StoreInt32(&n.alive, v)
+}
+
+// copy returns a copy of the node with its own secrets so that the copy can be
+// altered and stored while other requests continue to use the node.
+func (n *node) copy() *node {
+	c := node{
+		networks:  n.networks,
+		domain:    n.domain,
+		hash:      n.hash,
+		created:   n.created,
+		expires:   n.expires,
+		role:      n.role,
+		secrets:   append([]*secret(nil), n.secrets...),
+		scrambler: n.scrambler,
+		nonce:     n.nonce,
+		legacy:    n.legacy,
+		alive:     atomic.LoadInt32(&n.alive),
+		clock:     n.clock,
+		weight:    n.weight,
+		retiring:  n.retiring}
+	return &c
+}
+
+// unscramble returns the value scrambled with any of the encodings.
 func (n *node) unscramble(s string) (string, error) {
-	b, err := base64.RawURLEncoding.DecodeString(s)
+	b, err := decodeValue(s)
 	if err != nil {
 		return "", err
 	}
-	d, err := n.scrambler.crypto.decrypt(b)
+	d, err := n.scrambler.crypto.decrypt(getScrambledData(b))
 	if err != nil {
 		return "", err
 	}
 	return string(d), err
 }
 
-func (n *node) scramble(s string) string {
-	return base64.RawURLEncoding.EncodeToString(
-		n.scrambler.crypto.encryptWithNonce([]byte(s), n.nonce))
+// getScrambledData returns the encrypted data from the scrambled bytes after
+// removing the version byte. Legacy values start with the first byte of the
+// domain name which can never be a version byte. Values with an absent or
+// unknown version are treated as legacy and returned unaltered.
+func getScrambledData(b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	switch b[0] {
+	case scrambleVersionHash:
+		return b[1:]
+	default:
+		return b
+	}
 }
 
-func (n *node) encrypt(d []byte) ([]byte, error) {
+// scramble returns the value encrypted with the fixed nonce so that the same
+// value always results in the same string using the encoding e.
+func (n *node) scramble(e int, s string) string {
+	b := []byte{scrambleVersionCurrent}
+	return encodeValue(e, append(
+		b,
+		n.scrambler.crypto.encryptWithNonce([]byte(s), n.nonce)...))
+}
+
+// scrambleLegacy returns the value scrambled without a version byte using the
+// legacy nonce. Used to find values written before the version byte was added.
+func (n *node) scrambleLegacy(s string) string {
+	return n.scrambleLegacyEncoded(encodingBase64URL, s)
+}
+
+// scrambleLegacyEncoded returns the value scrambled in the same way as
+// scrambleLegacy using the encoding e.
+func (n *node) scrambleLegacyEncoded(e int, s string) string {
+	return encodeValue(
+		e,
+		n.scrambler.crypto.encryptWithNonce([]byte(s), n.legacy))
+}
+
+func (n *node) encrypt(d []byte, level int) ([]byte, error) {
+	return n.encryptForTable(d, level, "")
+}
+
+// encryptForTable returns the data encrypted with a key derived from the
+// newest secret and the table. If the table is empty then the secret is used.
+func (n *node) encryptForTable(
+	d []byte,
+	level int,
+	table string) ([]byte, error) {
 	s, err := n.getSecret()
 	if err != nil {
 		return nil, err
 	}
-	return s.crypto.compressAndEncrypt(d)
+	c, err := s.getCrypto(table)
+	if err != nil {
+		return nil, err
+	}
+	return c.compressAndEncrypt(d, level)
 }
 
+// decrypt returns the data decrypted with the first of the node's secrets that
+// succeeds. If none succeed then the error wraps ErrDecryptFailed.
 func (n *node) decrypt(d []byte) ([]byte, error) {
-	var err error
-	for _, s := range n.secrets {
-		b, err := s.crypto.decryptAndDecompress(d)
+	b, _, err := n.decryptWithAttempts(d, "")
+	return b, err
+}
+
+// decryptForTable returns the data decrypted with the keys derived from the
+// node's secrets and the table. If none succeed then the secrets are tried
+// without the table so that data encrypted before table keys were used can
+// still be decrypted.
+func (n *node) decryptForTable(d []byte, table string) ([]byte, error) {
+	if table != "" {
+		b, _, err := n.decryptWithAttempts(d, table)
 		if err == nil {
 			return b, nil
 		}
 	}
-	return nil, err
+	return n.decrypt(d)
+}
+
+// decryptWithAttempts is the same as decrypt but also returns the number of
+// secrets tried. The keys derived for the table are used if the table is not
+// empty. The secrets are tried in the order from getDecryptOrder. The first is
+// found without sorting the others as it usually succeeds.
+func (n *node) decryptWithAttempts(
+	d []byte,
+	table string) ([]byte, int, error) {
+	f := n.getLikelySecret()
+	if f == nil {
+		return nil, 0, fmt.Errorf("%w: node '%s' has no secrets",
+			ErrDecryptFailed,
+			n.domain)
+	}
+	b, err := decryptWithSecret(f, d, table)
+	if err == nil {
+		f.setUsed()
+		return b, 1, nil
+	}
+	c := 1
+	for _, s := range n.getDecryptOrder() {
+		if s == f {
+			continue
+		}
+		c++
+		b, err = decryptWithSecret(s, d, table)
+		if err == nil {
+			s.setUsed()
+			return b, c, nil
+		}
+	}
+	return nil, c, fmt.Errorf(
+		"%w: node '%s' tried %d secrets, last error '%s'",
+		ErrDecryptFailed,
+		n.domain,
+		c,
+		err)
 }
 
-func (n *node) getValueFromCookie(c *http.Cookie) (*pair, error) {
+// decryptWithSecret returns the data decrypted with the secret, or the key
+// derived from the secret for the table if the table is not empty.
+func decryptWithSecret(s *secret, d []byte, table string) ([]byte, error) {
+	c, err := s.getCrypto(table)
+	if err != nil {
+		return nil, err
+	}
+	return c.decryptAndDecompress(d)
+}
+
+// getLikelySecret returns the secret that is first in the order returned by
+// getDecryptOrder, or nil if the node has no secrets.
+func (n *node) getLikelySecret() *secret {
+	var l *secret
+	var u uint64
+	for _, s := range n.secrets {
+		if s == nil {
+			continue
+		}
+		v := atomic.LoadUint64(&s.used)
+		if l == nil || v > u || (v == u && s.timeStamp.After(l.timeStamp)) {
+			l = s
+			u = v
+		}
+	}
+	return l
+}
+
+// getDecryptOrder returns the secrets in the order they should be tried when
+// decrypting. The most recently successful are first, then those not yet used
+// newest first, so the secret most likely to succeed is usually tried first.
+// The sequences are read once so that concurrent decryption does not alter the
+// order while it is sorted.
+func (n *node) getDecryptOrder() []*secret {
+	type entry struct {
+		s *secret
+		c uint64
+	}
+	a := make([]entry, 0, len(n.secrets))
+	for _, s := range n.secrets {
+		if s != nil {
+			a = append(a, entry{s, atomic.LoadUint64(&s.used)})
+		}
+	}
+	sort.SliceStable(a, func(i, j int) bool {
+		if a[i].c != a[j].c {
+			return a[i].c > a[j].c
+		}
+		return a[i].s.timeStamp.After(a[j].s.timeStamp)
+	})
+	o := make([]*secret, len(a))
+	for i, v := range a {
+		o[i] = v.s
+	}
+	return o
+}
+
+// getValueFromCookie returns the pair stored in the cookie for the table. If
+// the value is split across chunk cookies then they are read from the request.
+// The table is empty unless table keys are used.
+func (n *node) getValueFromCookie(
+	r *http.Request,
+	c *http.Cookie,
+	table string) (*pair, error) {
 	var p pair
-	v, err := base64.RawURLEncoding.DecodeString(c.Value)
+	s, err := getCookieValue(r, c)
 	if err != nil {
 		return nil, err
 	}
-	d, err := n.decrypt(v)
+	v, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	d, err := n.decryptForTable(v, table)
 	if err != nil {
 		return nil, err
 	}
@@ -158,16 +474,83 @@ func (n *node) addSecret(secret *secret) {
 	n.secrets = append(n.secrets, secret)
 }
 
+// getSecret returns the newest active secret which is used for encryption.
+// Secrets with a time stamp in the future are not yet active and are ignored.
 func (n *node) getSecret() (*secret, error) {
 	if n == nil {
 		fmt.Println("Null node")
 	}
+	var l *secret
+	t := n.now()
+	for _, s := range n.secrets {
+		if s != nil &&
+			s.timeStamp.After(t) == false &&
+			(l == nil || s.timeStamp.After(l.timeStamp)) {
+			l = s
+		}
+	}
+	if l != nil {
+		return l, nil
+	}
 	if len(n.secrets) > 0 {
-		return n.secrets[0], nil
+		return nil, fmt.Errorf("No active secrets for node '%s'", n.domain)
 	}
 	return nil, fmt.Errorf("No secrets for node '%s'", n.domain)
 }
 
+// getActiveSecretCount returns the number of secrets that are active and could
+// be used for encryption. Secrets with a time stamp in the future are not yet
+// active.
+func (n *node) getActiveSecretCount() int {
+	c := 0
+	t := n.now()
+	for _, s := range n.secrets {
+		if s != nil && s.timeStamp.After(t) == false {
+			c++
+		}
+	}
+	return c
+}
+
+// SecretStats returns the number of active and expired secrets. Expired secrets
+// have been superseded by a newer secret that is now used for encryption and
+// are only retained to decrypt older data. Active secrets are the one used for
+// encryption and any that are not yet in effect. Every expired secret is tried
+// when decrypting so a high count slows decryption.
+func (n *node) SecretStats() (active, expired int) {
+	l, err := n.getSecret()
+	for _, s := range n.secrets {
+		if s == nil {
+			continue
+		}
+		if err == nil && s.timeStamp.Before(l.timeStamp) {
+			expired++
+		} else {
+			active++
+		}
+	}
+	return active, expired
+}
+
+// rotateSecret adds the new secret which will be used for all subsequent
+// encryption. Older secrets are retained for decryption until the retirement
+// period has elapsed since they were superseded by a newer secret, after which
+// they are removed. Returns the number of secrets removed.
+func (n *node) rotateSecret(s *secret, retirement time.Duration) int {
+	n.addSecret(s)
+	n.sortSecrets()
+	t := n.now().Add(-retirement)
+	k := make([]*secret, 0, len(n.secrets))
+	for i, x := range n.secrets {
+		if i == len(n.secrets)-1 || n.secrets[i+1].timeStamp.After(t) {
+			k = append(k, x)
+		}
+	}
+	r := len(n.secrets) - len(k)
+	n.secrets = k
+	return r
+}
+
 func (n *node) sortSecrets() {
 	sort.Slice(n.secrets, func(i, j int) bool {
 		return n.secrets[i].timeStamp.Sub(n.secrets[j].timeStamp) < 0
@@ -0,0 +1,262 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MultiError contains all the problems found when validating a batch.
+type MultiError []error
+
+// Error returns the messages of all the errors separated by semi colons.
+func (m MultiError) Error() string {
+	var b bytes.Buffer
+	for i, e := range m {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(e.Error())
+	}
+	return b.String()
+}
+
+// NodeDefinition is the JSON representation of a node used to export and
+// import the nodes in a store. The scrambler key and the secret keys are the
+// key material for the node and must be protected in the same way as any other
+// secret.
+type NodeDefinition struct {
+	Networks     []string            `json:"networks"`     // Network names
+	Domain       string              `json:"domain"`       // Domain of the node
+	Role         int                 `json:"role"`         // Role in the network
+	Created      time.Time           `json:"created"`      // When first online
+	Expires      time.Time           `json:"expires"`      // When it will retire
+	ScramblerKey string              `json:"scramblerKey"` // Scrambler secret
+	Secrets      []*SecretDefinition `json:"secrets"`      // All the secrets
+	Weight       *int                `json:"weight"`       // Nil for default
+	Retiring     bool                `json:"retiring"`     // Being retired
+}
+
+// SecretDefinition is the JSON representation of a node secret.
+type SecretDefinition struct {
+	TimeStamp time.Time `json:"timeStamp"` // The time the secret became active
+	Key       string    `json:"key"`       // The key used to create the secret
+	AEAD      byte      `json:"aead"`      // The AEAD used to encrypt data
+}
+
+// ExportNodes returns all the nodes in the store as a JSON array. The output
+// includes the key material for each node.
+func (s *Services) ExportNodes() ([]byte, error) {
+	ns, err := s.store.getAllNodes(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return marshalNodes(ns)
+}
+
+// marshalNodes returns the nodes as a JSON array of node definitions.
+func marshalNodes(ns []*node) ([]byte, error) {
+	d := make([]*NodeDefinition, 0, len(ns))
+	for _, n := range ns {
+		var e NodeDefinition
+		e.Networks = n.networks
+		e.Domain = n.domain
+		e.Role = n.role
+		e.Created = n.created
+		e.Expires = n.expires
+		e.ScramblerKey = n.scrambler.key
+		w := n.weight
+		e.Weight = &w
+		e.Retiring = n.retiring
+		for _, x := range n.secrets {
+			if x != nil {
+				e.Secrets = append(
+					e.Secrets,
+					&SecretDefinition{x.timeStamp, x.key, x.crypto.aead})
+			}
+		}
+		d = append(d, &e)
+	}
+	return json.Marshal(d)
+}
+
+// unmarshalNodes returns the nodes from a JSON array of node definitions.
+// All the nodes are validated and an error returned if any are invalid or the
+// domains are not unique.
+func unmarshalNodes(data []byte) ([]*node, error) {
+	var d []*NodeDefinition
+	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return nil, err
+	}
+	ns := make([]*node, 0, len(d))
+	f := make(map[string]bool)
+	for _, e := range d {
+		n, err := e.newNode()
+		if err != nil {
+			return nil, err
+		}
+		if f[n.domain] {
+			return nil, fmt.Errorf("Domain '%s' is duplicated", n.domain)
+		}
+		f[n.domain] = true
+		ns = append(ns, n)
+	}
+	return ns, nil
+}
+
+// ImportNodes adds or updates the nodes in the JSON array provided to the
+// store. The JSON is in the same form as the output of ExportNodes. All the
+// nodes are validated before any are stored.
+func (s *Services) ImportNodes(data []byte) error {
+	ns, err := unmarshalNodes(data)
+	if err != nil {
+		return err
+	}
+	for _, n := range ns {
+		err = s.store.setNode(context.Background(), n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterNodes adds the nodes defined to the store. If the scrambler key is
+// missing a new one is created, and if there are no secrets a first secret is
+// added. A zero created time is set to the current time. The whole batch is
+// validated before any nodes are stored. Domains must be unique, roles valid,
+// the expiry after the created time, and at least one node must be an access
+// node. If there are any problems a MultiError containing all of them is
+// returned and nothing is stored.
+func (s *Services) RegisterNodes(defs []NodeDefinition) error {
+	var m MultiError
+	ns := make([]*node, 0, len(defs))
+	f := make(map[string]bool)
+	a := false
+	for i := range defs {
+		e := defs[i]
+		if e.Created.IsZero() {
+			e.Created = s.now()
+		}
+		if e.Expires.After(e.Created) == false {
+			m = append(m, fmt.Errorf(
+				"Expires for node '%s' must be after created",
+				e.Domain))
+		}
+		if f[e.Domain] {
+			m = append(m, fmt.Errorf("Domain '%s' is duplicated", e.Domain))
+		}
+		f[e.Domain] = true
+		if e.ScramblerKey == "" {
+			x, err := newSecret(s.now())
+			if err != nil {
+				return err
+			}
+			e.ScramblerKey = x.key
+		}
+		n, err := e.newNode()
+		if err != nil {
+			m = append(m, err)
+			continue
+		}
+		if len(n.secrets) == 0 {
+			x, err := newSecretWithAEAD(s.config.aead(), n.created)
+			if err != nil {
+				return err
+			}
+			n.addSecret(x)
+		}
+		if n.role == roleAccess {
+			a = true
+		}
+		ns = append(ns, n)
+	}
+	if a == false {
+		m = append(m, fmt.Errorf("At least one access node is required"))
+	}
+	if len(m) > 0 {
+		return m
+	}
+	for _, n := range ns {
+		err := s.store.setNode(context.Background(), n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newNode validates the definition and returns the node it describes.
+func (e *NodeDefinition) newNode() (*node, error) {
+	if e.Domain == "" {
+		return nil, fmt.Errorf("Domain missing from node")
+	}
+	if isValidRole(e.Role) == false {
+		return nil, fmt.Errorf(
+			roleInvalidMessage+" for node '%s'",
+			e.Role,
+			e.Domain)
+	}
+	if len(e.Networks) == 0 {
+		return nil, fmt.Errorf("Networks missing for node '%s'", e.Domain)
+	}
+	if getWeight(e.Weight) < 0 {
+		return nil, fmt.Errorf(
+			"Weight '%d' must not be negative for node '%s'",
+			*e.Weight,
+			e.Domain)
+	}
+	for _, v := range e.Networks {
+		if v == "" {
+			return nil, fmt.Errorf(
+				"Network name empty for node '%s'",
+				e.Domain)
+		}
+	}
+	n, err := newNode(
+		joinNetworks(e.Networks),
+		e.Domain,
+		e.Created,
+		e.Expires,
+		e.Role,
+		e.ScramblerKey)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Scrambler key invalid for node '%s': %s",
+			e.Domain,
+			err)
+	}
+	n.weight = getWeight(e.Weight)
+	n.retiring = e.Retiring
+	for _, v := range e.Secrets {
+		x, err := newSecretFromKeyWithAEAD(v.Key, v.TimeStamp, v.AEAD)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Secret invalid for node '%s': %s",
+				e.Domain,
+				err)
+		}
+		n.addSecret(x)
+	}
+	n.sortSecrets()
+	return n, nil
+}
@@ -0,0 +1,260 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNodeDefinitionRoundTrip(t *testing.T) {
+	v, err := newVolatileNetworkTest(3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, err = v.testAddNode("a"+networkSeparator+"b", "shared.com", roleAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	d, err := s.ExportNodes()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	i, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	err = i.ImportNodes(d)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := v.getAllNodes(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b, err := i.store.getAllNodes(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != len(b) {
+		fmt.Printf("Expected '%d' nodes but found '%d'\n", len(a), len(b))
+		t.Fail()
+		return
+	}
+	for j := range a {
+		testNodeDefinitionEqual(t, a[j], b[j])
+	}
+
+	// The imported nodes must be usable to decrypt data from the originals.
+	e, err := a[0].encrypt([]byte("test"), 0)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testNodeDecrypt(t, b[0], e, []byte("test"))
+	x := encodingBase64URL
+	if a[0].scramble(x, "table") != b[0].scramble(x, "table") {
+		fmt.Println("Scrambled values should match")
+		t.Fail()
+	}
+
+	// Both networks must contain the shared node.
+	for _, k := range []string{"a", "b"} {
+		ns, err := i.store.getNodes(context.Background(), k)
+		if err != nil || ns == nil || ns.dict["shared.com"] == nil {
+			fmt.Printf("Network '%s' should contain 'shared.com'\n", k)
+			t.Fail()
+		}
+	}
+}
+
+func TestNodeDefinitionInvalid(t *testing.T) {
+	s, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	k := testNodeDefinitionKey(t)
+	n := `{"networks":["test"],"domain":"a.com","role":%d,` +
+		`"scramblerKey":"` + k + `"}`
+	for m, d := range map[string]string{
+		"Role":       "[" + fmt.Sprintf(n, 5) + "]",
+		"duplicated": "[" + fmt.Sprintf(n, 0) + "," + fmt.Sprintf(n, 1) + "]",
+		"Scrambler": `[{"networks":["test"],"domain":"a.com",` +
+			`"scramblerKey":"!"}]`,
+		"Networks": `[{"domain":"a.com","scramblerKey":"` + k + `"}]`,
+		"Weight": `[{"networks":["test"],"domain":"a.com","weight":-1,` +
+			`"scramblerKey":"` + k + `"}]`} {
+		err = s.ImportNodes([]byte(d))
+		if err == nil || strings.Contains(err.Error(), m) == false {
+			fmt.Printf("Expected error containing '%s' but got '%v'\n", m, err)
+			t.Fail()
+		}
+	}
+
+	// No nodes are stored if any of the nodes are invalid.
+	a, err := s.store.getAllNodes(context.Background())
+	if err != nil || len(a) != 0 {
+		fmt.Println("No nodes should have been imported")
+		t.Fail()
+	}
+}
+
+func TestNodeDefinitionRegister(t *testing.T) {
+	s, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e := time.Now().UTC().Add(time.Hour)
+	err = s.RegisterNodes([]NodeDefinition{
+		{Networks: []string{"test"}, Domain: "a.com", Role: roleAccess,
+			Expires: e},
+		{Networks: []string{"test"}, Domain: "b.com", Role: roleStorage,
+			Expires: e},
+		{Networks: []string{"test"}, Domain: "c.com", Role: roleStorage,
+			Expires: e, ScramblerKey: testNodeDefinitionKey(t)}})
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	ns, err := s.store.getNodes(context.Background(), "test")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, d := range []string{"a.com", "b.com", "c.com"} {
+		n := ns.dict[d]
+		if n == nil || n.isActive() == false {
+			fmt.Printf("Node '%s' should be registered and active\n", d)
+			t.Fail()
+		}
+	}
+	a, err := s.GetAccessNode("test")
+	if err != nil || a != "a.com" {
+		fmt.Printf("Access node should be 'a.com' not '%s'\n", a)
+		t.Fail()
+	}
+}
+
+func TestNodeDefinitionRegisterInvalid(t *testing.T) {
+	s, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e := time.Now().UTC().Add(time.Hour)
+	err = s.RegisterNodes([]NodeDefinition{
+		{Networks: []string{"test"}, Domain: "a.com", Role: roleAccess,
+			Expires: e},
+		{Networks: []string{"test"}, Domain: "b.com", Role: roleStorage,
+			Expires: e},
+		{Networks: []string{"test"}, Domain: "b.com", Role: 5,
+			Expires: e}})
+	m, ok := err.(MultiError)
+	if ok == false || len(m) != 2 {
+		fmt.Printf("Expected two errors but got '%v'\n", err)
+		t.Fail()
+		return
+	}
+	for _, v := range []string{"duplicated", "Role"} {
+		if strings.Contains(m.Error(), v) == false {
+			fmt.Printf("Expected error containing '%s' in '%s'\n", v, m)
+			t.Fail()
+		}
+	}
+
+	// No nodes are stored if any of the nodes are invalid.
+	a, err := s.store.getAllNodes(context.Background())
+	if err != nil || len(a) != 0 {
+		fmt.Println("No nodes should have been registered")
+		t.Fail()
+	}
+
+	// A batch without an access node or with an expiry before created is
+	// rejected.
+	err = s.RegisterNodes([]NodeDefinition{
+		{Networks: []string{"test"}, Domain: "b.com", Role: roleStorage,
+			Expires: time.Now().UTC().Add(-time.Hour)}})
+	m, ok = err.(MultiError)
+	if ok == false || len(m) != 2 {
+		fmt.Printf("Expected two errors but got '%v'\n", err)
+		t.Fail()
+	}
+}
+
+func testNodeDefinitionKey(t *testing.T) string {
+	x, err := newSecret(time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	return x.key
+}
+
+func testNodeDefinitionEqual(t *testing.T, a *node, b *node) {
+	if a.domain != b.domain ||
+		a.getNetwork() != b.getNetwork() ||
+		a.role != b.role ||
+		a.created.Equal(b.created) == false ||
+		a.expires.Equal(b.expires) == false ||
+		a.scrambler.key != b.scrambler.key ||
+		a.weight != b.weight ||
+		a.retiring != b.retiring ||
+		len(a.secrets) != len(b.secrets) {
+		fmt.Printf("Node '%s' does not match '%s'\n", a.domain, b.domain)
+		t.Fail()
+		return
+	}
+	for i := range a.secrets {
+		if a.secrets[i].key != b.secrets[i].key ||
+			a.secrets[i].timeStamp.Equal(b.secrets[i].timeStamp) == false ||
+			a.secrets[i].crypto.aead != b.secrets[i].crypto.aead {
+			fmt.Printf("Secret '%d' for '%s' does not match\n", i, a.domain)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// getFromNode returns the body of a GET request to another node. Requests that
+// fail with a network error, a timeout or a status code that indicates the
+// node is temporarily unavailable are retried with a doubling delay until the
+// configured number of retries is exhausted. All the attempts must complete
+// within the configured deadline.
+func (s *Services) getFromNode(ctx context.Context, u string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.nodeDeadline())
+	defer cancel()
+	d := s.config.nodeRetryDelay()
+	for i := 0; ; i++ {
+		b, retry, err := getFromNodeOnce(ctx, u)
+		if err == nil || retry == false || i >= s.config.nodeRetries() {
+			return b, err
+		}
+		s.logger.Warn("Node request '%s' attempt '%d' failed: %s", u, i+1, err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf(
+				"Node request '%s' deadline exceeded: %w", u, err)
+		case <-time.After(d):
+		}
+		d *= 2
+	}
+}
+
+// getFromNodeOnce returns the body of a GET request, or an error and true if
+// the request can be retried.
+func getFromNodeOnce(ctx context.Context, u string) ([]byte, bool, error) {
+	r, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	res, err := http.DefaultClient.Do(r.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Is(err, context.Canceled) == false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, isRetryableStatus(res.StatusCode), newResponseError(u, res)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	return b, true, err
+}
+
+// isRetryableStatus returns true if the status code indicates the node might
+// respond successfully if the request is repeated.
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout
+}
@@ -0,0 +1,134 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNodeRequestFlakyAccessNode(t *testing.T) {
+	s, n, err := NewTestNetwork(1, 3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	s.config.NodeRetryDelay = 1
+
+	// The access node is unavailable for the first two encrypt requests.
+	var c int32
+	h := n.servers[0].Config.Handler
+	n.servers[0].Config.Handler = http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/swift/api/v1/encrypt" &&
+				atomic.AddInt32(&c, 1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+
+	q := url.Values{}
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	q.Set(testKey("a"), "1")
+	u, err := n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err := n.Follow(u)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := n.Decode(e)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != 1 || a[0].Value != "1" {
+		fmt.Printf("Unexpected results '%v'\n", a)
+		t.Fail()
+	}
+	if atomic.LoadInt32(&c) != 3 {
+		fmt.Printf("Expected '3' encrypt requests but got '%d'\n", c)
+		t.Fail()
+	}
+}
+
+func TestNodeRequestNotRetryable(t *testing.T) {
+	s, c, h := newNodeRequestTest(http.StatusBadRequest)
+	defer h.Close()
+	_, err := s.getFromNode(context.Background(), h.URL)
+	if err == nil {
+		fmt.Println("Bad request should fail")
+		t.Fail()
+		return
+	}
+	if atomic.LoadInt32(c) != 1 {
+		fmt.Printf("Expected '1' request but got '%d'\n", *c)
+		t.Fail()
+	}
+}
+
+func TestNodeRequestDeadline(t *testing.T) {
+	s, c, h := newNodeRequestTest(http.StatusServiceUnavailable)
+	defer h.Close()
+	s.config.NodeRetries = 100
+	s.config.NodeRetryDelay = 10
+	s.config.NodeDeadline = 1
+	n := time.Now()
+	_, err := s.getFromNode(context.Background(), h.URL)
+	if err == nil {
+		fmt.Println("Unavailable node should fail")
+		t.Fail()
+		return
+	}
+	if time.Since(n) > 2*time.Second {
+		fmt.Println("Retries should stop at the deadline")
+		t.Fail()
+	}
+	if atomic.LoadInt32(c) < 2 {
+		fmt.Printf("Expected retries but got '%d' requests\n", *c)
+		t.Fail()
+	}
+}
+
+// newNodeRequestTest returns services and a server that always responds with
+// the status code provided counting the requests.
+func newNodeRequestTest(code int) (*Services, *int32, *httptest.Server) {
+	var c int32
+	h := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&c, 1)
+			w.WriteHeader(code)
+		}))
+	s := NewServices(Configuration{}, newVolatile(), nil, nil)
+	return s, &c, h
+}
@@ -0,0 +1,591 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNodeRotateSecret(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s1 := n.secrets[0]
+	s1.timeStamp = time.Now().UTC().Add(-5 * time.Hour)
+	d1, err := n.encrypt([]byte("one"), zlib.DefaultCompression)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Rotate with a long retirement so that the first secret is retained.
+	s2, err := newSecret(time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s2.timeStamp = time.Now().UTC().Add(-2 * time.Hour)
+	if n.rotateSecret(s2, 3*time.Hour) != 0 {
+		fmt.Println("No secrets should be retired")
+		t.Fail()
+	}
+	x, err := n.getSecret()
+	if err != nil || x != s2 {
+		fmt.Println("Newest secret should be used for encryption")
+		t.Fail()
+		return
+	}
+	d2, err := n.encrypt([]byte("two"), zlib.DefaultCompression)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testNodeDecrypt(t, n, d1, []byte("one"))
+
+	// Rotate with a short retirement so that the first secret is removed.
+	s3, err := newSecret(time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if n.rotateSecret(s3, time.Hour) != 1 {
+		fmt.Println("One secret should be retired")
+		t.Fail()
+	}
+	if len(n.secrets) != 2 || n.secrets[0] != s2 || n.secrets[1] != s3 {
+		fmt.Println("Secrets should be the second and third")
+		t.Fail()
+	}
+	b, err := n.decrypt(d1)
+	if err == nil && b != nil {
+		fmt.Println("Data for the retired secret should not decrypt")
+		t.Fail()
+	}
+	testNodeDecrypt(t, n, d2, []byte("two"))
+}
+
+func TestNodeSecretStats(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n.secrets[0].timeStamp = time.Now().UTC().Add(-3 * time.Hour)
+	testNodeSecretStats(t, n, 1, 0)
+
+	// Two older secrets superseded by the current one, and one pending.
+	for _, d := range []time.Duration{
+		-2 * time.Hour,
+		-time.Hour,
+		time.Hour} {
+		x, err := newSecret(time.Now().UTC())
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		x.timeStamp = time.Now().UTC().Add(d)
+		n.addSecret(x)
+	}
+	testNodeSecretStats(t, n, 2, 2)
+
+	// Without any secrets in effect none have expired.
+	for _, x := range n.secrets {
+		x.timeStamp = time.Now().UTC().Add(time.Hour)
+	}
+	testNodeSecretStats(t, n, 4, 0)
+}
+
+func TestNodeDecryptAllSecrets(t *testing.T) {
+	n, d, err := newNodeDecryptTest(5)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The newest secret is tried first before any have been used.
+	testNodeDecryptAttempts(t, n, d[len(d)-1], 1)
+
+	// The data for every secret still decodes.
+	for i, e := range d {
+		testNodeDecrypt(t, n, e, []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	// The most recently used secret is tried first.
+	testNodeDecryptAttempts(t, n, d[0], len(d))
+	testNodeDecryptAttempts(t, n, d[0], 1)
+}
+
+func TestNodeDecryptOrderFixedClock(t *testing.T) {
+	n, d, err := newNodeDecryptTest(3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The order does not depend on the time so a clock that does not advance
+	// still tries the most recently successful secret first.
+	n.clock = &clockTest{time.Now().UTC()}
+	testNodeDecryptAttempts(t, n, d[0], 3)
+	testNodeDecryptAttempts(t, n, d[0], 1)
+	testNodeDecryptAttempts(t, n, d[1], 3)
+	testNodeDecryptAttempts(t, n, d[1], 1)
+	testNodeDecryptAttempts(t, n, d[0], 2)
+	testNodeDecryptAttempts(t, n, d[0], 1)
+}
+
+func TestNodeTableSecretsIsolated(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := n.encryptForTable([]byte("a"), zlib.DefaultCompression, "A")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Only the key derived for table A decrypts the data.
+	b, err := n.decryptForTable(a, "A")
+	if err != nil || string(b) != "a" {
+		fmt.Println("Table 'A' should decrypt table 'A' data")
+		t.Fail()
+	}
+	for _, x := range []string{"B", ""} {
+		_, err = n.decryptForTable(a, x)
+		if err == nil {
+			fmt.Printf("Table '%s' should not decrypt table 'A' data\n", x)
+			t.Fail()
+		}
+	}
+
+	// Data encrypted before table keys were used still decrypts.
+	d, err := n.encrypt([]byte("d"), zlib.DefaultCompression)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b, err = n.decryptForTable(d, "A")
+	if err != nil || string(b) != "d" {
+		fmt.Println("Data without a table key should decrypt")
+		t.Fail()
+	}
+}
+
+func TestServicesRotateNodeSecrets(t *testing.T) {
+	v, err := newVolatileNetworkTest(1)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.SecretRetirement = 60
+	err = s.RotateNodeSecrets(testAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n, err := v.getNode(context.Background(), testAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(n.secrets) != 2 {
+		fmt.Printf("Expected 2 secrets but found %d\n", len(n.secrets))
+		t.Fail()
+	}
+	ns, err := v.getNodes(context.Background(), testNetwork)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(ns.all) != 2 {
+		fmt.Printf("Expected 2 nodes but found %d\n", len(ns.all))
+		t.Fail()
+	}
+	if s.RotateNodeSecrets("missing.com") == nil {
+		fmt.Println("Missing node should return an error")
+		t.Fail()
+	}
+}
+
+func TestServicesRotateNodeSecretsAEAD(t *testing.T) {
+	v, err := newVolatileNetworkTest(1)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.SecretRetirement = 60
+	s.config.AEAD = "chacha20-poly1305"
+	err = s.RotateNodeSecrets(testAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n, err := v.getNode(context.Background(), testAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if n.secrets[0].crypto.aead != aeadGCM ||
+		n.secrets[1].crypto.aead != aeadChaCha20Poly1305 {
+		fmt.Println("Only the new secret should use ChaCha20-Poly1305")
+		t.Fail()
+		return
+	}
+
+	// The AEAD must be kept when the nodes are exported and imported.
+	d, err := s.ExportNodes()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	i, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	err = i.ImportNodes(d)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b, err := i.store.getNode(context.Background(), testAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testNodeDefinitionEqual(t, n, b)
+}
+
+// newNodeTest returns an active storage node with a single secret.
+func newNodeTest() (*node, error) {
+	return newVolatile().testAddNode(testNetwork, "node.com", roleStorage)
+}
+
+func testNodeDecrypt(t *testing.T, n *node, d []byte, e []byte) {
+	b, err := n.decrypt(d)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if bytes.Compare(b, e) != 0 {
+		fmt.Println(string(b))
+		fmt.Println(string(e))
+		t.Fail()
+	}
+}
+
+func TestNodeGetSecretNewest(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	o := n.secrets[0]
+	o.timeStamp = time.Now().UTC().Add(-time.Hour)
+
+	// Add a newer secret before the existing one so that the order of the
+	// array does not match the order of the time stamps.
+	l, err := newSecret(time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n.secrets = append([]*secret{l}, n.secrets...)
+	x, err := n.getSecret()
+	if err != nil || x != l {
+		fmt.Println("Unsorted secrets should return the later secret")
+		t.Fail()
+	}
+	n.sortSecrets()
+	if n.secrets[0] != o {
+		fmt.Println("Sorted secrets should start with the oldest")
+		t.Fail()
+	}
+	x, err = n.getSecret()
+	if err != nil || x != l {
+		fmt.Println("Sorted secrets should return the later secret")
+		t.Fail()
+	}
+
+	// A secret that is not yet active should not be used.
+	f, err := newSecret(time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	f.timeStamp = time.Now().UTC().Add(time.Hour)
+	n.addSecret(f)
+	x, err = n.getSecret()
+	if err != nil || x != l {
+		fmt.Println("Future secret should not be used")
+		t.Fail()
+	}
+}
+
+func TestNodeGetSecretNone(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n.secrets[0].timeStamp = time.Now().UTC().Add(time.Hour)
+	_, err = n.getSecret()
+	if err == nil {
+		fmt.Println("Node with only future secrets should return an error")
+		t.Fail()
+	}
+	n.secrets = nil
+	_, err = n.getSecret()
+	if err == nil {
+		fmt.Println("Node without secrets should return an error")
+		t.Fail()
+	}
+}
+
+func TestNodeNonceSimilarDomains(t *testing.T) {
+	s, err := newSecret(time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Domains that are prefixes or rotations of one another produce the same
+	// legacy nonce.
+	for _, d := range [][]string{
+		{"swift.com", "swift.comswift.com"},
+		{"ab.ab.ab.ab.", "ab.ab.ab.ab.ab.ab."}} {
+		a := makeNonce(s, []byte(d[0]))
+		b := makeNonce(s, []byte(d[1]))
+		if len(a) != s.crypto.gcm.NonceSize() {
+			fmt.Printf("Nonce length '%d' incorrect\n", len(a))
+			t.Fail()
+		}
+		if bytes.Equal(a, b) {
+			fmt.Printf("Domains '%s' and '%s' share a nonce\n", d[0], d[1])
+			t.Fail()
+		}
+	}
+}
+
+func TestNodeScrambleVersion(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, s := range []string{
+		n.scramble(encodingBase64URL, "table"),
+		n.scrambleLegacy("table")} {
+		u, err := n.unscramble(s)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if u != "table" {
+			fmt.Printf("Unscrambled '%s' should be 'table'\n", u)
+			t.Fail()
+		}
+	}
+	e := encodingBase64URL
+	if n.scramble(e, "table") != n.scramble(e, "table") {
+		fmt.Println("Scramble must be deterministic")
+		t.Fail()
+	}
+	if n.scramble(e, "table") == n.scrambleLegacy("table") {
+		fmt.Println("Scramble must differ from the legacy scramble")
+		t.Fail()
+	}
+}
+
+func TestNodeScrambleVersionByte(t *testing.T) {
+	n, err := newNodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b, err := base64.RawURLEncoding.DecodeString(
+		n.scramble(encodingBase64URL, "table"))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(b) == 0 || b[0] != scrambleVersionCurrent {
+		fmt.Println("Scrambled value must start with the current version")
+		t.Fail()
+	}
+}
+
+func TestNodeScrambleVersionUnknown(t *testing.T) {
+	for _, b := range [][]byte{
+		{},
+		{scrambleVersionHash + 1, 1, 2},
+		[]byte("swift.com")} {
+		if !bytes.Equal(getScrambledData(b), b) {
+			fmt.Printf("Unknown version '%v' should be unaltered\n", b)
+			t.Fail()
+		}
+	}
+	d := getScrambledData([]byte{scrambleVersionHash, 1, 2})
+	if !bytes.Equal(d, []byte{1, 2}) {
+		fmt.Printf("Version byte should be removed from '%v'\n", d)
+		t.Fail()
+	}
+}
+
+func testNodeSecretStats(t *testing.T, n *node, active, expired int) {
+	a, e := n.SecretStats()
+	if a != active || e != expired {
+		fmt.Printf("Expected '%d' active and '%d' expired but got '%d' and "+
+			"'%d'\n", active, expired, a, e)
+		t.Fail()
+	}
+}
+
+func testNodeDecryptAttempts(t *testing.T, n *node, d []byte, expected int) {
+	_, c, err := n.decryptWithAttempts(d, "")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if c != expected {
+		fmt.Printf("Expected '%d' attempts but got '%d'\n", expected, c)
+		t.Fail()
+	}
+}
+
+// BenchmarkNodeDecryptStoredOrder tries the secrets oldest first in the order
+// they are stored to provide a baseline for the number of attempts.
+func BenchmarkNodeDecryptStoredOrder(b *testing.B) {
+	n, d, err := newNodeDecryptTest(5)
+	if err != nil {
+		b.Fatal(err)
+	}
+	e := d[len(d)-1]
+	a := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range n.secrets {
+			a++
+			if _, err := s.crypto.decryptAndDecompress(e); err == nil {
+				break
+			}
+		}
+	}
+	b.ReportMetric(float64(a)/float64(b.N), "attempts/op")
+}
+
+// BenchmarkNodeDecryptOrdered decrypts data encrypted with the newest secret
+// using the node's decryption order.
+func BenchmarkNodeDecryptOrdered(b *testing.B) {
+	n, d, err := newNodeDecryptTest(5)
+	if err != nil {
+		b.Fatal(err)
+	}
+	e := d[len(d)-1]
+	a := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, c, err := n.decryptWithAttempts(e, "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		a += c
+	}
+	b.ReportMetric(float64(a)/float64(b.N), "attempts/op")
+}
+
+// newNodeDecryptTest returns a node with the number of secrets provided stored
+// oldest first, and data encrypted with each secret in the same order.
+func newNodeDecryptTest(count int) (*node, [][]byte, error) {
+	n, err := newNodeTest()
+	if err != nil {
+		return nil, nil, err
+	}
+	n.secrets = nil
+	var d [][]byte
+	for i := 0; i < count; i++ {
+		x, err := newSecret(time.Now().UTC())
+		if err != nil {
+			return nil, nil, err
+		}
+		x.timeStamp = time.Now().UTC().Add(time.Duration(i-count) * time.Hour)
+		n.addSecret(x)
+		e, err := x.crypto.compressAndEncrypt(
+			[]byte(fmt.Sprintf("value%d", i)),
+			zlib.DefaultCompression)
+		if err != nil {
+			return nil, nil, err
+		}
+		d = append(d, e)
+	}
+	return n, d, nil
+}
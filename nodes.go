@@ -22,6 +22,7 @@ import (
 	"math/rand"
 	"regexp"
 	"sort"
+	"strconv"
 )
 
 type nodes struct {
@@ -29,6 +30,7 @@ type nodes struct {
 	active []*node          // Active nodes ordered by creation time
 	hash   []*node          // Active nodes ordered by hash value
 	dict   map[string]*node // All the nodes keyed on domain name
+	ring   hashedDomains    // Weighted points, or empty if weights are equal
 }
 
 func newNodes() *nodes {
@@ -93,7 +95,15 @@ func getRemoteAddr(xff string, ra string) string {
 }
 
 // Find the node that has a hash value closest to that of the remote IP address.
+// If that node is no longer active or is not alive then the next node in hash
+// order that is both active and alive is used. If no nodes are alive then the
+// next active node in hash order is used. If no nodes are active then an error
+// is returned. Observer nodes never store data and are never home nodes. If the
+// nodes have different weights then the weighted ring is used instead.
 func (ns *nodes) getHomeNode(xff string, ra string) (*node, error) {
+	if len(ns.ring.hashes) > 0 || ns.getWeightsZero() {
+		return ns.getHomeNodeByWeight(xff, ra)
+	}
 	i := ns.getNodeIndexByHash(getRemoteAddrHash(xff, ra))
 	if i < 0 || i >= len(ns.hash) {
 		return nil, fmt.Errorf(
@@ -102,7 +112,141 @@ func (ns *nodes) getHomeNode(xff string, ra string) (*node, error) {
 			len(ns.hash),
 			getRemoteAddr(xff, ra))
 	}
-	return ns.hash[i], nil
+	n := ns.getNextNodeByHash(i, func(n *node) bool {
+		return n.role != roleObserver && n.isActive() && n.isAlive()
+	})
+	if n == nil {
+		n = ns.getNextNodeByHash(i, func(n *node) bool {
+			return n.role != roleObserver && n.isActive()
+		})
+	}
+	if n == nil {
+		return nil, fmt.Errorf(
+			"None of the '%d' nodes are active to be a home node for remote "+
+				"address '%s'",
+			len(ns.hash),
+			getRemoteAddr(xff, ra))
+	}
+	return n, nil
+}
+
+// getWeightsZero returns true if there are nodes that could be home nodes and
+// all of them have a weight of zero.
+func (ns *nodes) getWeightsZero() bool {
+	z := false
+	for _, n := range ns.hash {
+		if n.role != roleObserver {
+			if n.homeWeight() != 0 {
+				return false
+			}
+			z = true
+		}
+	}
+	return z
+}
+
+// getHomeNodeByWeight returns the node at the first point on the weighted ring
+// after the hash of the remote address. Nodes with more weight have more
+// points and are therefore the home node for more addresses. The same
+// preference for nodes that are alive is applied as with getHomeNode.
+func (ns *nodes) getHomeNodeByWeight(xff string, ra string) (*node, error) {
+	a := getRingHash(getRemoteAddr(xff, ra))
+	i := sort.Search(len(ns.ring.hashes), func(i int) bool {
+		return ns.ring.hashes[i] >= a
+	})
+	var f *node
+	for j := 0; j < len(ns.ring.hashes); j++ {
+		n := ns.dict[ns.ring.domains[(i+j)%len(ns.ring.hashes)]]
+		if n == nil || n.isActive() == false {
+			continue
+		}
+		if n.isAlive() {
+			return n, nil
+		}
+		if f == nil {
+			f = n
+		}
+	}
+	if f == nil {
+		return nil, fmt.Errorf(
+			"None of the '%d' nodes are active to be a home node for remote "+
+				"address '%s'",
+			len(ns.hash),
+			getRemoteAddr(xff, ra))
+	}
+	return f, nil
+}
+
+// getHomeNodeByStrategy returns the home node using the strategy to order the
+// active nodes, or getHomeNode if there is no strategy. The same preference for
+// nodes that are alive is applied as with getHomeNode.
+func (ns *nodes) getHomeNodeByStrategy(
+	h HomeNodeStrategy,
+	xff string,
+	ra string) (*node, error) {
+	if h == nil {
+		return ns.getHomeNode(xff, ra)
+	}
+	d := make([]string, 0, len(ns.hash))
+	for _, n := range ns.hash {
+		if n.homeWeight() > 0 {
+			d = append(d, n.domain)
+		}
+	}
+	o := h.Order(getRemoteAddr(xff, ra), d)
+	var a *node
+	for _, v := range o {
+		n := ns.dict[v]
+		if n == nil || n.role == roleObserver || n.isActive() == false {
+			continue
+		}
+		if n.isAlive() {
+			return n, nil
+		}
+		if a == nil {
+			a = n
+		}
+	}
+	if a == nil {
+		return nil, fmt.Errorf(
+			"None of the '%d' nodes are active to be a home node for remote "+
+				"address '%s'",
+			len(ns.hash),
+			getRemoteAddr(xff, ra))
+	}
+	return a, nil
+}
+
+// getNextNodeByHash returns the first node in hash order starting at index i
+// that matches the condition, or nil if no node matches.
+func (ns *nodes) getNextNodeByHash(i int, condition func(n *node) bool) *node {
+	for j := 0; j < len(ns.hash); j++ {
+		n := ns.hash[(i+j)%len(ns.hash)]
+		if condition(n) {
+			return n
+		}
+	}
+	return nil
+}
+
+// getReplicaNodes returns up to count storage nodes that follow the home node
+// in hash order. These are the nodes that become the home node for the same
+// remote addresses if the nodes before them are not alive.
+func (ns *nodes) getReplicaNodes(home *node, count int) []*node {
+	r := []*node{}
+	for i, n := range ns.hash {
+		if n != home {
+			continue
+		}
+		for j := 1; j < len(ns.hash) && len(r) < count; j++ {
+			m := ns.hash[(i+j)%len(ns.hash)]
+			if m.role == roleStorage {
+				r = append(r, m)
+			}
+		}
+		break
+	}
+	return r
 }
 
 func (ns *nodes) getNodeIndexByHash(h uint32) int {
@@ -125,6 +269,41 @@ func (ns *nodes) getNodeIndexByHash(h uint32) int {
 func (ns *nodes) order() {
 	ns.active = getActiveOrdered(ns.all)
 	ns.hash = getHashOrdered(ns.active)
+	ns.ring = getWeightedRing(ns.active)
+}
+
+// The number of points on the weighted ring for each unit of node weight.
+const weightPoints = 100
+
+// getWeightedRing returns the points on the ring for each node that can be a
+// home node in proportion to the node weight. If all the nodes have the same
+// weight then an empty ring is returned and the home node is the node with
+// the closest hash. Retiring nodes have no points.
+func getWeightedRing(active []*node) hashedDomains {
+	var r hashedDomains
+	w := -1
+	u := true
+	for _, n := range active {
+		if n.role != roleObserver {
+			if w >= 0 && n.homeWeight() != w {
+				u = false
+			}
+			w = n.homeWeight()
+		}
+	}
+	if u && w != 0 {
+		return r
+	}
+	for _, n := range active {
+		for i := 0; i < n.homeWeight()*weightPoints; i++ {
+			r.hashes = append(
+				r.hashes,
+				getRingHash(n.domain+"-"+strconv.Itoa(i)))
+			r.domains = append(r.domains, n.domain)
+		}
+	}
+	sort.Sort(r)
+	return r
 }
 
 func getHashOrdered(all []*node) []*node {
@@ -17,7 +17,9 @@
 package swift
 
 import (
+	"context"
 	"fmt"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -26,7 +28,7 @@ func TestNodesHashOrder(t *testing.T) {
 	ns := newNodes()
 	for i := 0; i < 100; i++ {
 		var n *node
-		s, err := newSecret()
+		s, err := newSecret(time.Now().UTC())
 		if err != nil {
 			fmt.Println(err)
 			t.Fail()
@@ -44,7 +46,7 @@ func TestNodesHashOrder(t *testing.T) {
 			t.Fail()
 			return
 		}
-		x, err := newSecret()
+		x, err := newSecret(time.Now().UTC())
 		if err != nil {
 			fmt.Println(err)
 			t.Fail()
@@ -62,3 +64,197 @@ func TestNodesHashOrder(t *testing.T) {
 		return
 	}
 }
+
+func TestNodesHomeNodeSkipsExpired(t *testing.T) {
+	ns, err := newNodesTest(10)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	ra := "10.0.0.1"
+	i := ns.getNodeIndexByHash(getRemoteAddrHash("", ra))
+
+	// Expire the hashed node and the one after it so that the third in hash
+	// order must be selected.
+	ns.hash[i].expires = time.Now().UTC().Add(-time.Hour)
+	ns.hash[(i+1)%len(ns.hash)].expires = time.Now().UTC().Add(-time.Hour)
+	e := ns.hash[(i+2)%len(ns.hash)]
+	for c := 0; c < 5; c++ {
+		n, err := ns.getHomeNode("", ra)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if n != e {
+			fmt.Printf("Expected '%s' but got '%s'\n", e.domain, n.domain)
+			t.Fail()
+			return
+		}
+	}
+
+	// If a later node is alive it is preferred over the active one.
+	a := ns.hash[(i+3)%len(ns.hash)]
+	a.setAlive(true)
+	n, err := ns.getHomeNode("", ra)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if n != a {
+		fmt.Printf("Expected '%s' but got '%s'\n", a.domain, n.domain)
+		t.Fail()
+	}
+}
+
+func TestNodesHomeNodeAllExpired(t *testing.T) {
+	ns, err := newNodesTest(5)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, n := range ns.hash {
+		n.expires = time.Now().UTC().Add(-time.Hour)
+	}
+	n, err := ns.getHomeNode("", "10.0.0.1")
+	if err == nil || n != nil {
+		fmt.Println("Expected an error when all nodes are expired")
+		t.Fail()
+	}
+}
+
+func TestNodesHomeNodeSkipsObserver(t *testing.T) {
+	ns, err := newNodesTest(10)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	ra := "10.0.0.1"
+	i := ns.getNodeIndexByHash(getRemoteAddrHash("", ra))
+
+	// Make the hashed node an observer so the next in hash order is used.
+	ns.hash[i].role = roleObserver
+	e := ns.hash[(i+1)%len(ns.hash)]
+	n, err := ns.getHomeNode("", ra)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if n != e {
+		fmt.Printf("Expected '%s' but got '%s'\n", e.domain, n.domain)
+		t.Fail()
+	}
+
+	// If all the nodes are observers then there is no home node.
+	for _, x := range ns.hash {
+		x.role = roleObserver
+	}
+	n, err = ns.getHomeNode("", ra)
+	if err == nil || n != nil {
+		fmt.Println("Expected an error when all nodes are observers")
+		t.Fail()
+	}
+}
+
+func TestNodesObserverNotAccess(t *testing.T) {
+	v := newVolatile()
+	_, err := v.testAddNode(testNetwork, "observer.com", roleObserver)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := v.GetAccessNode(context.Background(), testNetwork)
+	if err == nil || a != "" {
+		fmt.Printf("Observer '%s' should not be an access node\n", a)
+		t.Fail()
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := httptest.NewRequest("GET", "http://observer.com/swift/api/v1/create",
+		nil)
+	_, err = createOperation(s, r)
+	if err == nil {
+		fmt.Println("Observer should not create operations")
+		t.Fail()
+	}
+}
+
+func TestNodesHomeNodeWeighted(t *testing.T) {
+	ns, err := newNodesTest(3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	ns.dict[testAccess].weight = 0
+	ns.dict["storage-1.com"].weight = 3
+	ns.dict["storage-2.com"].weight = 1
+	ns.order()
+	c := testNodesHomeNodeCounts(t, ns, 4000)
+	r := float64(c["storage-1.com"]) / float64(c["storage-2.com"])
+	if c[testAccess] != 0 || r < 2.5 || r > 3.5 {
+		fmt.Printf("Counts '%v' not in proportion to weights\n", c)
+		t.Fail()
+	}
+}
+
+func TestNodesHomeNodeWeightZero(t *testing.T) {
+	ns, err := newNodesTest(3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	ns.dict["storage-1.com"].weight = 0
+	ns.order()
+	c := testNodesHomeNodeCounts(t, ns, 1000)
+	if c["storage-1.com"] != 0 || c["storage-2.com"] == 0 {
+		fmt.Printf("Counts '%v' should exclude zero weight\n", c)
+		t.Fail()
+	}
+
+	// If all the nodes have zero weight then there is no home node.
+	for _, n := range ns.all {
+		n.weight = 0
+	}
+	ns.order()
+	_, err = ns.getHomeNode("", "10.0.0.1")
+	if err == nil {
+		fmt.Println("Expected an error when all nodes have zero weight")
+		t.Fail()
+	}
+}
+
+// testNodesHomeNodeCounts returns the number of sampled IP addresses that
+// each node is the home node for.
+func testNodesHomeNodeCounts(t *testing.T, ns *nodes, n int) map[string]int {
+	c := make(map[string]int)
+	for i := 0; i < n; i++ {
+		h, err := ns.getHomeNode("", fmt.Sprintf("10.%d.%d.1", i/256, i%256))
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return c
+		}
+		c[h.domain]++
+	}
+	return c
+}
+
+func newNodesTest(count int) (*nodes, error) {
+	v, err := newVolatileNetworkTest(count - 1)
+	if err != nil {
+		return nil, err
+	}
+	return v.getNodes(context.Background(), testNetwork)
+}
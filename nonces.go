@@ -0,0 +1,136 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceStore records the nonces of storage operations whose results have been
+// used so that the results can not be used again. The default holds the nonces
+// in the memory of the node. A store shared by all the access nodes in a
+// cluster prevents results used at one access node being replayed at another.
+// Implementations must be safe for concurrent use.
+type NonceStore interface {
+	// Seen returns true if the nonce has been recorded and has not expired.
+	Seen(nonce string) bool
+	// Record remembers the nonce until the expiry time.
+	Record(nonce string, expires time.Time)
+}
+
+// nonceSet records the nonces of storage operations that have completed so
+// that the results of an operation can not be used more than once. The number
+// of nonces held is limited. Once the limit is reached the oldest nonce is
+// forgotten.
+type nonceSet struct {
+	limit   int                  // Most nonces that can be recorded
+	expires map[string]time.Time // When each nonce can be forgotten
+	order   []string             // Nonces in the order they were recorded
+	mutex   *sync.Mutex          // Guards the map and order
+	now     func() time.Time     // Returns the current time
+}
+
+func newNonceSet(limit int) *nonceSet {
+	var n nonceSet
+	n.limit = limit
+	n.expires = make(map[string]time.Time)
+	n.mutex = &sync.Mutex{}
+	n.now = time.Now
+	return &n
+}
+
+// use records the nonce until the expiry time returning true if the nonce has
+// not already been recorded, otherwise false.
+func (n *nonceSet) use(nonce string, expires time.Time) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	t := n.now()
+	n.prune(t)
+	if n.seen(nonce, t) {
+		return false
+	}
+	n.record(nonce, expires)
+	return true
+}
+
+// Seen returns true if the nonce has been recorded and has not expired.
+func (n *nonceSet) Seen(nonce string) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	t := n.now()
+	n.prune(t)
+	return n.seen(nonce, t)
+}
+
+// Record remembers the nonce until the expiry time. If the limit has been
+// reached then the oldest nonce is forgotten.
+func (n *nonceSet) Record(nonce string, expires time.Time) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.prune(n.now())
+	n.record(nonce, expires)
+}
+
+func (n *nonceSet) seen(nonce string, t time.Time) bool {
+	e, ok := n.expires[nonce]
+	return ok && e.After(t)
+}
+
+func (n *nonceSet) record(nonce string, expires time.Time) {
+	if _, ok := n.expires[nonce]; ok {
+		n.expires[nonce] = expires
+		return
+	}
+	for len(n.order) > 0 && len(n.order) >= n.limit {
+		delete(n.expires, n.order[0])
+		n.order = n.order[1:]
+	}
+	n.expires[nonce] = expires
+	n.order = append(n.order, nonce)
+}
+
+// prune removes the oldest nonces that have expired.
+func (n *nonceSet) prune(t time.Time) {
+	for len(n.order) > 0 {
+		e, ok := n.expires[n.order[0]]
+		if ok && e.After(t) {
+			return
+		}
+		delete(n.expires, n.order[0])
+		n.order = n.order[1:]
+	}
+}
+
+// removeExpired removes all the nonces that have expired at the time provided
+// regardless of the order they were recorded in. Returns the number of nonces
+// removed.
+func (n *nonceSet) removeExpired(t time.Time) int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	o := n.order[:0]
+	for _, v := range n.order {
+		if n.expires[v].After(t) {
+			o = append(o, v)
+		} else {
+			delete(n.expires, v)
+		}
+	}
+	r := len(n.order) - len(o)
+	n.order = o
+	return r
+}
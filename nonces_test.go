@@ -0,0 +1,112 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNonceSetLimit(t *testing.T) {
+	n := newNonceSet(2)
+	e := time.Now().Add(time.Hour)
+	for _, k := range []string{"a", "b", "c"} {
+		if n.use(k, e) == false {
+			fmt.Printf("Nonce '%s' should be allowed\n", k)
+			t.Fail()
+		}
+	}
+	if len(n.expires) != 2 || n.use("c", e) {
+		fmt.Println("Set should hold the two most recent nonces")
+		t.Fail()
+	}
+}
+
+func TestNonceSetExpiry(t *testing.T) {
+	c := time.Now()
+	n := newNonceSet(10)
+	n.now = func() time.Time { return c }
+	n.use("a", c.Add(time.Minute))
+	c = c.Add(2 * time.Minute)
+	if n.use("a", c.Add(time.Minute)) == false {
+		fmt.Println("Expired nonce should be forgotten")
+		t.Fail()
+	}
+}
+
+func TestNonceStoreMemory(t *testing.T) {
+	c := time.Now()
+	n := newNonceSet(10)
+	n.now = func() time.Time { return c }
+	var s NonceStore = n
+	if s.Seen("a") {
+		fmt.Println("Nonce should not be seen before it is recorded")
+		t.Fail()
+		return
+	}
+	s.Record("a", c.Add(time.Minute))
+	if s.Seen("a") == false {
+		fmt.Println("Recorded nonce should be seen")
+		t.Fail()
+		return
+	}
+	c = c.Add(2 * time.Minute)
+	if s.Seen("a") {
+		fmt.Println("Expired nonce should not be seen")
+		t.Fail()
+	}
+}
+
+func TestNonceStoreShared(t *testing.T) {
+	v, err := newVolatileNetworkTest(1)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	b, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	m := newNonceSet(10)
+	a.SetNonceStore(m)
+	b.SetNonceStore(m)
+	r := &Results{nonce: "shared", Expires: time.Now().Add(time.Hour)}
+	if err = a.useNonce(r); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if b.useNonce(r) == nil {
+		fmt.Println("Results used at one node should be rejected at another")
+		t.Fail()
+		return
+	}
+	if len(a.nonces.expires) != 0 {
+		fmt.Println("In memory store should not be used when replaced")
+		t.Fail()
+	}
+}
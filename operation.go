@@ -18,9 +18,12 @@ package swift
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"html/template"
+	"math"
 	"net/http"
 	"net/url"
 	"strings"
@@ -31,24 +34,33 @@ type operation struct {
 
 	// Internal persisted state fields.
 	timeStamp      time.Time // The time that the state information was created
+	deadline       time.Time // The time the operation must complete by
 	returnURL      string    // The URL to return to when the operation completes
 	browserWarning float32   // Probability of browser warning display
 	accessNode     string    // The domain name of the access node
+	networkName    string    // The name of the network for the operation
 	nodesVisited   byte      // Nodes visited so far including current
 	nodeCount      byte      // Number of nodes that should be visited
 	values         []*pair   // Values of the data being stored
 	table          string    // The table to store the key value pairs in
 	homeNode       string    // The domain of the home node
 	state          string    // Optional state information
+	nonce          string    // Unique value used to prevent replays
+	signature      string    // HMAC of the fields that deliver the results
+	webhookURL     string    // Optional URL the results are also posted to
+	redundancy     byte      // Number of storage nodes each value is written to
 
 	// The following fields are calculated for each request. Not stored.
 	services    *Services     // The services used for the operation
 	nextURL     *url.URL      // The next URL to navigate to
 	thisNode    *node         // The node that is processing the operation
 	nextNode    *node         // The next node in the operation
+	skipNode    string        // Domain of a failed node not to select next
+	resumeURL   *url.URL      // The URL that resumes the operation at this node
 	homeNodePtr *node         // The pointer to the home node
 	network     *nodes        // The nodes that form the operation network
 	request     *http.Request // Http request associated with the operation
+	warning     template.HTML // The browser warning HTML if one is shown
 
 	HTML // Include the common HTML UI members.
 }
@@ -62,19 +74,27 @@ func (o *operation) ProgressColor() string   { return o.HTML.ProgressColor }
 func (o *operation) ReturnURL() string       { return o.returnURL }
 func (o *operation) AccessNode() string      { return o.accessNode }
 func (o *operation) NextURL() *url.URL       { return o.nextURL }
+func (o *operation) ResumeURL() *url.URL     { return o.resumeURL }
 func (o *operation) NodesVisited() byte      { return o.nodesVisited }
 func (o *operation) NodeCount() byte         { return o.nodeCount }
 func (o *operation) Debug() bool             { return o.services.config.Debug }
 func (o *operation) SVGStroke() int          { return svgStroke }
 func (o *operation) SVGSize() int            { return svgSize }
 func (o *operation) Values() []*pair         { return o.values }
+func (o *operation) State() string           { return o.state }
+
+// BrowserWarning returns the warning HTML for the web browser. Used with HTML
+// templates.
+func (o *operation) BrowserWarning() template.HTML { return o.warning }
 
 // HomeNode returns the home node for the web browser. Used to ensure that the
 // first and last operation occur against a consistent node for the web browser.
 func (o *operation) HomeNode() *node {
 	if o.homeNodePtr == nil {
 		if o.homeNode != "" {
-			o.homeNodePtr, _ = o.services.store.getNode(o.homeNode)
+			o.homeNodePtr, _ = o.services.store.getNode(
+				o.getContext(),
+				o.homeNode)
 		}
 		if o.homeNodePtr == nil {
 			o.homeNodePtr = o.network.active[0]
@@ -83,13 +103,39 @@ func (o *operation) HomeNode() *node {
 	return o.homeNodePtr
 }
 
+// setState sets the state information that is returned in the results after
+// validating it can be carried by the operation.
+func (o *operation) setState(s string) error {
+	err := validateState(s)
+	if err != nil {
+		return err
+	}
+	o.state = s
+	return nil
+}
+
+// getContext returns the context of the request the operation was created from,
+// or the background context if there is no request.
+func (o *operation) getContext() context.Context {
+	if o.request != nil {
+		return o.request.Context()
+	}
+	return context.Background()
+}
+
 func (o *operation) ReturnOrigin() string {
 	return o.returnURL
 }
 
+// IsDeadlineValid returns true if the operation has not passed the deadline set
+// when it was created.
+func (o *operation) IsDeadlineValid() bool {
+	return o.services.now().Before(o.deadline)
+}
+
 func (o *operation) IsTimeStampValid() bool {
 	t := o.timeStamp.Add(time.Second * o.services.config.BundleTimeout)
-	return time.Now().UTC().Before(t)
+	return o.services.now().Before(t)
 }
 
 func (o *operation) PercentageComplete() int {
@@ -108,8 +154,12 @@ func (o *operation) SVGPath() string {
 func newOperation(s *Services, n *node) *operation {
 	var o operation
 	o.services = s
-	o.timeStamp = time.Now().UTC()
+	o.timeStamp = s.now()
+	o.deadline = o.timeStamp.Add(s.config.operationTimeout())
 	o.thisNode = n
+	if n != nil && len(n.networks) > 0 {
+		o.networkName = n.networks[0]
+	}
 	return &o
 }
 
@@ -122,41 +172,84 @@ func newOperationFromByteArray(s *Services, n *node, b []byte) (*operation, erro
 	return o, err
 }
 
-func newOperationFromString(s *Services, n *node, v string) (*operation, error) {
-	b, err := base64.RawURLEncoding.DecodeString(v)
+// newOperationFromString returns the operation from the encoded data using the
+// node and the keys for the table to decrypt it.
+func newOperationFromString(
+	s *Services,
+	n *node,
+	v string,
+	table string) (*operation, error) {
+	b, err := decodeValue(v)
 	if err != nil {
 		return nil, err
 	}
-	d, err := n.decrypt(b)
+	d, err := n.decryptForTable(b, s.getSecretTable(table))
 	if err != nil {
 		return nil, err
 	}
 	return newOperationFromByteArray(s, n, d)
 }
 
+// newOperationFromPath returns the operation from the last two segments of the
+// path which contain the scrambled table and the operation data.
+func newOperationFromPath(
+	s *Services,
+	n *node,
+	path string) (*operation, error) {
+	a := strings.Split(s.trimBasePath(path), "/")
+	if len(a) < 2 {
+		return nil, fmt.Errorf(
+			"Path '%s' contains insufficient segments",
+			path)
+	}
+
+	// Get the table name from the second to last segment of the URL. This is
+	// needed to find the keys that decrypt the operation.
+	t, err := n.unscramble(a[len(a)-2])
+	if err != nil {
+		return nil, err
+	}
+	o, err := newOperationFromString(s, n, a[len(a)-1], t)
+	if err != nil {
+		return nil, err
+	}
+	o.table = t
+	return o, nil
+}
+
 func newOperationFromRequest(
 	s *Services,
 	w http.ResponseWriter,
 	r *http.Request) (*operation, error) {
+	o, err := getOperationFromRequest(s, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Increase the number of nodes visited count.
+	o.nodesVisited++
+
+	return o, err
+}
+
+// getOperationFromRequest returns the operation in the path of the request
+// decrypted by the node for the request's host. The nodes visited count is
+// not changed.
+func getOperationFromRequest(s *Services, r *http.Request) (*operation, error) {
 	var o *operation
 
 	// Get the node associated with the request.
-	t, err := s.store.getNode(r.Host)
+	t, err := s.store.getNode(r.Context(), r.Host)
 	if err != nil {
 		return nil, err
 	}
 	if t == nil {
-		return nil, fmt.Errorf("'%s' is not a registered Swift node", r.Host)
+		return nil, fmt.Errorf("Host '%s': %w", r.Host, ErrNotSwiftNode)
 	}
 
-	// Get the operation data from the request using the node to decrypt.
-	a := strings.Split(r.URL.Path, "/")
-	if len(a) < 2 {
-		return nil, fmt.Errorf(
-			"Path '%s' contains insufficient segments",
-			r.URL.Path)
-	}
-	o, err = newOperationFromString(s, t, a[len(a)-1])
+	// Get the operation data and table from the request using the node to
+	// decrypt.
+	o, err = newOperationFromPath(s, t, r.URL.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -164,21 +257,18 @@ func newOperationFromRequest(
 	// Store the request incase it's needed to calculate values.
 	o.request = r
 
-	// Get the table name from the second to last segment of the URL.
-	o.table, err = o.thisNode.unscramble(a[len(a)-2])
-	if err != nil {
-		return nil, err
+	// Get the network the operation is using which the current node must
+	// belong to.
+	if o.thisNode.inNetwork(o.networkName) == false {
+		return nil, fmt.Errorf(
+			"Node '%s' is not in network '%s'",
+			o.thisNode.domain,
+			o.networkName)
 	}
-
-	// Get the network the current node is associated with.
-	o.network, err = s.store.getNodes(o.thisNode.network)
+	o.network, err = s.store.getNodes(r.Context(), o.networkName)
 	if err != nil {
 		return nil, err
 	}
-
-	// Increase the number of nodes visited count.
-	o.nodesVisited++
-
 	return o, err
 }
 
@@ -186,13 +276,14 @@ func newOperationFromRequest(
 // within a time frame that means they do not need to be sent to other nodes
 // in the network then return true.
 func (o *operation) getCookiesValid() bool {
-	t := time.Now().UTC()
+	n := o.services.now()
+	t := n
 	for _, p := range o.values {
 		if p.cookieWriteTime.Before(t) {
 			t = p.cookieWriteTime
 		}
 	}
-	d := time.Now().UTC().Sub(t) / time.Second
+	d := n.Sub(t) / time.Second
 	return d < o.services.config.HomeNodeTimeout
 }
 
@@ -206,12 +297,56 @@ func (o *operation) getCookiesPresent() bool {
 	return z
 }
 
+// scramble returns the value scrambled by the node using the encoding from the
+// configuration.
+func (o *operation) scramble(n *node, s string) string {
+	return n.scramble(o.services.config.encoding(), s)
+}
+
+// scrambleTable returns the table scrambled by the node for the path of the
+// URLs and cookies. The legacy scramble is used so that with the default
+// encoding the path is unchanged from the one used before scrambled values
+// included a version byte. Browsers only send cookies to paths that start
+// with the cookie path so any change to this segment would lose the existing
+// cookies.
+func (o *operation) scrambleTable(n *node) string {
+	return n.scrambleLegacyEncoded(o.services.config.encoding(), o.table)
+}
+
+// getCookieNames returns the names that the cookie for the key could have at
+// this node starting with the name used for new cookies. Older cookies might
+// use base 64 encoding if the encoding has since changed, or might have been
+// written before the scrambled key included a version byte.
+func (o *operation) getCookieNames(k string) []string {
+	a := []string{o.scramble(o.thisNode, k)}
+	if o.services.config.encoding() != encodingBase64URL {
+		a = append(a, o.thisNode.scramble(encodingBase64URL, k))
+	}
+	return append(a, o.thisNode.scrambleLegacy(k))
+}
+
+// getValueFromCookie returns the pair stored in the cookie for this node. If
+// none of the node's secrets could decrypt the value then the failure is
+// recorded in the metrics.
+func (o *operation) getValueFromCookie(
+	r *http.Request,
+	c *http.Cookie) (*pair, error) {
+	p, err := o.thisNode.getValueFromCookie(
+		r,
+		c,
+		o.services.getSecretTable(o.table))
+	if errors.Is(err, ErrDecryptFailed) {
+		o.services.metrics.IncCookieDecryptError(o.thisNode.domain)
+	}
+	return p, err
+}
+
 func (o *operation) setValueInCookie(
 	w http.ResponseWriter,
 	r *http.Request,
 	p *pair) error {
 	var b bytes.Buffer
-	err := writeTime(&b, time.Now().UTC())
+	err := writeTime(&b, o.services.now())
 	if err != nil {
 		return err
 	}
@@ -219,20 +354,23 @@ func (o *operation) setValueInCookie(
 	if err != nil {
 		return err
 	}
-	v, err := o.thisNode.encrypt(b.Bytes())
+	v, err := o.thisNode.encryptForTable(
+		b.Bytes(),
+		o.services.config.compressionLevel(),
+		o.services.getSecretTable(o.table))
 	if err != nil {
 		return err
 	}
 	cookie := http.Cookie{
-		Name:     o.thisNode.scramble(p.key),
+		Name:     o.scramble(o.thisNode, p.key),
 		Domain:   getDomain(r.Host),
 		Value:    base64.RawURLEncoding.EncodeToString(v),
-		Path:     fmt.Sprintf("/%s", o.thisNode.scramble(o.table)),
+		Path:     o.services.basePath + "/" + o.scrambleTable(o.thisNode),
 		SameSite: http.SameSiteLaxMode,
 		Secure:   o.services.config.Scheme == "https",
 		HttpOnly: true,
 		Expires:  p.expires}
-	http.SetCookie(w, &cookie)
+	setCookieChunks(w, r, &cookie)
 	return nil
 }
 
@@ -248,6 +386,10 @@ func (o *operation) asByteArray() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = writeTime(&b, o.deadline)
+	if err != nil {
+		return nil, err
+	}
 	err = writeString(&b, o.returnURL)
 	if err != nil {
 		return nil, err
@@ -256,6 +398,14 @@ func (o *operation) asByteArray() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = writeString(&b, o.networkName)
+	if err != nil {
+		return nil, err
+	}
+	err = writeUint32(&b, math.Float32bits(o.browserWarning))
+	if err != nil {
+		return nil, err
+	}
 	err = o.HTML.write(&b)
 	if err != nil {
 		return nil, err
@@ -276,6 +426,22 @@ func (o *operation) asByteArray() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = writeString(&b, o.nonce)
+	if err != nil {
+		return nil, err
+	}
+	err = writeString(&b, o.signature)
+	if err != nil {
+		return nil, err
+	}
+	err = writeString(&b, o.webhookURL)
+	if err != nil {
+		return nil, err
+	}
+	err = writeByte(&b, o.redundancy)
+	if err != nil {
+		return nil, err
+	}
 	err = writeByte(&b, byte(len(o.values)))
 	if err != nil {
 		return nil, err
@@ -299,6 +465,10 @@ func (o *operation) setFromByteArray(d []byte) error {
 	if err != nil {
 		return err
 	}
+	o.deadline, err = readTime(b)
+	if err != nil {
+		return err
+	}
 	o.returnURL, err = readString(b)
 	if err != nil {
 		return err
@@ -307,6 +477,15 @@ func (o *operation) setFromByteArray(d []byte) error {
 	if err != nil {
 		return err
 	}
+	o.networkName, err = readString(b)
+	if err != nil {
+		return err
+	}
+	w, err := readUint32(b)
+	if err != nil {
+		return err
+	}
+	o.browserWarning = math.Float32frombits(w)
 	err = o.HTML.set(b)
 	if err != nil {
 		return err
@@ -327,6 +506,22 @@ func (o *operation) setFromByteArray(d []byte) error {
 	if err != nil {
 		return err
 	}
+	o.nonce, err = readString(b)
+	if err != nil {
+		return err
+	}
+	o.signature, err = readString(b)
+	if err != nil {
+		return err
+	}
+	o.webhookURL, err = readString(b)
+	if err != nil {
+		return err
+	}
+	o.redundancy, err = readByte(b)
+	if err != nil {
+		return err
+	}
 	c, err := readByte(b)
 	if err != nil {
 		return err
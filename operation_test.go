@@ -17,6 +17,7 @@
 package swift
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
@@ -44,7 +45,7 @@ func TestOperation(t *testing.T) {
 		t.Fail()
 		return
 	}
-	n, err := v.getNode("test-1.com")
+	n, err := v.getNode(context.Background(), "test-1.com")
 	if err != nil {
 		fmt.Println(err)
 		t.Fail()
@@ -98,4 +99,10 @@ func TestOperation(t *testing.T) {
 		t.Fail()
 		return
 	}
+	if o1.deadline.Equal(o2.deadline) == false {
+		fmt.Println(o1.deadline)
+		fmt.Println(o2.deadline)
+		t.Fail()
+		return
+	}
 }
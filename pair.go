@@ -18,6 +18,7 @@ package swift
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"strings"
 	"time"
@@ -30,8 +31,15 @@ const (
 	conflictOldest  = iota
 	conflictNewest  = iota
 	conflictAdd     = iota
+	conflictDelete  = iota // The pair is a tombstone for a deleted value
+	conflictUnique  = iota // Add to a list ignoring values already present
+	conflictAbsent  = iota // Only store if no value exists for the key
 )
 
+// valueBinary is set in the serialized conflict flag if the value is binary
+// data encoded in URL safe base 64 so that it does not contain nulls.
+const valueBinary = 0x80
+
 // An empty pair referenced in the resolveConflict method if both parameters are
 // null.
 var emptyValue pair
@@ -43,6 +51,7 @@ type pair struct {
 	value           string    // The value as a string
 	conflict        byte      // Flag for conflict resolution
 	cookieWriteTime time.Time // Last time the cookie was written to
+	binary          bool      // True if the value is base 64 binary data
 }
 
 // Key returns the key as a string. Used with HTML templates.
@@ -68,6 +77,12 @@ func (p *pair) Conflict() string {
 		return "oldest"
 	case conflictAdd:
 		return "add"
+	case conflictDelete:
+		return "delete"
+	case conflictUnique:
+		return "unique"
+	case conflictAbsent:
+		return "absent"
 	}
 	return ""
 }
@@ -82,6 +97,8 @@ func (p *pair) setFromBuffer(b *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
+	p.binary = p.conflict&valueBinary != 0
+	p.conflict &^= valueBinary
 	p.created, err = readTime(b)
 	if err != nil {
 		return err
@@ -102,7 +119,7 @@ func (p *pair) writeToBuffer(b *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	err = writeByte(b, p.conflict)
+	err = writeByte(b, p.getConflictByte())
 	if err != nil {
 		return err
 	}
@@ -121,12 +138,50 @@ func (p *pair) writeToBuffer(b *bytes.Buffer) error {
 	return nil
 }
 
+// getConflictByte returns the conflict flag to serialize including whether the
+// value is binary.
+func (p *pair) getConflictByte() byte {
+	if p.binary {
+		return p.conflict | valueBinary
+	}
+	return p.conflict
+}
+
+// asResult returns the pair as a result for the table. Binary values are
+// decoded so that the result contains the bytes provided when the storage
+// operation was created.
+func (p *pair) asResult(table string) *Result {
+	v := p.value
+	if p.binary {
+		d, err := base64.RawURLEncoding.DecodeString(p.value)
+		if err == nil {
+			v = string(d)
+		}
+	}
+	return &Result{
+		p.key,
+		p.created,
+		p.expires,
+		v,
+		table,
+		p.conflict,
+		p.binary,
+		nil}
+}
+
 func (p *pair) present() bool {
 	return p.created.IsZero() == false
 }
 
-func (p *pair) isValid() bool {
-	return p.expires.After(time.Now().UTC())
+// isDeleted returns true if the pair is a tombstone for a deleted value.
+func (p *pair) isDeleted() bool {
+	return p.conflict == conflictDelete
+}
+
+// isExpiredAt returns true if the expiry time of the pair is not after the
+// time provided.
+func (p *pair) isExpiredAt(t time.Time) bool {
+	return p.expires.After(t) == false
 }
 
 // Merges the values that are contains in each of the pairs.
@@ -147,18 +202,39 @@ func mergeValues(o *pair, c *pair) string {
 	return strings.TrimSpace(strings.Join(v, pairListSeparator))
 }
 
-func mergePairs(o *pair, c *pair) *pair {
+// Merges the values that are contained in each of the pairs so that each value
+// appears only once. The order that values were first added in is retained.
+func mergeUniqueValues(o *pair, c *pair) string {
+	var v []string
+	f := make(map[string]bool)
+	for _, l := range []string{o.value, c.value} {
+		for _, a := range strings.Split(l, pairListSeparator) {
+			if a != "" && f[a] == false {
+				f[a] = true
+				v = append(v, a)
+			}
+		}
+	}
+	return strings.Join(v, pairListSeparator)
+}
+
+func mergePairs(o *pair, c *pair, t time.Time) *pair {
 	if o.value != c.value {
 		var n pair
-		n.conflict = conflictAdd
-		n.created = time.Now().UTC()
+		n.conflict = o.conflict
+		n.created = t
 		if o.expires.After(c.expires) {
 			n.expires = o.expires
 		} else {
 			n.expires = c.expires
 		}
 		n.key = o.key
-		n.value = mergeValues(o, c)
+		n.binary = o.binary
+		if o.conflict == conflictUnique {
+			n.value = mergeUniqueValues(o, c)
+		} else {
+			n.value = mergeValues(o, c)
+		}
 		return &n
 	}
 	return c
@@ -190,11 +266,26 @@ func resolveConflictNewest(o *pair, c *pair) *pair {
 	return c
 }
 
+// resolveConflictAbsent returns the pair that existed first unless it has
+// expired. Used to only store a value if no value already exists for the key.
+// If both pairs are from different storage operations the oldest is the one
+// that existed first.
+func resolveConflictAbsent(o *pair, c *pair, t time.Time) *pair {
+	if c.isExpiredAt(t) {
+		return o
+	}
+	if o.isExpiredAt(t) {
+		return c
+	}
+	return resolveConflictOldest(o, c)
+}
+
 // Where there are two pairs for the same key determine which one should be used
 // for the next operation in the storage operation.
 // o is the pair from the storage operation
 // c is the pair stored in a cookie for the current node
-func resolveConflict(o *pair, c *pair) (*pair, error) {
+// t is the current time
+func resolveConflict(o *pair, c *pair, t time.Time) (*pair, error) {
 	var p *pair
 	if o == nil && c == nil {
 		// Neither has any information.
@@ -205,6 +296,18 @@ func resolveConflict(o *pair, c *pair) (*pair, error) {
 	} else if o == nil && c != nil {
 		// c is the only valid pair.
 		p = c
+	} else if o.isDeleted() || c.isDeleted() {
+		// A tombstone wins over any pair created before it. A pair created
+		// after the tombstone replaces the deleted value.
+		if c.created.After(o.created) {
+			p = c
+		} else if o.created.After(c.created) {
+			p = o
+		} else if o.isDeleted() {
+			p = o
+		} else {
+			p = c
+		}
 	} else {
 		// Resolve any conflict using o's conflict flag.
 		switch o.conflict {
@@ -214,8 +317,10 @@ func resolveConflict(o *pair, c *pair) (*pair, error) {
 			p = resolveConflictNewest(o, c)
 		case conflictOldest:
 			p = resolveConflictOldest(o, c)
-		case conflictAdd:
-			p = mergePairs(o, c)
+		case conflictAdd, conflictUnique:
+			p = mergePairs(o, c, t)
+		case conflictAbsent:
+			p = resolveConflictAbsent(o, c, t)
 		default:
 			p = o
 		}
@@ -18,7 +18,11 @@ package swift
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -63,3 +67,314 @@ func TestPair(t *testing.T) {
 	testCompareDate(t, a.created, b.created)
 	testCompareDate(t, a.expires, b.expires)
 }
+
+func TestPairMergeUnique(t *testing.T) {
+	o := testPair("list", "a\r\nb\r\nc\r\nb", conflictUnique, 0)
+	c := testPair("list", "d\r\nc\r\na\r\ne\r\nd", conflictUnique, time.Second)
+	p, err := resolveConflict(o, c, time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if p.conflict != conflictUnique {
+		fmt.Printf("Conflict '%s' should be unique\n", p.Conflict())
+		t.Fail()
+	}
+	e := "a\r\nb\r\nc\r\nd\r\ne"
+	if p.value != e {
+		fmt.Printf("Expected '%q' but found '%q'\n", e, p.value)
+		t.Fail()
+	}
+
+	// Merging the same values again must not change the list.
+	p, err = resolveConflict(p, c, time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if p.value != e {
+		fmt.Printf("Expected '%q' but found '%q'\n", e, p.value)
+		t.Fail()
+	}
+}
+
+func TestPairCreateUnique(t *testing.T) {
+	p, err := createPair(
+		"segments*"+time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02"),
+		"a",
+		time.Now().UTC(),
+		&Configuration{})
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if p.key != "segments" || p.conflict != conflictUnique {
+		fmt.Printf("Key '%s' with conflict '%s' incorrect\n",
+			p.key,
+			p.Conflict())
+		t.Fail()
+	}
+}
+
+func TestPairIsExpired(t *testing.T) {
+	n := time.Now().UTC()
+	l := testPair("live", "1", conflictNewest, 0)
+	e := testPair("expired", "1", conflictNewest, 0)
+	e.expires = n.Add(-time.Second)
+	if l.isExpiredAt(n) || e.isExpiredAt(n) == false {
+		fmt.Println("Pair expiry incorrect")
+		t.Fail()
+	}
+}
+
+func TestPairCreateAbsent(t *testing.T) {
+	p, err := createPair(
+		"id?"+time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02"),
+		"a",
+		time.Now().UTC(),
+		&Configuration{})
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if p.key != "id" || p.conflict != conflictAbsent {
+		fmt.Printf("Key '%s' with conflict '%s' incorrect\n",
+			p.key,
+			p.Conflict())
+		t.Fail()
+	}
+}
+
+func TestPairAbsentStoredOnce(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n, err := s.store.getNode(context.Background(), "storage-1.com")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The first write is stored as there is no existing value.
+	f := newOperation(s, n)
+	f.table = "table"
+	f.values = []*pair{testPair("id", "first", conflictAbsent, 0)}
+	w := httptest.NewRecorder()
+	err = f.processCookies(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c := w.Result().Cookies()
+	if len(c) != 1 || f.values[0].value != "first" {
+		fmt.Println("First write should be stored")
+		t.Fail()
+		return
+	}
+
+	// The second write is ignored and the original value returned.
+	o := newOperation(s, n)
+	o.table = "table"
+	o.values = []*pair{testPair("id", "second", conflictAbsent, time.Hour)}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c[0])
+	w = httptest.NewRecorder()
+	err = o.processCookies(w, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if o.values[0].value != "first" {
+		fmt.Printf("Value '%s' should be 'first'\n", o.values[0].value)
+		t.Fail()
+	}
+	for _, i := range w.Result().Cookies() {
+		v, err := n.getValueFromCookie(nil, i, "")
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if v.value != "first" {
+			fmt.Printf("Cookie value '%s' should be 'first'\n", v.value)
+			t.Fail()
+		}
+	}
+}
+
+func TestPairAbsentExpired(t *testing.T) {
+	e := testPair("id", "expired", conflictAbsent, -time.Hour)
+	e.expires = time.Now().UTC().Add(-time.Second)
+	p := testPair("id", "new", conflictAbsent, 0)
+	r, err := resolveConflict(p, e, time.Now().UTC())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if r != p {
+		fmt.Println("Value should be stored when the existing value expired")
+		t.Fail()
+	}
+}
+
+func TestPairCreateBareKeyStrict(t *testing.T) {
+	_, err := createPair("id", "a", time.Now().UTC(), &Configuration{})
+	if err == nil {
+		fmt.Println("Bare key should be invalid in strict mode")
+		t.Fail()
+	}
+}
+
+func TestPairCreateBareKeyLenient(t *testing.T) {
+	n := time.Now().UTC()
+	c := &Configuration{DefaultExpiry: 30}
+	p, err := createPair("id", "a", n, c)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if p.key != "id" || p.value != "a" || p.conflict != conflictNewest {
+		fmt.Printf("Key '%s' with conflict '%s' incorrect\n",
+			p.key,
+			p.Conflict())
+		t.Fail()
+	}
+	if p.expires.Equal(n.AddDate(0, 0, 30)) == false {
+		fmt.Printf("Expiry '%s' should be 30 days after '%s'\n", p.expires, n)
+		t.Fail()
+	}
+
+	// Keys with a conflict character are unaffected.
+	p, err = createPair(
+		"id<"+n.AddDate(0, 1, 0).Format("2006-01-02"),
+		"a",
+		n,
+		c)
+	if err != nil || p.key != "id" || p.conflict != conflictOldest {
+		fmt.Println("Key with conflict character should be unaffected")
+		t.Fail()
+	}
+}
+
+func TestPairCreateMaxExpiry(t *testing.T) {
+	n := time.Now().UTC()
+	c := &Configuration{MaxExpiry: 365}
+	for d, v := range map[int]bool{
+		30:   true,
+		364:  true,
+		400:  false,
+		3650: false} {
+		_, err := createPair(
+			"id>"+n.AddDate(0, 0, d).Format("2006-01-02"),
+			"a",
+			n,
+			c)
+		if (err == nil) != v {
+			fmt.Printf("Expiry '%d' days valid should be '%t' but got '%v'\n",
+				d,
+				v,
+				err)
+			t.Fail()
+		}
+	}
+
+	// Without a maximum far future dates are accepted.
+	_, err := createPair("id>9999-12-31", "a", n, &Configuration{})
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+}
+
+func TestPairCreateInvalidUTF8(t *testing.T) {
+	n := time.Now().UTC()
+	k := "id<" + n.AddDate(0, 1, 0).Format("2006-01-02")
+	for _, v := range [][]string{
+		{"id\xff<" + n.AddDate(0, 1, 0).Format("2006-01-02"), "a"},
+		{k, "a\xc3"}} {
+		_, err := createPair(v[0], v[1], n, &Configuration{})
+		if err == nil || strings.Contains(err.Error(), "UTF-8") == false {
+			fmt.Printf("Expected UTF-8 error for %q but got '%v'\n", v, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestPairCreateNormalize(t *testing.T) {
+	n := time.Now().UTC()
+	d := "<" + n.AddDate(0, 1, 0).Format("2006-01-02")
+	c := &Configuration{NormalizeUnicode: true}
+	p, err := createPair("cafe\u0301"+d, "cre\u0300me", n, c)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if p.key != "caf\u00e9" || p.value != "cr\u00e8me" {
+		fmt.Printf("Key %q and value %q not normalized\n", p.key, p.value)
+		t.Fail()
+	}
+
+	// Without normalization the key is unaltered.
+	p, err = createPair("cafe\u0301"+d, "a", n, &Configuration{})
+	if err != nil || p.key != "cafe\u0301" {
+		fmt.Println("Key should not be normalized")
+		t.Fail()
+	}
+}
+
+func TestPairNormalizeMerge(t *testing.T) {
+	s, n, err := NewTestNetwork(1, 3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	s.config.NormalizeUnicode = true
+	d := "<" + time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02")
+
+	// Store the value for the key in decomposed form and then read it with the
+	// key in composed form. Oldest wins so the first value is returned.
+	var a []*Result
+	for i, k := range []string{"cafe\u0301", "caf\u00e9"} {
+		q := url.Values{}
+		q.Set(returnURLParam, "https://return.com/path?data=")
+		q.Set(tableParam, "table")
+		q.Set(k+d, fmt.Sprint(i))
+		u, err := n.Create(q)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		e, err := n.Follow(u)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		a, err = n.Decode(e)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+	}
+	if len(a) != 1 || a[0].Key != "caf\u00e9" || a[0].Value != "0" {
+		fmt.Printf("Expected keys to merge but got '%v'\n", a)
+		t.Fail()
+	}
+}
@@ -0,0 +1,54 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import "time"
+
+// PruneExpired removes the state held by the node that has expired and returns
+// the number of items removed. Values are stored in cookies which expire at the
+// same time as the value so they are removed by the browser. The node retains
+// the nonces of completed operations to prevent results being used more than
+// once. Nonces whose results have expired are removed from the in memory nonce
+// store. A store set with SetNonceStore is responsible for its own expiry.
+// Safe to call concurrently with requests.
+func (s *Services) PruneExpired() int {
+	return s.nonces.removeExpired(s.now())
+}
+
+// StartPruneExpired removes expired state every PruneInterval seconds in the
+// background until the stop channel is closed. If PruneInterval is zero then
+// no background sweeps are performed.
+func (s *Services) StartPruneExpired(stop <-chan struct{}) {
+	if s.config.PruneInterval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(time.Second * s.config.PruneInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				n := s.PruneExpired()
+				if n > 0 {
+					s.logger.Info("Pruned '%d' expired items", n)
+				}
+			}
+		}
+	}()
+}
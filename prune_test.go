@@ -0,0 +1,90 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPruneExpired(t *testing.T) {
+	s, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The expired nonce is recorded after one that has not expired so that it
+	// is not removed when the oldest nonces are pruned.
+	n := time.Now().UTC()
+	s.nonces.use("live", n.Add(time.Hour))
+	s.nonces.use("expired", n.Add(-time.Second))
+	if _, ok := s.nonces.expires["expired"]; ok == false {
+		fmt.Println("Expired nonce should be stored before pruning")
+		t.Fail()
+		return
+	}
+	c := s.PruneExpired()
+	if c != 1 {
+		fmt.Printf("Expected '1' item pruned but got '%d'\n", c)
+		t.Fail()
+	}
+	if _, ok := s.nonces.expires["expired"]; ok {
+		fmt.Println("Expired nonce should be removed")
+		t.Fail()
+	}
+	if _, ok := s.nonces.expires["live"]; ok == false {
+		fmt.Println("Live nonce should be retained")
+		t.Fail()
+	}
+	if len(s.nonces.order) != 1 {
+		fmt.Printf("Expected '1' nonce but found '%d'\n", len(s.nonces.order))
+		t.Fail()
+	}
+}
+
+func TestPruneExpiredConcurrent(t *testing.T) {
+	s, err := newServicesTest(newVolatile())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	var w sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		w.Add(1)
+		go func(i int) {
+			defer w.Done()
+			for j := 0; j < 100; j++ {
+				s.nonces.use(
+					fmt.Sprintf("%d-%d", i, j),
+					time.Now().UTC().Add(time.Duration(j%2)*time.Hour))
+				s.PruneExpired()
+			}
+		}(i)
+	}
+	w.Wait()
+	s.PruneExpired()
+	if len(s.nonces.order) != 200 || len(s.nonces.expires) != 200 {
+		fmt.Printf("Expected '200' nonces but found '%d'\n",
+			len(s.nonces.order))
+		t.Fail()
+	}
+}
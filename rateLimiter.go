@@ -0,0 +1,100 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter interface for limiting the number of requests made with the same
+// key. An implementation can be provided to Services to share the limits
+// across multiple instances.
+type RateLimiter interface {
+
+	// Allow returns true if a request with the key can proceed, otherwise
+	// false.
+	Allow(key string) bool
+}
+
+// tokenBucket is an in memory implementation of RateLimiter. Each key has a
+// bucket that holds up to burst tokens and is refilled at rate tokens per
+// second. A request uses one token.
+type tokenBucket struct {
+	rate    float64                 // Tokens added to each bucket per second
+	burst   float64                 // Most tokens a bucket can hold
+	buckets map[string]*bucketState // The state of the bucket for each key
+	mutex   *sync.Mutex             // Guards the buckets map
+	now     func() time.Time        // Returns the current time
+}
+
+type bucketState struct {
+	tokens float64   // Tokens available when last updated
+	last   time.Time // Time the tokens were last updated
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	var b tokenBucket
+	b.rate = rate
+	b.burst = float64(burst)
+	if b.burst < 1 {
+		b.burst = 1
+	}
+	b.buckets = make(map[string]*bucketState)
+	b.mutex = &sync.Mutex{}
+	b.now = time.Now
+	return &b
+}
+
+// Allow returns true if the bucket for the key contains a token, removing the
+// token.
+func (b *tokenBucket) Allow(key string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	t := b.now()
+	s := b.buckets[key]
+	if s == nil {
+		s = &bucketState{b.burst, t}
+		b.buckets[key] = s
+	} else {
+		s.tokens += t.Sub(s.last).Seconds() * b.rate
+		if s.tokens > b.burst {
+			s.tokens = b.burst
+		}
+		s.last = t
+	}
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// getRateLimitKey returns the key used to rate limit the request. This is the
+// access key if provided, otherwise the IP address of the client.
+func getRateLimitKey(r *http.Request) string {
+	if k := getAccessKey(r); k != "" {
+		return accessKey + ":" + k
+	}
+	h, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		h = r.RemoteAddr
+	}
+	return remoteAddr + ":" + h
+}
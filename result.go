@@ -17,25 +17,101 @@
 package swift
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"time"
 )
 
+// resultsVersion is the first byte of encoded results and is incremented when
+// the fields change. Results encoded before the version byte was added start
+// with the length of the expiry time which is never the version so they are
+// rejected rather than misread.
+const resultsVersion = 1
+
 // Result from a storage operation.
 type Result struct {
-	Key     string    // The name of the key associated with the value
-	Created time.Time // The UTC time that the value was created
-	Expires time.Time // The UTC time that the value will expire
-	Value   string    // The value as a byte array
+	Key      string    // The name of the key associated with the value
+	Created  time.Time // The UTC time that the value was created
+	Expires  time.Time // The UTC time that the value will expire
+	Value    string    // The value as a byte array
+	Table    string    // The table the value was stored in
+	conflict byte      // Flag for conflict resolution when results are merged
+	binary   bool      // True if the value was stored as binary data
+	clock    Clock     // Clock for the current time, or nil for the system
+}
+
+// Bytes returns the value as a byte array. For values stored as binary data
+// these are the bytes provided when the storage operation was created.
+func (r *Result) Bytes() []byte { return []byte(r.Value) }
+
+// IsBinary returns true if the value was stored as binary data.
+func (r *Result) IsBinary() bool { return r.binary }
+
+// MarshalJSON returns the result as JSON. Binary values are provided in URL
+// safe base 64 with the Binary field set to true because JSON strings can not
+// carry arbitrary bytes.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	type result Result
+	if r.binary == false {
+		return json.Marshal((*result)(r))
+	}
+	return json.Marshal(struct {
+		*result
+		Value  string
+		Binary bool
+	}{(*result)(r), base64.RawURLEncoding.EncodeToString(r.Bytes()), true})
+}
+
+// UnmarshalJSON sets the result from JSON returned by MarshalJSON decoding
+// binary values.
+func (r *Result) UnmarshalJSON(b []byte) error {
+	type result Result
+	v := struct {
+		*result
+		Value  string
+		Binary bool
+	}{result: (*result)(r)}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+	r.Value = v.Value
+	r.binary = v.Binary
+	if v.Binary {
+		d, err := base64.RawURLEncoding.DecodeString(v.Value)
+		if err != nil {
+			return err
+		}
+		r.Value = string(d)
+	}
+	return nil
+}
+
+// IsExpired returns true if the expiry time of the value has passed.
+func (r *Result) IsExpired() bool {
+	return r.isExpiredAt(nowFrom(r.clock))
+}
+
+// isExpiredAt returns true if the expiry time of the value is not after the
+// time provided.
+func (r *Result) isExpiredAt(t time.Time) bool {
+	return r.Expires.After(t) == false
 }
 
 // Results from a storage operation.
 type Results struct {
 	Expires time.Time // The time after which the data can not be decrypted
 	State   string    // Optional state information
+	Table   string    // The table the values were stored in
 	Values  []*Result // Array of values
 	HTML              // Include the common HTML UI members.
+	nonce   string    // Unique to the operation that produced the results
+	clock   Clock     // Clock for the current time, or nil for the system
 }
 
 // Get returns the result for the key provided, or nil if the key does not
@@ -49,60 +125,268 @@ func (r *Results) Get(key string) *Result {
 	return nil
 }
 
+// Has returns true if the results contain a value for the key that has not
+// expired.
+func (r *Results) Has(key string) bool {
+	return r.hasAt(key, nowFrom(r.clock))
+}
+
+// hasAt returns true if the results contain a value for the key that has not
+// expired at the time provided.
+func (r *Results) hasAt(key string, t time.Time) bool {
+	for _, v := range r.Values {
+		if key == v.Key && v.isExpiredAt(t) == false {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys returns the names of the keys in the results in the order they appear.
+func (r *Results) Keys() []string {
+	k := make([]string, 0, len(r.Values))
+	for _, v := range r.Values {
+		k = append(k, v.Key)
+	}
+	return k
+}
+
+// Merge returns new results containing the values from both results. Where
+// both contain a value for the same key the conflict is resolved in the same
+// way as a storage node would using the conflict flag of the value in these
+// results. Values only present in one of the results are included unaltered.
+// The merged results expire when the first of the two results expire.
+func (r *Results) Merge(other *Results) *Results {
+	m := *r
+	m.nonce = ""
+	m.Values = make([]*Result, 0, len(r.Values)+len(other.Values))
+	if other.Expires.Before(m.Expires) {
+		m.Expires = other.Expires
+	}
+	t := nowFrom(r.clock)
+	for _, o := range r.Values {
+		c := other.Get(o.Key)
+		if c == nil {
+			m.Values = append(m.Values, o)
+			continue
+		}
+		a, b := o.asPair(), c.asPair()
+		p, err := resolveConflict(a, b, t)
+		if err != nil || p == a {
+			// If the conflict flag is not known the value in these results is
+			// used.
+			m.Values = append(m.Values, o)
+		} else if p == b {
+			m.Values = append(m.Values, c)
+		} else {
+			m.Values = append(m.Values, p.asResult(o.Table))
+		}
+	}
+	for _, c := range other.Values {
+		if r.Get(c.Key) == nil {
+			m.Values = append(m.Values, c)
+		}
+	}
+	return &m
+}
+
+// asPair returns the result as a pair so that storage node conflict
+// resolution can be used with results. Binary values are encoded as they are
+// in storage operations.
+func (r *Result) asPair() *pair {
+	v := r.Value
+	if r.binary {
+		v = base64.RawURLEncoding.EncodeToString(r.Bytes())
+	}
+	return &pair{r.Key, r.Created, r.Expires, v, r.conflict, time.Time{}, r.binary}
+}
+
+// removeExpired removes the values that have expired. Used to ensure values
+// are not returned after they expire if a storage node has not yet removed
+// them.
+func (r *Results) removeExpired(t time.Time) {
+	v := r.Values[:0]
+	for _, e := range r.Values {
+		if e.isExpiredAt(t) == false {
+			v = append(v, e)
+		}
+	}
+	r.Values = v
+}
+
 // IsTimeStampValid returns true if the time stamp of the result is valid.
 func (r *Results) IsTimeStampValid() bool {
-	return time.Now().UTC().Before(r.Expires)
+	return r.isTimeStampValidAt(nowFrom(r.clock), 0)
+}
+
+// setClock sets the clock used by the results and their values for the
+// current time.
+func (r *Results) setClock(c Clock) {
+	r.clock = c
+	for _, v := range r.Values {
+		v.clock = c
+	}
 }
 
-// DecodeResults turns a byte array into a results data structure.
+// isTimeStampValidAt returns true if the time stamp of the result is valid at
+// the time provided allowing for the clocks of the nodes differing by up to
+// the skew.
+func (r *Results) isTimeStampValidAt(t time.Time, skew time.Duration) bool {
+	return t.Before(r.Expires.Add(skew))
+}
+
+// DecodeResults turns a byte array into a results data structure. The values
+// are in the order they were encoded so the same byte array always produces
+// the same results.
 func DecodeResults(d []byte) (*Results, error) {
-	var err error
-	var r Results
 	if d == nil {
 		return nil, errors.New("Byte array empty")
 	}
-	b := bytes.NewBuffer(d)
-	r.Expires, err = readTime(b)
+	return DecodeResultsReader(bytes.NewBuffer(d))
+}
+
+// DecodeResultsReader reads all the values from the stream into a results data
+// structure.
+func DecodeResultsReader(r io.Reader) (*Results, error) {
+	i, err := NewResultsReader(r)
 	if err != nil {
 		return nil, err
 	}
-	r.State, err = readString(b)
+	a := i.Results()
+	for {
+		v, err := i.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.Values = append(a.Values, v)
+	}
+	return a, nil
+}
+
+// ResultsReader reads the values from encoded results one at a time so that
+// all the values do not need to be held in memory.
+type ResultsReader struct {
+	results   Results    // The fields that precede the values
+	reader    byteReader // The stream containing the values
+	remaining byte       // The number of values still to be read
+}
+
+// NewResultsReader reads the fields that precede the values from the stream
+// returning a reader that can be used to read each of the values.
+func NewResultsReader(r io.Reader) (*ResultsReader, error) {
+	var err error
+	var i ResultsReader
+	b, ok := r.(byteReader)
+	if ok == false {
+		b = bufio.NewReader(r)
+	}
+	i.reader = b
+	v, err := readByte(b)
 	if err != nil {
 		return nil, err
 	}
-	err = r.HTML.set(b)
+	if v != resultsVersion {
+		return nil, fmt.Errorf(
+			"Results version '%d' must be '%d': %w",
+			v,
+			resultsVersion,
+			ErrResultsVersion)
+	}
+	i.results.Expires, err = readTime(b)
 	if err != nil {
 		return nil, err
 	}
-	n, err := readByte(b)
+	i.results.State, err = readString(b)
 	if err != nil {
 		return nil, err
 	}
-	for i := byte(0); i < n; i++ {
-		k, err := readString(b)
-		if err != nil {
-			return nil, err
-		}
-		c, err := readDate(b)
-		if err != nil {
-			return nil, err
-		}
-		e, err := readDate(b)
-		if err != nil {
-			return nil, err
-		}
-		v, err := readString(b)
+	i.results.Table, err = readString(b)
+	if err != nil {
+		return nil, err
+	}
+	i.results.nonce, err = readString(b)
+	if err != nil {
+		return nil, err
+	}
+	err = i.results.HTML.set(b)
+	if err != nil {
+		return nil, err
+	}
+	i.remaining, err = readByte(b)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// Results returns a copy of the fields that precede the values. The values are
+// not included and must be read using Next.
+func (i *ResultsReader) Results() *Results {
+	r := i.results
+	return &r
+}
+
+// Next returns the next value, or io.EOF if there are no more values.
+func (i *ResultsReader) Next() (*Result, error) {
+	if i.remaining == 0 {
+		return nil, io.EOF
+	}
+	r, err := i.readResult()
+	if err == io.EOF {
+
+		// The stream ended part way through a value. Any io.EOF returned here
+		// must not be confused with the end of the values.
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	i.remaining--
+	return r, nil
+}
+
+func (i *ResultsReader) readResult() (*Result, error) {
+	k, err := readString(i.reader)
+	if err != nil {
+		return nil, err
+	}
+	c, err := readDate(i.reader)
+	if err != nil {
+		return nil, err
+	}
+	e, err := readDate(i.reader)
+	if err != nil {
+		return nil, err
+	}
+	v, err := readString(i.reader)
+	if err != nil {
+		return nil, err
+	}
+	f, err := readByte(i.reader)
+	if err != nil {
+		return nil, err
+	}
+	if f&valueBinary != 0 {
+		d, err := base64.RawURLEncoding.DecodeString(v)
 		if err != nil {
 			return nil, err
 		}
-		r.Values = append(r.Values, &Result{k, c, e, v})
+		return &Result{k, c, e, string(d), i.results.Table, f &^ valueBinary,
+			true, nil}, nil
 	}
-	return &r, nil
+	return &Result{k, c, e, v, i.results.Table, f, false, nil}, nil
 }
 
 func encodeResults(r *Results) ([]byte, error) {
 	var b bytes.Buffer
 	var err error
+	err = writeByte(&b, resultsVersion)
+	if err != nil {
+		return nil, err
+	}
 	err = writeTime(&b, r.Expires)
 	if err != nil {
 		return nil, err
@@ -111,6 +395,14 @@ func encodeResults(r *Results) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = writeString(&b, r.Table)
+	if err != nil {
+		return nil, err
+	}
+	err = writeString(&b, r.nonce)
+	if err != nil {
+		return nil, err
+	}
 	err = r.HTML.write(&b)
 	if err != nil {
 		return nil, err
@@ -132,7 +424,18 @@ func encodeResults(r *Results) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		err = writeString(&b, e.Value)
+		if e.binary {
+			err = writeString(&b, base64.RawURLEncoding.EncodeToString(
+				e.Bytes()))
+			if err == nil {
+				err = writeByte(&b, e.conflict|valueBinary)
+			}
+		} else {
+			err = writeString(&b, e.Value)
+			if err == nil {
+				err = writeByte(&b, e.conflict)
+			}
+		}
 		if err != nil {
 			return nil, err
 		}
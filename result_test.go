@@ -0,0 +1,295 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestResultsReaderMatchesDecode(t *testing.T) {
+	r := newResultsTest(255)
+	for _, v := range r.Values {
+		v.Value = strings.Repeat(v.Value, 100)
+	}
+	d, err := encodeResults(r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := DecodeResults(d)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Use a reader that is not a byteReader so that the stream is buffered.
+	i, err := NewResultsReader(iotest.OneByteReader(bytes.NewReader(d)))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if i.Results().State != a.State ||
+		i.Results().Expires.Equal(a.Expires) == false ||
+		i.Results().HTML != a.HTML {
+		fmt.Println("Results fields do not match")
+		t.Fail()
+	}
+	c := 0
+	for {
+		v, err := i.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		e := a.Values[c]
+		if v.Key != e.Key ||
+			v.Value != e.Value ||
+			v.Created.Equal(e.Created) == false ||
+			v.Expires.Equal(e.Expires) == false {
+			fmt.Printf("Value '%d' does not match\n", c)
+			t.Fail()
+		}
+		c++
+	}
+	if c != len(a.Values) || c != 255 {
+		fmt.Printf("Expected '%d' values but read '%d'\n", len(a.Values), c)
+		t.Fail()
+	}
+}
+
+func TestResultsReaderTruncated(t *testing.T) {
+	d, err := encodeResults(newResultsTest(10))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, err = DecodeResultsReader(bytes.NewReader(d[:len(d)-5]))
+	if err == nil {
+		fmt.Println("Truncated results should return an error")
+		t.Fail()
+	}
+}
+
+func TestResultsVersion(t *testing.T) {
+	d, err := encodeResults(newResultsTest(3))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if d[0] != resultsVersion {
+		fmt.Printf("Expected version '%d' but got '%d'\n", resultsVersion, d[0])
+		t.Fail()
+		return
+	}
+
+	// Results encoded before the version byte start with the expiry time.
+	_, err = DecodeResults(d[1:])
+	testErrorsIs(t, err, ErrResultsVersion)
+
+	// Results from a later version must also be rejected.
+	d[0] = resultsVersion + 1
+	_, err = NewResultsReader(bytes.NewReader(d))
+	testErrorsIs(t, err, ErrResultsVersion)
+}
+
+func TestResultsTable(t *testing.T) {
+	r := newResultsTest(3)
+	r.Table = "known"
+	d, err := encodeResults(r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := DecodeResults(d)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if a.Table != "known" {
+		fmt.Printf("Table '%s' should be 'known'\n", a.Table)
+		t.Fail()
+	}
+	for _, v := range a.Values {
+		if v.Table != "known" {
+			fmt.Printf("Value '%s' table '%s' should be 'known'\n",
+				v.Key,
+				v.Table)
+			t.Fail()
+		}
+	}
+	if a.IsTimeStampValid() == false {
+		fmt.Println("Time stamp should be valid")
+		t.Fail()
+	}
+}
+
+func TestResultsTimeStampSkew(t *testing.T) {
+	var r Results
+	r.Expires = time.Now().UTC()
+	s := time.Second * defaultClockSkew
+	for _, c := range []struct {
+		at    time.Time
+		skew  time.Duration
+		valid bool
+	}{
+		{r.Expires, 0, false},
+		{r.Expires, s, true},
+		{r.Expires.Add(-time.Second), 0, true},
+		{r.Expires.Add(s - time.Second), s, true},
+		{r.Expires.Add(s), s, false},
+		{r.Expires.Add(time.Hour), s, false}} {
+		if r.isTimeStampValidAt(c.at, c.skew) != c.valid {
+			fmt.Printf("Time '%s' with skew '%s' should be valid '%t'\n",
+				c.at.Sub(r.Expires),
+				c.skew,
+				c.valid)
+			t.Fail()
+		}
+	}
+}
+
+func TestResultsMerge(t *testing.T) {
+	n := time.Now().UTC()
+	e := n.Add(time.Hour)
+	a := &Results{Expires: e, State: "a", Values: []*Result{
+		{"oldest", n, e, "a", "", conflictOldest, false, nil},
+		{"newest", n, e, "a", "", conflictNewest, false, nil},
+		{"list", n, e, "1\r\n2", "", conflictAdd, false, nil},
+		{"onlyA", n, e, "a", "", conflictNewest, false, nil}}}
+	b := &Results{Expires: e.Add(-time.Minute), State: "b", Values: []*Result{
+		{"oldest", n.Add(time.Second), e, "b", "", conflictOldest, false, nil},
+		{"newest", n.Add(time.Second), e, "b", "", conflictNewest, false, nil},
+		{"list", n.Add(time.Second), e, "2\r\n3", "", conflictAdd, false, nil},
+		{"onlyB", n, e, "b", "", conflictNewest, false, nil}}}
+	m := a.Merge(b)
+	for k, v := range map[string]string{
+		"oldest": "a",
+		"newest": "b",
+		"list":   "1\r\n2\r\n3",
+		"onlyA":  "a",
+		"onlyB":  "b"} {
+		r := m.Get(k)
+		if r == nil || r.Value != v {
+			fmt.Printf("Key '%s' should have value '%s'\n", k, v)
+			t.Fail()
+		}
+	}
+	if len(m.Values) != 5 {
+		fmt.Printf("Expected '5' values but found '%d'\n", len(m.Values))
+		t.Fail()
+	}
+	if m.State != "a" || m.Expires.Equal(b.Expires) == false {
+		fmt.Println("Merged results should expire with the first results")
+		t.Fail()
+	}
+
+	// The results merged are not altered.
+	if a.Get("list").Value != "1\r\n2" || len(a.Values) != 4 {
+		fmt.Println("Merge should not alter the results")
+		t.Fail()
+	}
+}
+
+func TestResultsKeys(t *testing.T) {
+	k := newResultsTest(3).Keys()
+	if len(k) != 3 || k[0] != "key0" || k[1] != "key1" || k[2] != "key2" {
+		fmt.Printf("Keys '%v' incorrect\n", k)
+		t.Fail()
+	}
+}
+
+func TestResultsBinaryValue(t *testing.T) {
+	b := []byte{0, 'a', 0, 255, 0}
+	n := time.Now().UTC()
+	p := &pair{
+		key:      "bitmap",
+		created:  n,
+		expires:  n.Add(time.Hour),
+		value:    base64.RawURLEncoding.EncodeToString(b),
+		conflict: conflictNewest,
+		binary:   true}
+	r := &Results{Expires: n.Add(time.Hour)}
+	r.Values = append(r.Values, p.asResult("table"))
+	d, err := encodeResults(r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := DecodeResults(d)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	v := a.Get("bitmap")
+	if v == nil ||
+		v.IsBinary() == false ||
+		v.conflict != conflictNewest ||
+		bytes.Equal(v.Bytes(), b) == false {
+		fmt.Println("Binary value should be unchanged")
+		t.Fail()
+		return
+	}
+
+	// JSON carries the value in base 64.
+	j, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	var c Result
+	err = json.Unmarshal(j, &c)
+	if err != nil || bytes.Equal(c.Bytes(), b) == false {
+		fmt.Println(string(j))
+		t.Fail()
+	}
+}
+
+func TestResultsHas(t *testing.T) {
+	r := newResultsTest(2)
+	r.Values[1].Expires = time.Now().UTC().Add(-time.Minute)
+	for k, e := range map[string]bool{
+		"key0":    true,
+		"key1":    false,
+		"missing": false} {
+		if r.Has(k) != e {
+			fmt.Printf("Has '%s' should be '%t'\n", k, e)
+			t.Fail()
+		}
+	}
+}
@@ -18,35 +18,98 @@ package swift
 
 import (
 	"encoding/base64"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Incremented for every successful decryption. Recorded against the secret that
+// succeeded so that the most recently used secrets can be tried first.
+var decryptSequence uint64
+
 type secret struct {
 	timeStamp time.Time
 	key       string
 	crypto    *crypto
+	used      uint64   // Sequence of the last successful decryption, or zero
+	tables    sync.Map // The crypto for each table derived from the key
 }
 
-func newSecret() (*secret, error) {
+// Salt used when deriving table keys from a secret so that the derived keys
+// are distinct from keys derived for any other purpose.
+const tableKeySalt = "swift-table-key"
+
+// newSecret returns a new secret with a random key that becomes active at the
+// time provided.
+func newSecret(timeStamp time.Time) (*secret, error) {
+	return newSecretWithAEAD(aeadGCM, timeStamp)
+}
+
+// newSecretWithAEAD returns a new secret with a random key that encrypts data
+// with the AEAD provided and becomes active at the time provided.
+func newSecretWithAEAD(aead byte, timeStamp time.Time) (*secret, error) {
 	b, err := randomBytes(32)
 	if err != nil {
 		return nil, err
 	}
-	x, err := newCrypto(b)
+	x, err := newCryptoWithAEAD(b, aead)
 	if err != nil {
 		return nil, err
 	}
-	return &secret{time.Now(), base64.RawURLEncoding.EncodeToString(b), x}, nil
+	return &secret{
+		timeStamp: timeStamp,
+		key:       base64.RawURLEncoding.EncodeToString(b),
+		crypto:    x}, nil
 }
 
 func newSecretFromKey(key string, timeStamp time.Time) (*secret, error) {
+	return newSecretFromKeyWithAEAD(key, timeStamp, aeadGCM)
+}
+
+// newSecretFromKeyWithAEAD returns the secret for the key that encrypts data
+// with the AEAD provided. Used when loading secrets that were persisted with
+// their AEAD.
+func newSecretFromKeyWithAEAD(
+	key string,
+	timeStamp time.Time,
+	aead byte) (*secret, error) {
 	b, err := base64.RawURLEncoding.DecodeString(key)
 	if err != nil {
 		return nil, err
 	}
-	x, err := newCrypto(b)
+	x, err := newCryptoWithAEAD(b, aead)
+	if err != nil {
+		return nil, err
+	}
+	return &secret{timeStamp: timeStamp, key: key, crypto: x}, nil
+}
+
+// setUsed records that the secret has just decrypted data.
+func (x *secret) setUsed() {
+	atomic.StoreUint64(&x.used, atomic.AddUint64(&decryptSequence, 1))
+}
+
+// getCrypto returns the crypto for the table using a key derived from the
+// secret key and the table name with HKDF. If the table is empty then the
+// crypto for the secret key is returned. Derived crypto uses the same AEAD as
+// the secret and is cached.
+func (x *secret) getCrypto(table string) (*crypto, error) {
+	if table == "" {
+		return x.crypto, nil
+	}
+	if v, ok := x.tables.Load(table); ok {
+		return v.(*crypto), nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(x.key)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newCryptoWithAEAD(
+		deriveKey(b, []byte(tableKeySalt), []byte(table)),
+		x.crypto.aead)
 	if err != nil {
 		return nil, err
 	}
-	return &secret{timeStamp, key, x}, nil
+	v, _ := x.tables.LoadOrStore(table, c)
+	return v.(*crypto), nil
 }
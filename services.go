@@ -17,8 +17,15 @@
 package swift
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"html/template"
+	"math/rand"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Services references all the information needed for every method.
@@ -27,6 +34,34 @@ type Services struct {
 	store   Store           // Instance of storage service for node data
 	browser BrowserDetector // Service to provide browser warnings
 	access  Access          // Instance of the access control interface
+	metrics Metrics         // Instance of the metrics interface
+	logger  Logger          // Instance of the logger interface
+	limiter RateLimiter     // Limits the rate that operations are created
+	random  *rand.Rand      // Used to decide if the browser warning is shown
+	mutex   *sync.Mutex     // Guards the random source which is not safe
+	nonces  *nonceSet       // Nonces of operations that have completed
+	clock   Clock           // Source of the current time
+
+	// Records the nonces of results that have been used. Defaults to nonces.
+	nonceStore NonceStore
+
+	// Guards checking and recording a nonce in the nonce store.
+	nonceMutex *sync.Mutex
+
+	// Selects the home node for a remote address, or nil for the default.
+	homeNode HomeNodeStrategy
+
+	// Template used for the progress page, or nil for the built in template.
+	progressTemplate *template.Template
+
+	// Path that prefixes all the URLs generated, or empty for the root.
+	basePath string
+
+	// Validators for values keyed on table and then key name.
+	validators map[string]map[string]Validator
+
+	// Transformers for values keyed on table and then key name.
+	transformers map[string]map[string]Transformer
 }
 
 // NewServices a set of services to use with SWIFT. These provide defaults via
@@ -42,15 +77,166 @@ func NewServices(
 	s.store = store
 	s.access = access
 	s.browser = browser
+	s.metrics = noMetrics{}
+	s.logger = stdLogger{config.Debug}
+	s.clock = systemClock{}
+	if config.CreateRate > 0 {
+		b := newTokenBucket(config.CreateRate, config.CreateBurst)
+		b.now = s.now
+		s.limiter = b
+	}
+	if initError != nil {
+		s.logger.Error("Package initialisation failed: %s", initError)
+	}
+	s.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	s.mutex = &sync.Mutex{}
+	s.nonces = newNonceSet(config.maxNonces())
+	s.nonces.now = s.now
+	s.nonceStore = s.nonces
+	s.nonceMutex = &sync.Mutex{}
 	return &s
 }
 
+// SetRandomSource sets the source of random numbers used to decide if the
+// browser warning should be shown. Used to make the decision deterministic in
+// tests. If nil then a source seeded with the current time is used.
+func (s *Services) SetRandomSource(r rand.Source) {
+	if r == nil {
+		r = rand.NewSource(time.Now().UnixNano())
+	}
+	s.mutex.Lock()
+	s.random = rand.New(r)
+	s.mutex.Unlock()
+}
+
+// getRandomFloat32 returns a random number in the range [0.0,1.0) from the
+// random source.
+func (s *Services) getRandomFloat32() float32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.random.Float32()
+}
+
+// SetMetrics sets the implementation used to record metrics. If nil then
+// metrics are not recorded.
+func (s *Services) SetMetrics(m Metrics) {
+	if m == nil {
+		m = noMetrics{}
+	}
+	s.metrics = m
+}
+
+// SetNonceStore sets the store used to record the nonces of results that have
+// been used so that they can not be replayed. Use a store shared by all the
+// access nodes in a cluster to reject replays at any access node. If nil then
+// the nonces are held in memory.
+func (s *Services) SetNonceStore(n NonceStore) {
+	if n == nil {
+		n = s.nonces
+	}
+	s.nonceStore = n
+}
+
+// SetRateLimiter sets the implementation used to limit the rate that storage
+// operations are created. If nil then the rate is not limited.
+func (s *Services) SetRateLimiter(l RateLimiter) {
+	s.limiter = l
+}
+
+// SetClock sets the source of the current time used for all time dependent
+// logic including the nodes held by the store. If nil then the system clock is
+// used.
+func (s *Services) SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	s.clock = c
+	if k, ok := s.store.(clockStore); ok {
+		k.setClock(c)
+	}
+}
+
+// now returns the current UTC time from the clock.
+func (s *Services) now() time.Time {
+	return s.clock.Now()
+}
+
+// SetHomeNodeStrategy sets the strategy used to select the home node for a
+// remote address. If not set then the default FNV hash strategy is used.
+func (s *Services) SetHomeNodeStrategy(h HomeNodeStrategy) {
+	s.homeNode = h
+}
+
+// SetBasePath sets the path that all the handlers are mounted under when
+// behind a reverse proxy, for example "/swift". The path is prepended to the
+// URLs generated for other nodes and to the path of the cookies. Cookies
+// written before the base path was set are not sent by browsers to the new
+// path. If empty then the handlers are at the root.
+func (s *Services) SetBasePath(p string) {
+	p = strings.Trim(p, "/")
+	if p != "" {
+		p = "/" + p
+	}
+	s.basePath = p
+}
+
+// getNodeURL returns the URL for the path at the node's domain including the
+// base path.
+func (s *Services) getNodeURL(domain string, path string) string {
+	return s.config.Scheme + "://" + domain + s.basePath + path
+}
+
+// trimBasePath returns the path without the base path if it starts with it.
+func (s *Services) trimBasePath(path string) string {
+	if s.basePath != "" && strings.HasPrefix(path, s.basePath+"/") {
+		return path[len(s.basePath):]
+	}
+	return path
+}
+
+// getSecretTable returns the table used to derive the keys for the table's
+// data, or an empty string if table secrets are not enabled and the node
+// secrets are used directly.
+func (s *Services) getSecretTable(table string) string {
+	if s.config.TableSecrets {
+		return table
+	}
+	return ""
+}
+
+// SetLogger sets the implementation used to log messages. If nil then the
+// standard log package is used.
+func (s *Services) SetLogger(l Logger) {
+	if l == nil {
+		l = stdLogger{s.config.Debug}
+	}
+	s.logger = l
+}
+
+// SetProgressTemplate sets the template used to display the progress page
+// during a storage operation replacing the built in template. The template is
+// executed with the operation which provides the HTML fields Title, Message,
+// BackgroundColor, MessageColor and ProgressColor, along with NextURL which the
+// page must navigate to for the operation to continue, and PercentageComplete.
+// If nil then the built in template is used.
+func (s *Services) SetProgressTemplate(t *template.Template) {
+	s.progressTemplate = t
+}
+
+// getProgressTemplate returns the template to use for the progress page.
+func (s *Services) getProgressTemplate() *template.Template {
+	if s.progressTemplate != nil {
+		return s.progressTemplate
+	}
+	return progressTemplate
+}
+
 // Config returns the configuration service.
 func (s *Services) Config() *Configuration { return &s.config }
 
 // GetAccessNode returns an access node for the network.
 func (s *Services) GetAccessNode(network string) (string, error) {
-	return s.store.GetAccessNode(network)
+	return s.store.GetAccessNode(context.Background(), network)
 }
 
 // Returns true if the request is allowed to access the handler, otherwise false.
@@ -64,14 +250,171 @@ func (s *Services) getAccessAllowed(
 		returnAPIError(s, w, err, http.StatusInternalServerError)
 		return false
 	}
-	v, err := s.access.GetAllowed(r.FormValue("accessKey"))
+	err = s.getAccessError(r)
+	if err != nil {
+		returnAPIError(s, w, err, http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// getAccessError returns ErrNotAuthorized if the access key in the request can
+// not be used with the handlers, otherwise nil. Failures of the access service
+// are logged and treated as not authorized.
+func (s *Services) getAccessError(r *http.Request) error {
+	v, err := s.getAccessKeyAllowed(getAccessKey(r))
+	if err != nil {
+		s.logger.Warn("Access check failed: %s", err)
+	}
 	if v == false || err != nil {
+		return ErrNotAuthorized
+	}
+	return nil
+}
+
+// Returns true if the request is within the rate limit, otherwise false. If
+// false is returned then the method will have responded to the request
+// already.
+func (s *Services) getRateAllowed(w http.ResponseWriter, r *http.Request) bool {
+	if s.limiter != nil && s.limiter.Allow(getRateLimitKey(r)) == false {
+		returnAPIError(
+			s,
+			w,
+			fmt.Errorf("Rate limit exceeded"),
+			http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// The prefix of an Authorization header that contains the access key.
+const bearerPrefix = "Bearer "
+
+// getAccessKey returns the access key from the Authorization header if it uses
+// the Bearer scheme, otherwise from the accessKey form parameter. The header
+// is preferred as it is not recorded in logs or URLs.
+func getAccessKey(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > len(bearerPrefix) &&
+		strings.EqualFold(h[:len(bearerPrefix)], bearerPrefix) {
+		return strings.TrimSpace(h[len(bearerPrefix):])
+	}
+	return r.FormValue(accessKey)
+}
+
+// Returns true if the access key in the request can be used with the table,
+// otherwise false. If false is returned then the method will have responded to
+// the request already.
+func (s *Services) getTableAllowed(
+	w http.ResponseWriter,
+	r *http.Request,
+	table string) bool {
+	if s.config.getTableAllowed(getAccessKey(r), table) == false {
 		returnAPIError(
 			s,
 			w,
-			fmt.Errorf("Access denied"),
-			http.StatusNetworkAuthenticationRequired)
+			fmt.Errorf("Access denied to table '%s'", table),
+			http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Returns true if the results have not already been used, otherwise false. If
+// false is returned then the method will have responded to the request
+// already.
+func (s *Services) getNonceAllowed(w http.ResponseWriter, a *Results) bool {
+	err := s.useNonce(a)
+	if err != nil {
+		returnAPIError(s, w, err, http.StatusConflict)
 		return false
 	}
 	return true
 }
+
+// useNonce records the nonce of the operation that produced the results
+// returning an error if the results have already been used. The nonce is
+// remembered until the results expire or the operation timeout has passed,
+// whichever is later. Results without a nonce are always allowed.
+func (s *Services) useNonce(a *Results) error {
+	if a.nonce == "" {
+		return nil
+	}
+	e := s.now().Add(s.config.operationTimeout())
+	if a.Expires.After(e) {
+		e = a.Expires
+	}
+	s.nonceMutex.Lock()
+	defer s.nonceMutex.Unlock()
+	if s.nonceStore.Seen(a.nonce) {
+		return errors.New("Results have already been used")
+	}
+	s.nonceStore.Record(a.nonce, e)
+	return nil
+}
+
+// getAccessKeyAllowed returns true if the access key is one of the keys in the
+// configuration or is allowed by the access service.
+func (s *Services) getAccessKeyAllowed(k string) (bool, error) {
+	if k != "" {
+		for _, c := range s.config.AccessKeys {
+			if c == k {
+				return true, nil
+			}
+		}
+	}
+	if s.access == nil {
+		return false, nil
+	}
+	return s.access.GetAllowed(k)
+}
+
+// RetireNode marks the storage node with the domain provided for retirement.
+// The node is no longer selected as a home node. It remains active for the
+// NodeRetirement period and is visited by storage operations after their home
+// node so that the values stored in its cookies are carried to the node that
+// is now the home node. After the period the node expires and is inactive.
+func (s *Services) RetireNode(domain string) error {
+	n, err := s.store.getNode(context.Background(), domain)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return fmt.Errorf("Domain '%s': %w", domain, ErrNotSwiftNode)
+	}
+	if n.role != roleStorage {
+		return fmt.Errorf("Domain '%s' is not a storage node", domain)
+	}
+
+	// Change a copy as other requests might be using the stored node.
+	n = n.copy()
+	n.retiring = true
+	e := s.now().Add(s.config.nodeRetirement())
+	if n.expires.After(e) {
+		n.expires = e
+	}
+	return s.store.setNode(context.Background(), n)
+}
+
+// RotateNodeSecrets adds a new secret to the node with the domain provided.
+// The new secret is used for all subsequent encryption. Secrets that were
+// superseded more than SecretRetirement seconds ago are removed. The node is
+// then updated in the store.
+func (s *Services) RotateNodeSecrets(domain string) error {
+	n, err := s.store.getNode(context.Background(), domain)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return fmt.Errorf("Domain '%s': %w", domain, ErrNotSwiftNode)
+	}
+	x, err := newSecretWithAEAD(s.config.aead(), s.now())
+	if err != nil {
+		return err
+	}
+
+	// Rotate a copy as other requests might be using the stored node.
+	n = n.copy()
+	n.rotateSecret(x, time.Second*s.config.SecretRetirement)
+	return s.store.setNode(context.Background(), n)
+}
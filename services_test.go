@@ -0,0 +1,270 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newServicesTest returns services for the store provided configured with the
+// test configuration and the test access key.
+func newServicesTest(v *Volatile) (*Services, error) {
+	b, err := NewBrowserRegexes()
+	if err != nil {
+		return nil, err
+	}
+	return NewServices(
+		newConfigurationTest(),
+		v,
+		NewAccessSimple([]string{testAccessKey}),
+		b), nil
+}
+
+func TestAccessKeysRotation(t *testing.T) {
+	s := NewServices(
+		newConfigurationTest(),
+		newVolatile(),
+		NewAccessSimple([]string{}),
+		nil)
+	s.config.AccessKeys = []string{"old", "new"}
+	for k, e := range map[string]bool{
+		"old":     true,
+		"new":     true,
+		"invalid": false,
+		"":        false} {
+		q := url.Values{}
+		q.Set(accessKey, k)
+		r := httptest.NewRequest("GET", "https://"+testAccess+"/?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		if s.getAccessAllowed(w, r) != e {
+			fmt.Printf("Access key '%s' should return '%t'\n", k, e)
+			t.Fail()
+		}
+	}
+}
+
+func TestAccessKeyHeaderOnly(t *testing.T) {
+	testAccessKeySource(t, "", "Bearer new", true)
+	testAccessKeySource(t, "", "bearer new", true)
+	testAccessKeySource(t, "", "Bearer invalid", false)
+	testAccessKeySource(t, "", "Basic new", false)
+}
+
+func TestAccessKeyParamOnly(t *testing.T) {
+	testAccessKeySource(t, "new", "", true)
+	testAccessKeySource(t, "invalid", "", false)
+}
+
+func TestAccessKeyHeaderPreferred(t *testing.T) {
+	testAccessKeySource(t, "invalid", "Bearer new", true)
+	testAccessKeySource(t, "new", "Bearer invalid", false)
+}
+
+// testAccessKeySource checks that a request with the access key form
+// parameter p and Authorization header h is allowed or denied as expected.
+func testAccessKeySource(t *testing.T, p string, h string, e bool) {
+	s := NewServices(
+		newConfigurationTest(),
+		newVolatile(),
+		NewAccessSimple([]string{}),
+		nil)
+	s.config.AccessKeys = []string{"new"}
+	q := url.Values{}
+	if p != "" {
+		q.Set(accessKey, p)
+	}
+	r := httptest.NewRequest("GET", "https://"+testAccess+"/?"+q.Encode(), nil)
+	if h != "" {
+		r.Header.Set("Authorization", h)
+	}
+	w := httptest.NewRecorder()
+	if s.getAccessAllowed(w, r) != e {
+		fmt.Printf("Param '%s' and header '%s' should return '%t'\n", p, h, e)
+		t.Fail()
+	}
+}
+
+func TestRetireNode(t *testing.T) {
+	v, err := newVolatileNetworkTest(3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s, err := newServicesTest(v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	ns, err := v.getNodes(context.Background(), testNetwork)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// Find a client address with a storage node as the home node.
+	var ra string
+	var x *node
+	for i := 1; x == nil || x.role != roleStorage; i++ {
+		ra = fmt.Sprintf("10.0.0.%d:1234", i)
+		x, err = ns.getHomeNode("", ra)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+	}
+
+	// Store a value in a cookie at the current home node, then retire it.
+	o := newOperation(s, x)
+	o.table = "table"
+	o.values = []*pair{testPair("a", "1", conflictOldest, -time.Hour)}
+	c := testCookies(t, o)
+	err = s.RetireNode(x.domain)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r, err := v.getNode(context.Background(), x.domain)
+	if err != nil || r.retiring == false || r.isActive() == false {
+		fmt.Println("Retiring node should remain active")
+		t.Fail()
+		return
+	}
+
+	// A new operation for the same client starts at a different home node.
+	q := newCreateValuesTest()
+	q.Set("a<"+time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02"), "2")
+	q.Set(bounces, "3")
+	q.Set(remoteAddr, ra)
+	h := newCreateRequestTest(q)
+	h.ParseForm()
+	_, u, err := createURL(s, h)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	u, err = testRetireNext(s, u, nil)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+
+	// The retiring node is visited next and gives its value to the operation
+	// which then returns to the new home node.
+	p, err := url.Parse(u)
+	if err != nil || p.Host != x.domain {
+		fmt.Printf("Expected '%s' to be visited but got '%s'\n", x.domain, u)
+		t.Fail()
+		return
+	}
+	u, err = testRetireNext(s, u, c)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	f, err := testOperationFromURL(s, u)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if f.thisNode == x || f.thisNode.domain != f.homeNode {
+		fmt.Printf("Expected new home node but got '%s'\n", f.thisNode.domain)
+		t.Fail()
+	}
+	if len(f.values) != 1 || f.values[0].value != "1" {
+		fmt.Println("Value from the retiring node should reach the home node")
+		t.Fail()
+	}
+}
+
+// TestServicesNodeChangesConcurrent rotates secrets and retires a node while
+// storage operations are created so that the race detector can find changes
+// made to nodes that other requests are using.
+func TestServicesNodeChangesConcurrent(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.SecretRetirement = 60
+	var w sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+			for j := 0; j < 100; j++ {
+				q := newCreateValuesTest()
+				q.Set(testKey("a"), "1")
+				if r := testCreate(s, q); r.Code != http.StatusOK {
+					fmt.Println(r.Body.String())
+					t.Fail()
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		for _, d := range []string{testAccess, "storage-1.com"} {
+			err = s.RotateNodeSecrets(d)
+			if err != nil {
+				fmt.Println(err)
+				t.Fail()
+			}
+		}
+	}
+	err = s.RetireNode("storage-2.com")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+	w.Wait()
+}
+
+var testNextURL = regexp.MustCompile(`href="(https://[^"]+)"`)
+
+// testRetireNext processes the storage operation URL with the cookies and
+// returns the next URL the operation navigates to.
+func testRetireNext(s *Services, u string, c []*http.Cookie) (string, error) {
+	r := httptest.NewRequest("GET", u, nil)
+	for _, v := range c {
+		r.AddCookie(v)
+	}
+	w := httptest.NewRecorder()
+	HandlerStore(s, nil)(w, r)
+	m := testNextURL.FindStringSubmatch(w.Body.String())
+	if w.Code != http.StatusOK || m == nil {
+		return "", fmt.Errorf("Status '%d' without next URL", w.Code)
+	}
+	return m[1], nil
+}
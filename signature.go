@@ -0,0 +1,203 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Prefix used to derive the signing key from a node secret so that the secret
+// key is not used directly for more than one purpose.
+const signatureKeyPrefix = "swift-operation-signature"
+
+// Prefix used to derive the key that signs state envelopes. Different from the
+// operation prefix so that an operation signature can not be used as a state
+// signature.
+const stateKeyPrefix = "swift-state-signature"
+
+// Separates the payload from the signature in a state envelope.
+const stateSeparator = "."
+
+// sign sets the signature of the fields of the operation that determine where
+// and how the results are delivered using the newest secret of the access node.
+// The webhook URL is included so that results can not be posted elsewhere.
+func (o *operation) sign(a *node) error {
+	x, err := a.getSecret()
+	if err != nil {
+		return err
+	}
+	o.signature = base64.RawURLEncoding.EncodeToString(o.getSignature(x))
+	return nil
+}
+
+// verifySignature returns an error if the signature does not match the return
+// URL, table and access node of the operation for any of the access node's
+// secrets.
+func (o *operation) verifySignature(ctx context.Context) error {
+	a, err := o.services.store.getNode(ctx, o.accessNode)
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		return fmt.Errorf("Access node '%s' not found", o.accessNode)
+	}
+	v, err := base64.RawURLEncoding.DecodeString(o.signature)
+	if err != nil {
+		return err
+	}
+	for _, x := range a.secrets {
+		if x != nil && hmac.Equal(v, o.getSignature(x)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Operation signature invalid")
+}
+
+// getSignature returns the HMAC of the return URL, table, access node and
+// webhook URL using a key derived from the secret.
+func (o *operation) getSignature(x *secret) []byte {
+	k := sha256.Sum256([]byte(signatureKeyPrefix + x.key))
+	var b bytes.Buffer
+	writeString(&b, o.returnURL)
+	writeString(&b, o.table)
+	writeString(&b, o.accessNode)
+	writeString(&b, o.webhookURL)
+	h := hmac.New(sha256.New, k[:])
+	h.Write(b.Bytes())
+	return h.Sum(nil)
+}
+
+// SignState returns the state wrapped in an envelope signed with the newest
+// secret of the access node. The envelope can be passed to SetState and checked
+// with VerifyState when the results are returned. If expires is not zero then
+// the envelope is rejected after that time.
+func (s *Services) SignState(
+	ctx context.Context,
+	accessNode string,
+	state string,
+	expires time.Time) (string, error) {
+	err := validateState(state)
+	if err != nil {
+		return "", err
+	}
+	a, err := s.getStateNode(ctx, accessNode)
+	if err != nil {
+		return "", err
+	}
+	x, err := a.getSecret()
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = writeString(&b, state)
+	if err != nil {
+		return "", err
+	}
+	err = writeTime(&b, expires)
+	if err != nil {
+		return "", err
+	}
+	e := base64.RawURLEncoding.EncodeToString(b.Bytes()) + stateSeparator +
+		base64.RawURLEncoding.EncodeToString(getStateSignature(x, b.Bytes()))
+	err = validateState(e)
+	if err != nil {
+		return "", err
+	}
+	return e, nil
+}
+
+// VerifyState returns the state from the envelope created by SignState if the
+// signature matches one of the access node's secrets and the envelope has not
+// expired. The error wraps ErrStateInvalid or ErrStateExpired if the envelope
+// can not be trusted.
+func (s *Services) VerifyState(
+	ctx context.Context,
+	accessNode string,
+	envelope string) (string, error) {
+	a, err := s.getStateNode(ctx, accessNode)
+	if err != nil {
+		return "", err
+	}
+	i := strings.Index(envelope, stateSeparator)
+	if i < 0 {
+		return "", fmt.Errorf("%w: missing signature", ErrStateInvalid)
+	}
+	d, err := base64.RawURLEncoding.DecodeString(envelope[:i])
+	if err != nil {
+		return "", fmt.Errorf("%w: payload '%s'", ErrStateInvalid, err)
+	}
+	v, err := base64.RawURLEncoding.DecodeString(envelope[i+1:])
+	if err != nil {
+		return "", fmt.Errorf("%w: signature '%s'", ErrStateInvalid, err)
+	}
+	f := false
+	for _, x := range a.secrets {
+		if x != nil && hmac.Equal(v, getStateSignature(x, d)) {
+			f = true
+			break
+		}
+	}
+	if f == false {
+		return "", fmt.Errorf("%w: signature mismatch", ErrStateInvalid)
+	}
+	b := bytes.NewBuffer(d)
+	state, err := readString(b)
+	if err != nil {
+		return "", fmt.Errorf("%w: state '%s'", ErrStateInvalid, err)
+	}
+	expires, err := readTime(b)
+	if err != nil {
+		return "", fmt.Errorf("%w: expires '%s'", ErrStateInvalid, err)
+	}
+	if expires.IsZero() == false && expires.After(a.now()) == false {
+		return "", fmt.Errorf("%w: at '%s'", ErrStateExpired, expires)
+	}
+	return state, nil
+}
+
+// getStateNode returns the access node used to sign and verify state.
+func (s *Services) getStateNode(
+	ctx context.Context,
+	accessNode string) (*node, error) {
+	a, err := s.store.getNode(ctx, accessNode)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, fmt.Errorf("Node '%s': %w", accessNode, ErrNotSwiftNode)
+	}
+	if a.role != roleAccess {
+		return nil, fmt.Errorf("Node '%s': %w", accessNode, ErrNotAccessNode)
+	}
+	return a, nil
+}
+
+// getStateSignature returns the HMAC of the state envelope payload using a key
+// derived from the secret.
+func getStateSignature(x *secret, d []byte) []byte {
+	k := sha256.Sum256([]byte(stateKeyPrefix + x.key))
+	h := hmac.New(sha256.New, k[:])
+	h.Write(d)
+	return h.Sum(nil)
+}
@@ -0,0 +1,144 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testState = "correlation-id=1234"
+
+func TestSignStateValid(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, x := range []time.Time{{}, time.Now().Add(time.Hour)} {
+		e, err := s.SignState(context.Background(), "access.com", testState, x)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if validateState(e) != nil {
+			fmt.Printf("Envelope '%s' not valid state\n", e)
+			t.Fail()
+		}
+		v, err := s.VerifyState(context.Background(), "access.com", e)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if v != testState {
+			fmt.Printf("Expected '%s' but got '%s'\n", testState, v)
+			t.Fail()
+		}
+	}
+}
+
+func TestSignStateExpired(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err := s.SignState(
+		context.Background(),
+		"access.com",
+		testState,
+		time.Now().Add(-time.Minute))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, err = s.VerifyState(context.Background(), "access.com", e)
+	testSignStateRejected(t, err, ErrStateExpired)
+}
+
+func TestSignStateForged(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err := s.SignState(
+		context.Background(),
+		"access.com",
+		testState,
+		time.Time{})
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	p := e[:strings.Index(e, stateSeparator)]
+
+	// A signature made with a key that is not one of the node's secrets.
+	d, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	h := hmac.New(sha256.New, []byte("forged"))
+	h.Write(d)
+	f := p + stateSeparator + base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+	_, err = s.VerifyState(context.Background(), "access.com", f)
+	testSignStateRejected(t, err, ErrStateInvalid)
+
+	// A genuine signature with a different payload.
+	_, err = s.VerifyState(
+		context.Background(),
+		"access.com",
+		base64.RawURLEncoding.EncodeToString([]byte("forged"))+
+			e[len(p):])
+	testSignStateRejected(t, err, ErrStateInvalid)
+
+	// A genuine envelope verified by a node that did not sign it.
+	_, err = s.VerifyState(context.Background(), "storage-1.com", e)
+	testSignStateRejected(t, err, ErrNotAccessNode)
+
+	// State without an envelope.
+	_, err = s.VerifyState(context.Background(), "access.com", testState)
+	testSignStateRejected(t, err, ErrStateInvalid)
+}
+
+func testSignStateRejected(t *testing.T, err error, target error) {
+	if err == nil {
+		fmt.Println("Expected state to be rejected")
+		t.Fail()
+		return
+	}
+	if errors.Is(err, target) == false {
+		fmt.Printf("Expected '%v' but got '%v'\n", target, err)
+		t.Fail()
+	}
+}
@@ -17,7 +17,10 @@
 package swift
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -31,13 +34,13 @@ func TestStorageCommon(t *testing.T) {
 		t.Fail()
 		return
 	}
-	an, err = s.getNode("test-1.com")
+	an, err = s.getNode(context.Background(), "test-1.com")
 	if err != nil {
 		fmt.Println(err)
 		t.Fail()
 		return
 	}
-	bn, err = s.getNode("test-1.com")
+	bn, err = s.getNode(context.Background(), "test-1.com")
 	if err != nil {
 		fmt.Println(err)
 		t.Fail()
@@ -72,3 +75,99 @@ func TestStorageCommon(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestStorageAddTableOnce(t *testing.T) {
+	var c common
+	c.mutex = &sync.Mutex{}
+	n := 0
+	f := func() error {
+		n++
+		return nil
+	}
+
+	// A failure to record the table is returned and the table is tried again.
+	err := c.addTableOnce("a", func() error { return errors.New("failed") })
+	if err == nil {
+		fmt.Println("Failure to record the table should be returned")
+		t.Fail()
+	}
+	for i := 0; i < 3; i++ {
+		err = c.addTableOnce("a", f)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+	}
+	err = c.addTableOnce("b", f)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if n != 2 {
+		fmt.Printf("Expected '2' tables recorded but got '%d'\n", n)
+		t.Fail()
+	}
+}
+
+func TestStorageMultipleNetworks(t *testing.T) {
+	v, err := newVolatileNetworkTest(2)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n, err := v.testAddNode("a"+networkSeparator+"b", "shared.com", roleAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, k := range []string{"a", "b"} {
+		ns, err := v.getNodes(context.Background(), k)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if ns == nil || ns.dict[n.domain] != n || len(ns.all) != 1 {
+			fmt.Printf("Network '%s' should contain '%s'\n", k, n.domain)
+			t.Fail()
+		}
+	}
+
+	// Moving the node to a different set of networks removes it from the
+	// networks it no longer belongs to.
+	n, err = v.testAddNode(
+		"b"+networkSeparator+testNetwork,
+		"shared.com",
+		roleAccess)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := v.getNodes(context.Background(), "a")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if a.dict[n.domain] != nil || len(a.all) != 0 {
+		fmt.Printf("Network 'a' should not contain '%s'\n", n.domain)
+		t.Fail()
+	}
+	for _, k := range []string{"b", testNetwork} {
+		ns, err := v.getNodes(context.Background(), k)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			return
+		}
+		if ns.dict[n.domain] != n {
+			fmt.Printf("Network '%s' should contain '%s'\n", k, n.domain)
+			t.Fail()
+		}
+	}
+}
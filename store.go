@@ -17,36 +17,79 @@
 package swift
 
 import (
+	"context"
 	"errors"
 	"log"
 	"os"
+	"time"
 )
 
 const (
 	nodesTableName        = "swiftnodes"   // Table name for nodes
 	secretsTableName      = "swiftsecrets" // Table name for secrets
+	tablesTableName       = "swifttables"  // Table name for table states
 	domainFieldName       = "Domain"       // The domain of the node
 	networkFieldName      = "Network"      // The network of the node
 	roleFieldName         = "role"         // The role of the node
 	expiresFieldName      = "expires"      // When the node expires
 	scramblerKeyFieldName = "ScramblerKey" // Used to scramble table and key names
+	weightFieldName       = "weight"       // Relative capacity of the node
+	retiringFieldName     = "retiring"     // True if the node is retiring
+	aeadFieldName         = "aead"         // The AEAD used by the secret
+	tableFieldName        = "Table"        // The name of the table
+	disabledFieldName     = "disabled"     // When the table was disabled
 )
 
-// Store interface for persistent data shared across instances operated.
+// Store interface for persistent data shared across instances operated. Each
+// method takes the context of the request so that implementations backed by a
+// database can honor cancellation and deadlines.
 type Store interface {
 
 	// GetAccessNode returns the access node for the network.
-	GetAccessNode(network string) (string, error)
+	GetAccessNode(ctx context.Context, network string) (string, error)
 
 	// GetNode takes a domain name and returns the associated node. If a node
 	// does not exist then nil is returned.
-	getNode(domain string) (*node, error)
+	getNode(ctx context.Context, domain string) (*node, error)
 
 	// GetNodes returns all the nodes associated with a network.
-	getNodes(network string) (*nodes, error)
+	getNodes(ctx context.Context, network string) (*nodes, error)
+
+	// GetAllNodes returns all the nodes in every network.
+	getAllNodes(ctx context.Context) ([]*node, error)
 
 	// SetNode inserts or updates the node.
-	setNode(node *node) error
+	setNode(ctx context.Context, node *node) error
+}
+
+// clockStore is implemented by stores that set the clock the nodes they load
+// use for the current time. Stores that do not implement it leave the nodes
+// using the system clock.
+type clockStore interface {
+
+	// setClock sets the clock for the nodes already loaded and those loaded
+	// in the future.
+	setClock(c Clock)
+}
+
+// tableStore is implemented by stores that record the tables in use and which
+// of them are disabled. Stores that do not implement it treat every table as
+// active.
+type tableStore interface {
+
+	// addTable records that the table is in use.
+	addTable(ctx context.Context, table string) error
+
+	// getTables returns the names of the tables in use in alphabetical order.
+	getTables(ctx context.Context) ([]string, error)
+
+	// getTableDisabled returns the time the table was disabled, or the zero
+	// time if the table is active.
+	getTableDisabled(ctx context.Context, table string) (time.Time, error)
+
+	// setTableDisabled records the time the table was disabled, or that it is
+	// active if the time is zero.
+	setTableDisabled(ctx context.Context, table string, disabled time.Time) error
 }
 
 // NewStore returns a work implementation of the Store interface for the
@@ -0,0 +1,103 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DisableTable marks the table provided as disabled. Storage operations can no
+// longer write to the table and decoded results contain no values from it. The
+// table can be enabled again within the TableGracePeriod to restore reads. An
+// error is returned if the store does not support table states.
+func (s *Services) DisableTable(table string) error {
+	t, ok := s.store.(tableStore)
+	if !ok {
+		return fmt.Errorf("Store does not support disabling tables")
+	}
+	d, err := t.getTableDisabled(context.Background(), table)
+	if err != nil {
+		return err
+	}
+	if !d.IsZero() {
+		return nil
+	}
+	return t.setTableDisabled(context.Background(), table, s.now())
+}
+
+// EnableTable marks the table provided as active again. An error is returned
+// if the table was disabled more than TableGracePeriod days ago or if the
+// store does not support table states.
+func (s *Services) EnableTable(table string) error {
+	t, ok := s.store.(tableStore)
+	if !ok {
+		return fmt.Errorf("Store does not support disabling tables")
+	}
+	d, err := t.getTableDisabled(context.Background(), table)
+	if err != nil {
+		return err
+	}
+	if d.IsZero() {
+		return nil
+	}
+	if s.now().After(d.Add(s.config.tableGracePeriod())) {
+		return fmt.Errorf(
+			"Table '%s' disabled after grace period: %w",
+			table,
+			ErrTableDisabled)
+	}
+	return t.setTableDisabled(context.Background(), table, time.Time{})
+}
+
+// Tables returns the distinct names of the tables that storage operations have
+// written to, or that have been disabled, in alphabetical order. An error is
+// returned if the store does not record the tables in use.
+func (s *Services) Tables() ([]string, error) {
+	t, ok := s.store.(tableStore)
+	if !ok {
+		return nil, fmt.Errorf("Store does not support listing tables")
+	}
+	return t.getTables(context.Background())
+}
+
+// addTable records that the table provided is in use if the store supports
+// it.
+func (s *Services) addTable(ctx context.Context, table string) error {
+	t, ok := s.store.(tableStore)
+	if !ok {
+		return nil
+	}
+	return t.addTable(ctx, table)
+}
+
+// getTableDisabled returns true if the table provided has been disabled. Stores
+// that do not support table states always return false.
+func (s *Services) getTableDisabled(
+	ctx context.Context,
+	table string) (bool, error) {
+	t, ok := s.store.(tableStore)
+	if !ok {
+		return false, nil
+	}
+	d, err := t.getTableDisabled(ctx, table)
+	if err != nil {
+		return false, err
+	}
+	return !d.IsZero(), nil
+}
@@ -0,0 +1,137 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTableDisabledCreate(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	err = s.DisableTable("table")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	w := testCreate(s, q)
+	if w.Code != http.StatusForbidden {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusForbidden, w.Code)
+		t.Fail()
+		return
+	}
+	q.Set(tableParam, "other")
+	w = testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestTableDisabledDecode(t *testing.T) {
+	s, n, err := newDecodeTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c := &clockTest{time.Now().UTC()}
+	s.SetClock(c)
+	r := newResultsTest(2)
+	r.Table = "table"
+	d, err := testEncryptResults(n, r)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	err = s.DisableTable("table")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if v := testTableDecode(t, s, d); v != 0 {
+		fmt.Printf("Expected no values but got '%d'\n", v)
+		t.Fail()
+		return
+	}
+
+	// Enable the table within the grace period to restore the values.
+	c.now = c.now.Add(time.Second)
+	err = s.EnableTable("table")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if v := testTableDecode(t, s, d); v != 2 {
+		fmt.Printf("Expected '2' values but got '%d'\n", v)
+		t.Fail()
+	}
+}
+
+func TestTableEnableAfterGrace(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c := &clockTest{time.Now().UTC()}
+	s.SetClock(c)
+	err = s.DisableTable("table")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c.now = c.now.AddDate(0, 0, defaultTableGrace+1)
+	if s.EnableTable("table") == nil {
+		fmt.Println("Table should not be enabled after the grace period")
+		t.Fail()
+	}
+}
+
+// testTableDecode decodes the data returning the number of values.
+func testTableDecode(t *testing.T, s *Services, d string) int {
+	w := testDecode(s, newDecodeRequestTest(d))
+	if w.Code != http.StatusOK {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return -1
+	}
+	var v []*Result
+	err := json.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return -1
+	}
+	return len(v)
+}
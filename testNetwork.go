@@ -0,0 +1,243 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// The name of the network and the access key used by NewTestNetwork.
+const (
+	TestNetworkName      = "swift-test"
+	TestNetworkAccessKey = "swift-test-access-key"
+)
+
+// The most pages Follow will request before returning an error. Prevents a
+// faulty network from looping forever.
+const testNetworkMaxPages = 1024
+
+// Matches the next URL in the meta refresh of the storage operation pages.
+var testNetworkNextURL = regexp.MustCompile("URL='([^']+)'")
+
+// TestNetwork is an in memory network of nodes each served by a httptest
+// server. Used to exercise complete storage operations in tests. Close must be
+// called when the network is no longer needed.
+type TestNetwork struct {
+	AccessNodes  []string     // Domains of the access nodes including port
+	StorageNodes []string     // Domains of the storage nodes including port
+	Client       *http.Client // Client with a cookie jar acting as a browser
+	services     *Services    // The services shared by all the nodes
+	servers      []*httptest.Server
+}
+
+// NewTestNetwork returns services for a network with the number of access and
+// storage nodes provided held in a volatile store. Every node is served by a
+// httptest server using HTTP and has an active secret. The access key is
+// TestNetworkAccessKey.
+func NewTestNetwork(
+	accessNodes int,
+	storageNodes int) (*Services, *TestNetwork, error) {
+	if accessNodes < 1 || storageNodes < 1 {
+		return nil, nil, fmt.Errorf(
+			"Test network needs at least one access and storage node")
+	}
+	var c Configuration
+	c.Scheme = "http"
+	c.BundleTimeout = 60
+	c.NodeCount = byte(storageNodes)
+	c.Title = "Test"
+	c.Message = "Test"
+	c.BackgroundColor = "white"
+	c.MessageColor = "black"
+	c.ProgressColor = "blue"
+	v := newVolatile()
+	s := NewServices(c, v, NewAccessSimple([]string{TestNetworkAccessKey}), nil)
+	j, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	n := &TestNetwork{Client: &http.Client{Jar: j}}
+	n.Client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	for i := 0; i < accessNodes+storageNodes; i++ {
+		m := http.NewServeMux()
+		AddHandlersToMux(m, s, nil)
+		h := httptest.NewServer(m)
+		n.servers = append(n.servers, h)
+		u, err := url.Parse(h.URL)
+		if err != nil {
+			n.Close()
+			return nil, nil, err
+		}
+		r := roleStorage
+		if i < accessNodes {
+			r = roleAccess
+			n.AccessNodes = append(n.AccessNodes, u.Host)
+		} else {
+			n.StorageNodes = append(n.StorageNodes, u.Host)
+		}
+		err = addTestNetworkNode(v, u.Host, r)
+		if err != nil {
+			n.Close()
+			return nil, nil, err
+		}
+	}
+	return s, n, nil
+}
+
+// addTestNetworkNode adds a node with an active secret to the store.
+func addTestNetworkNode(v *Volatile, domain string, role int) error {
+	t := time.Now().UTC()
+	x, err := newSecret(t)
+	if err != nil {
+		return err
+	}
+	n, err := newNode(
+		TestNetworkName,
+		domain,
+		t,
+		t.AddDate(1, 0, 0),
+		role,
+		x.key)
+	if err != nil {
+		return err
+	}
+	x, err = newSecret(t)
+	if err != nil {
+		return err
+	}
+	n.addSecret(x)
+	return v.setNode(context.Background(), n)
+}
+
+// Close shuts down the servers for all the nodes.
+func (n *TestNetwork) Close() {
+	for _, h := range n.servers {
+		h.Close()
+	}
+}
+
+// Create returns the URL to start a storage operation at the first access
+// node. The values must include the return URL, table and key value pairs.
+// The access key is added if not present.
+func (n *TestNetwork) Create(values url.Values) (string, error) {
+	if values.Get(accessKey) == "" {
+		values.Set(accessKey, TestNetworkAccessKey)
+	}
+	u := "http://" + n.AccessNodes[0] + "/swift/api/v1/create"
+	r, err := n.Client.PostForm(u, values)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return "", newResponseError(u, r)
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Follow requests the storage operation URL and each subsequent URL in the
+// same way as a web browser until the URL is not for a node in the network.
+// Returns that URL which is the return URL with the encrypted results.
+func (n *TestNetwork) Follow(u string) (string, error) {
+	for i := 0; i < testNetworkMaxPages; i++ {
+		p, err := url.Parse(u)
+		if err != nil {
+			return "", err
+		}
+		if n.isNode(p.Host) == false {
+			return u, nil
+		}
+		r, err := n.Client.Get(u)
+		if err != nil {
+			return "", err
+		}
+		if r.StatusCode != http.StatusOK {
+			err = newResponseError(u, r)
+			r.Body.Close()
+			return "", err
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		m := testNetworkNextURL.FindSubmatch(b)
+		if m == nil {
+			return "", fmt.Errorf("Page for '%s' has no next URL", u)
+		}
+		u = html.UnescapeString(string(m[1]))
+	}
+	return "", fmt.Errorf("Operation exceeded '%d' pages", testNetworkMaxPages)
+}
+
+// Decode returns the results from the data parameter of the URL returned by
+// Follow using the decode as JSON handler of the first access node.
+func (n *TestNetwork) Decode(u string) ([]*Result, error) {
+	p, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("data", p.Query().Get("data"))
+	q.Set(accessKey, TestNetworkAccessKey)
+	d := "http://" + n.AccessNodes[0] + "/swift/api/v1/decode-as-json"
+	r, err := n.Client.PostForm(d, q)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, newResponseError(d, r)
+	}
+	var a []*Result
+	err = json.NewDecoder(r.Body).Decode(&a)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// isNode returns true if the host is one of the nodes in the network.
+func (n *TestNetwork) isNode(host string) bool {
+	for _, h := range n.AccessNodes {
+		if h == host {
+			return true
+		}
+	}
+	for _, h := range n.StorageNodes {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTestNetworkRoundTrip(t *testing.T) {
+	_, n, err := NewTestNetwork(1, 3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	q := url.Values{}
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	k := "a<" + time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02")
+	q.Set(k, "1")
+	u, err := n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err := n.Follow(u)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := n.Decode(e)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != 1 || a[0].Key != "a" || a[0].Value != "1" {
+		fmt.Printf("Unexpected results '%v'\n", a)
+		t.Fail()
+		return
+	}
+
+	// A second operation finds the oldest value in the nodes' cookies.
+	q.Set(k, "2")
+	u, err = n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err = n.Follow(u)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err = n.Decode(e)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != 1 || a[0].Value != "1" {
+		fmt.Printf("Unexpected results '%v'\n", a)
+		t.Fail()
+	}
+}
+
+func TestTestNetworkBinaryValue(t *testing.T) {
+	_, n, err := NewTestNetwork(1, 3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	b := []byte{0, 1, 2, 0, 255, 254, '\r', '\n', 0}
+	q := url.Values{}
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	q.Set(binaryParam, "bitmap")
+	k := "bitmap>" + time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02")
+	q.Set(k, base64.RawURLEncoding.EncodeToString(b))
+	u, err := n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err := n.Follow(u)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := n.Decode(e)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(a) != 1 ||
+		a[0].IsBinary() == false ||
+		bytes.Equal(a[0].Bytes(), b) == false {
+		fmt.Printf("Unexpected results '%v'\n", a)
+		t.Fail()
+	}
+}
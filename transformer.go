@@ -0,0 +1,70 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Transformer changes a value submitted for a key when a storage operation is
+// created. The transformed value is stored and returned when the results are
+// decoded. An error is returned if the value can not be transformed.
+type Transformer func(value string) (string, error)
+
+// NewHashTransformer returns a transformer that replaces the value with the
+// hex encoded SHA-256 hash of the salt followed by the value so that the raw
+// value is never stored.
+func NewHashTransformer(salt string) Transformer {
+	return func(value string) (string, error) {
+		h := sha256.Sum256([]byte(salt + value))
+		return hex.EncodeToString(h[:]), nil
+	}
+}
+
+// AddTransformer registers the transformer for the key in the table. The key
+// is the name without the conflict flag or expiry date. Keys that do not have a
+// transformer are stored as they were submitted. Transformers must be added
+// before the handlers are used.
+func (s *Services) AddTransformer(table string, key string, t Transformer) {
+	if s.transformers == nil {
+		s.transformers = make(map[string]map[string]Transformer)
+	}
+	if s.transformers[table] == nil {
+		s.transformers[table] = make(map[string]Transformer)
+	}
+	s.transformers[table][key] = t
+}
+
+// transformPair replaces the value of the pair with the value from the
+// transformer for the key in the table. Deleted pairs have no value and are not
+// transformed. Transformed values are text even if the value submitted was
+// binary.
+func (s *Services) transformPair(table string, p *pair) error {
+	t := s.transformers[table][p.key]
+	if t == nil || p.isDeleted() {
+		return nil
+	}
+	v, err := t(p.value)
+	if err != nil {
+		return fmt.Errorf("Value for key '%s' not transformed: %s", p.key, err)
+	}
+	p.value = v
+	p.binary = false
+	return nil
+}
@@ -0,0 +1,99 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestTransformerHash(t *testing.T) {
+	s, n, err := NewTestNetwork(1, 3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer n.Close()
+	s.AddTransformer("table", "email", NewHashTransformer("salt"))
+	q := url.Values{}
+	q.Set(returnURLParam, "https://return.com/path?data=")
+	q.Set(tableParam, "table")
+	q.Set(testKey("email"), "user@example.com")
+	q.Set(testKey("other"), "raw")
+	u, err := n.Create(q)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	e, err := n.Follow(u)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r, err := n.Decode(e)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	h := sha256.Sum256([]byte("saltuser@example.com"))
+	for k, v := range map[string]string{
+		"email": hex.EncodeToString(h[:]),
+		"other": "raw"} {
+		f := false
+		for _, i := range r {
+			if i.Key == k {
+				f = true
+				if i.Value != v {
+					fmt.Printf("Key '%s' expected '%s' but got '%s'\n",
+						k,
+						v,
+						i.Value)
+					t.Fail()
+				}
+			}
+		}
+		if f == false {
+			fmt.Printf("Key '%s' missing\n", k)
+			t.Fail()
+		}
+	}
+}
+
+func TestTransformerError(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.AddTransformer("table", "email", func(string) (string, error) {
+		return "", fmt.Errorf("Failed")
+	})
+	q := newCreateValuesTest()
+	q.Set(testKey("email"), "user@example.com")
+	if _, _, err = createURL(s, newCreateRequestTest(q)); err == nil {
+		fmt.Println("Transformer error should fail the operation")
+		t.Fail()
+	}
+}
@@ -0,0 +1,95 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Matches the colors accepted in the configuration. Hex colors, color names
+// and the rgb or rgba functions are supported.
+var colorRegEx = regexp.MustCompile(
+	`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{4}|#[0-9a-fA-F]{6}|#[0-9a-fA-F]{8}|` +
+		`[a-zA-Z]+|rgba?\([0-9., %]+\))$`)
+
+// Validate checks the configuration and the nodes in the store are consistent
+// and returns an error describing every problem found, or nil if there are
+// none. Intended to be called at startup so that misconfiguration is reported
+// before requests fail.
+func (s *Services) Validate() error {
+	var l []error
+	err := s.config.Validate()
+	if err != nil {
+		l = append(l, err)
+	}
+	for _, c := range [][]string{
+		{"BackgroundColor", s.config.BackgroundColor},
+		{"MessageColor", s.config.MessageColor},
+		{"ProgressColor", s.config.ProgressColor}} {
+		if c[1] != "" && colorRegEx.MatchString(c[1]) == false {
+			l = append(l, fmt.Errorf(
+				"SWIFT %s '%s' is not a color", c[0], c[1]))
+		}
+	}
+	a, err := s.store.getAllNodes(context.Background())
+	if err != nil {
+		l = append(l, err)
+	}
+	var w []string
+	m := make(map[string]bool)
+	for _, n := range a {
+		l = append(l, validateNode(n)...)
+		for _, k := range n.networks {
+			if _, ok := m[k]; ok == false {
+				w = append(w, k)
+			}
+			m[k] = m[k] || n.role == roleAccess
+		}
+	}
+	for _, k := range w {
+		if m[k] == false {
+			l = append(l, fmt.Errorf("Network '%s' has no access node", k))
+		}
+	}
+	return errors.Join(l...)
+}
+
+// validateNode returns the problems with the node.
+func validateNode(n *node) []error {
+	var l []error
+	if isValidRole(n.role) == false {
+		l = append(l, fmt.Errorf(
+			"Node '%s': "+roleInvalidMessage, n.domain, n.role))
+	}
+	if n.expires.Before(n.created) {
+		l = append(l, fmt.Errorf(
+			"Node '%s' expires '%s' before it was created '%s'",
+			n.domain,
+			n.expires.Format("2006-01-02"),
+			n.created.Format("2006-01-02")))
+	}
+	if n.getActiveSecretCount() == 0 {
+		l = append(l, fmt.Errorf("Node '%s' has no active secrets", n.domain))
+	}
+	if n.scrambler == nil {
+		l = append(l, fmt.Errorf("Node '%s' has no scrambler key", n.domain))
+	}
+	return l
+}
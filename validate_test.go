@@ -0,0 +1,128 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateServices(t *testing.T) {
+	s, err := newValidateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	err = s.Validate()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+}
+
+func TestValidateServicesNoAccessNode(t *testing.T) {
+	s, err := newValidateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	_, err = s.store.(*Volatile).testAddNode(
+		"orphan",
+		"orphan.com",
+		roleStorage)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	testValidateReports(t, s, "Network 'orphan' has no access node")
+}
+
+func TestValidateServicesNodes(t *testing.T) {
+	s, err := newValidateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	v := s.store.(*Volatile)
+	n, err := v.testAddNode(testNetwork, "expired.com", roleStorage)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n.expires = n.created.AddDate(0, 0, -1)
+	n, err = v.testAddNode(testNetwork, "nosecrets.com", roleStorage)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	n.secrets = nil
+	testValidateReports(
+		t,
+		s,
+		"Node 'expired.com' expires",
+		"Node 'nosecrets.com' has no active secrets")
+}
+
+func TestValidateServicesConfig(t *testing.T) {
+	s, err := newValidateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.Title = ""
+	s.config.MessageColor = "not a color!"
+	s.config.ProgressColor = "#12345"
+	testValidateReports(
+		t,
+		s,
+		"SWIFT Title missing",
+		"SWIFT MessageColor 'not a color!' is not a color",
+		"SWIFT ProgressColor '#12345' is not a color")
+}
+
+// testValidateReports checks that validating the services reports every one
+// of the problems.
+func testValidateReports(t *testing.T, s *Services, problems ...string) {
+	err := s.Validate()
+	if err == nil {
+		fmt.Println("Services should be invalid")
+		t.Fail()
+		return
+	}
+	for _, p := range problems {
+		if strings.Contains(err.Error(), p) == false {
+			fmt.Printf("Error '%s' should report '%s'\n", err, p)
+			t.Fail()
+		}
+	}
+}
+
+func newValidateTest() (*Services, error) {
+	v, err := newVolatileNetworkTest(2)
+	if err != nil {
+		return nil, err
+	}
+	return newServicesTest(v)
+}
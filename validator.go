@@ -0,0 +1,70 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Validator checks a value submitted for a key when a storage operation is
+// created. An error is returned if the value is not valid.
+type Validator func(value string) error
+
+// NewRegexValidator returns a validator that only accepts values that match
+// the regular expression in full.
+func NewRegexValidator(expr string) (Validator, error) {
+	e, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return func(value string) error {
+		if e.MatchString(value) == false {
+			return fmt.Errorf("Value does not match '%s'", expr)
+		}
+		return nil
+	}, nil
+}
+
+// AddValidator registers the validator for the key in the table. The key is
+// the name without the conflict flag or expiry date. Keys that do not have a
+// validator accept any value. Validators must be added before the handlers
+// are used.
+func (s *Services) AddValidator(table string, key string, v Validator) {
+	if s.validators == nil {
+		s.validators = make(map[string]map[string]Validator)
+	}
+	if s.validators[table] == nil {
+		s.validators[table] = make(map[string]Validator)
+	}
+	s.validators[table][key] = v
+}
+
+// validatePair returns an error containing the key if the value of the pair
+// does not pass the validator for the key in the table. Deleted pairs have no
+// value and are not validated.
+func (s *Services) validatePair(table string, p *pair) error {
+	v := s.validators[table][p.key]
+	if v == nil || p.isDeleted() {
+		return nil
+	}
+	err := v(p.value)
+	if err != nil {
+		return fmt.Errorf("Value for key '%s' invalid: %s", p.key, err)
+	}
+	return nil
+}
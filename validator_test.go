@@ -0,0 +1,89 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testUUID = "[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}"
+
+func TestValidatorPass(t *testing.T) {
+	s, err := newValidatorTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("id"), "0f8fad5b-d9cb-469f-a165-70867728950e")
+	q.Set(testKey("other"), "any value")
+	w := testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected '%d' but got '%d': %s\n",
+			http.StatusOK,
+			w.Code,
+			w.Body.String())
+		t.Fail()
+	}
+}
+
+func TestValidatorFail(t *testing.T) {
+	s, err := newValidatorTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("id"), "0f8fad5b-d9cb-469f-a165-70867728950e-extra")
+	w := testCreate(s, q)
+	if w.Code != http.StatusBadRequest ||
+		strings.Contains(w.Body.String(), "'id'") == false {
+		fmt.Printf("Expected '%d' with key but got '%d': %s\n",
+			http.StatusBadRequest,
+			w.Code,
+			w.Body.String())
+		t.Fail()
+	}
+
+	// The validator only applies to the table it was added for.
+	q.Set(tableParam, "other")
+	w = testCreate(s, q)
+	if w.Code != http.StatusOK {
+		fmt.Printf("Expected '%d' but got '%d'\n", http.StatusOK, w.Code)
+		t.Fail()
+	}
+}
+
+// newValidatorTest returns services with a UUID validator for the id key in
+// the test table.
+func newValidatorTest() (*Services, error) {
+	s, err := newCreateTest()
+	if err != nil {
+		return nil, err
+	}
+	v, err := NewRegexValidator(testUUID)
+	if err != nil {
+		return nil, err
+	}
+	s.AddValidator("table", "id", v)
+	return s, nil
+}
@@ -16,34 +16,208 @@
 
 package swift
 
-// Volatile localstorage implementation for testing
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Volatile localstorage implementation for testing. Safe for concurrent use.
 type Volatile struct {
 	common
+	lock   *sync.RWMutex        // Guards the nodes, networks and tables maps
+	tables map[string]time.Time // Tables in use and the time disabled or zero
 }
 
 func newVolatile() *Volatile {
 	var v Volatile
 	v.init()
+	v.lock = &sync.RWMutex{}
+	v.tables = make(map[string]time.Time)
 	return &v
 }
 
-func (v Volatile) getNode(domain string) (*node, error) {
-	return v.common.getNode(domain)
+func (v Volatile) getNode(ctx context.Context, domain string) (*node, error) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.common.getNode(ctx, domain)
+}
+
+func (v Volatile) getNodes(
+	ctx context.Context,
+	network string) (*nodes, error) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.common.getNodes(ctx, network)
 }
 
-func (v Volatile) getNodes(network string) (*nodes, error) {
-	return v.common.getNodes(network)
+func (v Volatile) getAllNodes(ctx context.Context) ([]*node, error) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.common.getAllNodes(ctx)
 }
 
-func (v Volatile) setNode(n *node) error {
-	var net *nodes
+func (v Volatile) setNode(ctx context.Context, n *node) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	n.clock = v.clock
 	v.nodes[n.domain] = n
-	net = v.networks[n.network]
-	if net == nil {
-		net = newNodes()
-		v.networks[n.network] = net
+
+	// Replace the networks that contain, or will contain, the node with copies
+	// that include the new node in place of any existing node with the same
+	// domain. Networks already returned to callers are never altered.
+	for k, net := range v.networks {
+		if net.dict[n.domain] != nil || n.inNetwork(k) {
+			v.networks[k] = copyNetwork(k, net, n)
+		}
+	}
+
+	// Add any networks the node belongs to that do not already exist.
+	for _, k := range n.networks {
+		if v.networks[k] == nil {
+			v.networks[k] = copyNetwork(k, newNodes(), n)
+		}
+	}
+	return nil
+}
+
+func (v Volatile) getTableDisabled(
+	ctx context.Context,
+	table string) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.tables[table], nil
+}
+
+func (v Volatile) setTableDisabled(
+	ctx context.Context,
+	table string,
+	disabled time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.tables[table] = disabled
+	return nil
+}
+
+func (v Volatile) addTable(ctx context.Context, table string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	v.lock.RLock()
+	_, ok := v.tables[table]
+	v.lock.RUnlock()
+	if ok {
+		return nil
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if _, ok := v.tables[table]; ok == false {
+		v.tables[table] = time.Time{}
+	}
+	return nil
+}
+
+func (v Volatile) getTables(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	t := make([]string, 0, len(v.tables))
+	for k := range v.tables {
+		t = append(t, k)
+	}
+	sort.Strings(t)
+	return t, nil
+}
+
+// copyNetwork returns a copy of the network k containing the node n in place of
+// any node with the same domain. If n does not belong to the network then the
+// node with the same domain is removed.
+func copyNetwork(k string, net *nodes, n *node) *nodes {
+	c := newNodes()
+	f := false
+	for _, e := range net.all {
+		if e.domain == n.domain {
+			f = true
+			e = n
+		}
+		if e != n || n.inNetwork(k) {
+			c.all = append(c.all, e)
+			c.dict[e.domain] = e
+		}
+	}
+	if f == false && n.inNetwork(k) {
+		c.all = append(c.all, n)
+		c.dict[n.domain] = n
+	}
+	c.order()
+	return c
+}
+
+// Snapshot writes all the nodes in the store to the writer encrypted with the
+// key provided. The key must be 16, 24 or 32 bytes long. The snapshot contains
+// the key material for all the nodes so the key must be protected in the same
+// way as any other secret.
+func (v Volatile) Snapshot(w io.Writer, key []byte) error {
+	x, err := newCrypto(key)
+	if err != nil {
+		return err
+	}
+	ns, err := v.getAllNodes(context.Background())
+	if err != nil {
+		return err
+	}
+	d, err := marshalNodes(ns)
+	if err != nil {
+		return err
+	}
+	b, err := x.compressAndEncrypt(d, 0)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Restore reads the nodes from a snapshot created with Snapshot using the same
+// key and adds them to the store. If the key is wrong or the snapshot is
+// invalid then an error is returned and no nodes are added.
+func (v Volatile) Restore(r io.Reader, key []byte) error {
+	x, err := newCrypto(key)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	d, err := x.decryptAndDecompress(b)
+	if err != nil {
+		return fmt.Errorf("Snapshot could not be decrypted: %s", err)
+	}
+	ns, err := unmarshalNodes(d)
+	if err != nil {
+		return err
+	}
+	for _, n := range ns {
+		err = v.setNode(context.Background(), n)
+		if err != nil {
+			return err
+		}
 	}
-	net.dict[n.domain] = n
-	net.all = append(net.all, n)
 	return nil
 }
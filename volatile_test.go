@@ -17,10 +17,188 @@
 package swift
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"sync"
+	"testing"
 	"time"
 )
 
+func TestVolatileSnapshot(t *testing.T) {
+	v, err := newVolatileNetworkTest(3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	k, err := randomBytes(32)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	var b bytes.Buffer
+	err = v.Snapshot(&b, k)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if bytes.Contains(b.Bytes(), []byte(testAccess)) {
+		fmt.Println("Snapshot should not contain plain text")
+		t.Fail()
+		return
+	}
+	r := newVolatile()
+	err = r.Restore(&b, k)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	a, err := v.getAllNodes(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for _, n := range a {
+		e, err := r.getNode(context.Background(), n.domain)
+		if err != nil || e == nil {
+			fmt.Printf("Node '%s' should be restored\n", n.domain)
+			t.Fail()
+			continue
+		}
+		testNodeDefinitionEqual(t, n, e)
+	}
+	ns, err := r.getNodes(context.Background(), testNetwork)
+	if err != nil || ns == nil || len(ns.all) != len(a) {
+		fmt.Printf("Network '%s' should contain all nodes\n", testNetwork)
+		t.Fail()
+	}
+}
+
+func TestVolatileSnapshotWrongKey(t *testing.T) {
+	v, err := newVolatileNetworkTest(3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	k, err := randomBytes(32)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	w, err := randomBytes(32)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	var b bytes.Buffer
+	err = v.Snapshot(&b, k)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	r := newVolatile()
+	err = r.Restore(&b, w)
+	if err == nil {
+		fmt.Println("Restore with the wrong key should fail")
+		t.Fail()
+	}
+	a, err := r.getAllNodes(context.Background())
+	if err != nil || len(a) != 0 {
+		fmt.Println("No nodes should have been restored")
+		t.Fail()
+	}
+}
+
+func TestVolatileConcurrent(t *testing.T) {
+	v, err := newVolatileNetworkTest(3)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	var w sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		w.Add(1)
+		go func(i int) {
+			defer w.Done()
+			ctx := context.Background()
+			for j := 0; j < 50; j++ {
+				d := fmt.Sprintf("concurrent-%d-%d.com", i, j%5)
+				x, err := newSecret(time.Now().UTC())
+				if err != nil {
+					fmt.Println(err)
+					t.Fail()
+					return
+				}
+				n, err := newNode(
+					testNetwork,
+					d,
+					time.Now().UTC(),
+					time.Now().UTC().AddDate(1, 0, 0),
+					roleStorage,
+					x.key)
+				if err != nil {
+					fmt.Println(err)
+					t.Fail()
+					return
+				}
+				err = v.setNode(ctx, n)
+				if err != nil {
+					fmt.Println(err)
+					t.Fail()
+					return
+				}
+				e, err := v.getNode(ctx, d)
+				if err != nil || e == nil {
+					fmt.Printf("Node '%s' should be stored\n", d)
+					t.Fail()
+					return
+				}
+				ns, err := v.getNodes(ctx, testNetwork)
+				if err != nil || ns == nil {
+					fmt.Printf("Network '%s' should exist\n", testNetwork)
+					t.Fail()
+					return
+				}
+				for _, x := range ns.all {
+					if ns.dict[x.domain] != x {
+						fmt.Printf("Node '%s' inconsistent\n", x.domain)
+						t.Fail()
+					}
+				}
+				_, err = v.getAllNodes(ctx)
+				if err != nil {
+					fmt.Println(err)
+					t.Fail()
+					return
+				}
+			}
+		}(i)
+	}
+	w.Wait()
+
+	// Each domain replaced the previous node with the same domain.
+	ns, err := v.getNodes(context.Background(), testNetwork)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if len(ns.all) != 4+8*5 || len(ns.dict) != len(ns.all) {
+		fmt.Printf("Expected '%d' nodes but found '%d'\n", 4+8*5, len(ns.all))
+		t.Fail()
+	}
+}
+
 func newVolatileTest() (*Volatile, error) {
 	v := newVolatile()
 	for i := 1; i <= 10; i++ {
@@ -33,12 +211,12 @@ func newVolatileTest() (*Volatile, error) {
 }
 
 func (v *Volatile) testAddStorage(index int) (*node, error) {
-	s, err := newSecret()
+	s, err := newSecret(time.Now().UTC())
 	if err != nil {
 		return nil, err
 	}
 	n := node{
-		"network",
+		[]string{"network"},
 		fmt.Sprintf("test-%d.com", index),
 		0,
 		time.Now(),
@@ -47,12 +225,73 @@ func (v *Volatile) testAddStorage(index int) (*node, error) {
 		make([]*secret, 1),
 		s,
 		make([]byte, s.crypto.gcm.NonceSize()),
-		true}
-	x, err := newSecret()
+		make([]byte, s.crypto.gcm.NonceSize()),
+		1,
+		nil,
+		defaultNodeWeight,
+		false}
+	x, err := newSecret(time.Now().UTC())
 	if err != nil {
 		return nil, err
 	}
 	n.secrets = append(n.secrets, x)
-	v.setNode(&n)
+	v.setNode(context.Background(), &n)
 	return &n, nil
 }
+
+const (
+	testNetwork   = "test"       // Network used for the test nodes
+	testAccessKey = "key"        // Access key that is allowed by the tests
+	testAccess    = "access.com" // Domain of the access node in the tests
+)
+
+// newVolatileNetworkTest returns a volatile store containing a single access
+// node and the number of storage nodes requested, all of which are active and
+// have a secret.
+func newVolatileNetworkTest(storageNodes int) (*Volatile, error) {
+	v := newVolatile()
+	_, err := v.testAddNode(testNetwork, testAccess, roleAccess)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= storageNodes; i++ {
+		_, err = v.testAddNode(
+			testNetwork,
+			fmt.Sprintf("storage-%d.com", i),
+			roleStorage)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (v *Volatile) testAddNode(
+	network string,
+	domain string,
+	role int) (*node, error) {
+	s, err := newSecret(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	n, err := newNode(
+		network,
+		domain,
+		time.Now().UTC(),
+		time.Now().UTC().AddDate(1, 0, 0),
+		role,
+		s.key)
+	if err != nil {
+		return nil, err
+	}
+	x, err := newSecret(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	n.addSecret(x)
+	err = v.setNode(context.Background(), n)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
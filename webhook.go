@@ -0,0 +1,195 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	webhookURLParam     = "webhookUrl"
+	webhookSignatureKey = "swift-webhook-signature"
+)
+
+// Headers sent with the results posted to a webhook.
+const (
+	// WebhookSignatureHeader is the header containing the signature of the
+	// body to pass to VerifyWebhook.
+	WebhookSignatureHeader = "X-Swift-Signature"
+	// WebhookAccessNodeHeader is the header containing the domain of the
+	// access node whose secret signed the body.
+	WebhookAccessNodeHeader = "X-Swift-Access-Node"
+)
+
+// SetWebhookURL adds the URL that the final node of the storage operation
+// posts the encrypted results to. Overrides the configured WebhookURL for the
+// operation. An error is returned if the URL is not absolute.
+func SetWebhookURL(q *url.Values, u string) error {
+	err := validateWebhookURL(u)
+	if err != nil {
+		return err
+	}
+	q.Set(webhookURLParam, u)
+	return nil
+}
+
+// validateWebhookURL returns an error if the URL can not be used to post
+// results.
+func validateWebhookURL(u string) error {
+	w, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if w.Scheme != "http" && w.Scheme != "https" {
+		return fmt.Errorf("Webhook URL '%s' must be HTTP or HTTPS", u)
+	}
+	if w.Host == "" {
+		return fmt.Errorf("Missing host from webhook URL '%s'", u)
+	}
+	return nil
+}
+
+// getWebhookURL returns the URL to post the results of the operation to, or
+// an empty string if there is no webhook.
+func (o *operation) getWebhookURL() string {
+	if o.webhookURL != "" {
+		return o.webhookURL
+	}
+	return o.services.config.WebhookURL
+}
+
+// sendWebhook posts the encrypted results data to the webhook in the
+// background if one is set for the operation. The same data is appended to
+// the return URL so the webhook can decode it in the same way.
+func (o *operation) sendWebhook(data string) {
+	u := o.getWebhookURL()
+	if u == "" {
+		return
+	}
+	a, err := o.services.store.getNode(o.getContext(), o.accessNode)
+	if err != nil {
+		o.services.logger.Error("Webhook '%s' not sent: %s", u, err)
+		return
+	}
+	if a == nil {
+		o.services.logger.Error(
+			"Webhook '%s' not sent: access node '%s' not found",
+			u,
+			o.accessNode)
+		return
+	}
+	go func() {
+		err := o.services.postWebhook(u, a, data)
+		if err != nil {
+			o.services.logger.Error("%s", err)
+		}
+	}()
+}
+
+// postWebhook posts the data signed with the newest secret of the access node
+// to the URL. Failed requests are retried with a doubling delay until the
+// configured number of retries is exhausted.
+func (s *Services) postWebhook(u string, a *node, data string) error {
+	x, err := a.getSecret()
+	if err != nil {
+		return err
+	}
+	g := base64.RawURLEncoding.EncodeToString(
+		getWebhookSignature(x, []byte(data)))
+	c := http.Client{Timeout: s.config.webhookTimeout()}
+	d := s.config.webhookRetryDelay()
+	for i := 0; ; i++ {
+		err = postWebhookOnce(&c, u, a.domain, g, data)
+		if err == nil || i >= s.config.webhookRetries() {
+			break
+		}
+		s.logger.Warn("Webhook '%s' attempt '%d' failed: %s", u, i+1, err)
+		time.Sleep(d)
+		d *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("Webhook '%s' failed: %w", u, err)
+	}
+	return nil
+}
+
+// postWebhookOnce posts the data and returns an error if the webhook did not
+// respond with a success status code.
+func postWebhookOnce(c *http.Client, u, a, g, data string) error {
+	r, err := http.NewRequest("POST", u, strings.NewReader(data))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	r.Header.Set(WebhookSignatureHeader, g)
+	r.Header.Set(WebhookAccessNodeHeader, a)
+	res, err := c.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newResponseError(u, res)
+	}
+	return nil
+}
+
+// VerifyWebhook returns an error if the signature header of the webhook
+// request does not match the body for any of the access node's secrets. Used
+// by the receiver of the webhook to confirm the results came from the network.
+// The body can then be decoded in the same way as the data appended to the
+// return URL.
+func (s *Services) VerifyWebhook(
+	ctx context.Context,
+	accessNode string,
+	signature string,
+	body []byte) error {
+	a, err := s.store.getNode(ctx, accessNode)
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		return fmt.Errorf("Node '%s': %w", accessNode, ErrNotSwiftNode)
+	}
+	v, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	for _, x := range a.secrets {
+		if x != nil && hmac.Equal(v, getWebhookSignature(x, body)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Webhook signature invalid")
+}
+
+// getWebhookSignature returns the HMAC of the webhook body using a key derived
+// from the secret.
+func getWebhookSignature(x *secret, d []byte) []byte {
+	k := sha256.Sum256([]byte(webhookSignatureKey + x.key))
+	h := hmac.New(sha256.New, k[:])
+	h.Write(d)
+	return h.Sum(nil)
+}
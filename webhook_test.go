@@ -0,0 +1,200 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swift
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookTest records the requests received by the stub webhook server.
+type webhookTest struct {
+	body      string
+	signature string
+	node      string
+}
+
+func TestWebhookReceived(t *testing.T) {
+	c := make(chan webhookTest, 1)
+	h := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			c <- webhookTest{
+				string(b),
+				r.Header.Get(WebhookSignatureHeader),
+				r.Header.Get(WebhookAccessNodeHeader)}
+		}))
+	defer h.Close()
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	o := newOperation(s, nil)
+	o.accessNode = testAccess
+	o.webhookURL = h.URL
+	o.sendWebhook("results")
+	var a webhookTest
+	select {
+	case a = <-c:
+	case <-time.After(time.Second * 5):
+		fmt.Println("Webhook not received")
+		t.Fail()
+		return
+	}
+	if a.body != "results" || a.node != testAccess {
+		fmt.Printf("Unexpected webhook '%s' from '%s'\n", a.body, a.node)
+		t.Fail()
+	}
+	err = s.VerifyWebhook(
+		context.Background(),
+		a.node,
+		a.signature,
+		[]byte(a.body))
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+	err = s.VerifyWebhook(
+		context.Background(),
+		a.node,
+		a.signature,
+		[]byte("forged"))
+	if err == nil {
+		fmt.Println("Forged webhook body should be rejected")
+		t.Fail()
+	}
+}
+
+func TestWebhookRetried(t *testing.T) {
+	var n int32
+	h := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&n, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+	defer h.Close()
+	s, a, err := newWebhookTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	err = s.postWebhook(h.URL, a, "results")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if n != 3 {
+		fmt.Printf("Expected '3' requests but got '%d'\n", n)
+		t.Fail()
+	}
+}
+
+func TestWebhookRetriesExhausted(t *testing.T) {
+	var n int32
+	h := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&n, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer h.Close()
+	s, a, err := newWebhookTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	s.config.WebhookRetries = 2
+	err = s.postWebhook(h.URL, a, "results")
+	if err == nil {
+		fmt.Println("Failing webhook should return an error")
+		t.Fail()
+	}
+	if n != 3 {
+		fmt.Printf("Expected '3' requests but got '%d'\n", n)
+		t.Fail()
+	}
+}
+
+func TestWebhookCreate(t *testing.T) {
+	s, err := newCreateTest()
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	q := newCreateValuesTest()
+	q.Set(testKey("a"), "1")
+	err = SetWebhookURL(&q, "https://webhook.com/results")
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	c := testCreate(s, q)
+	if c.Code != http.StatusOK {
+		fmt.Println(c.Body.String())
+		t.Fail()
+		return
+	}
+	o, err := testOperationFromURL(s, c.Body.String())
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	if o.getWebhookURL() != "https://webhook.com/results" {
+		fmt.Printf("Unexpected webhook URL '%s'\n", o.getWebhookURL())
+		t.Fail()
+	}
+	if SetWebhookURL(&q, "ftp://webhook.com/") == nil {
+		fmt.Println("Webhook URL that is not HTTP should be invalid")
+		t.Fail()
+	}
+	q.Set(webhookURLParam, "/results")
+	if c = testCreate(s, q); c.Code != http.StatusBadRequest {
+		fmt.Printf("Expected '%d' but got '%d'\n",
+			http.StatusBadRequest,
+			c.Code)
+		t.Fail()
+	}
+}
+
+// newWebhookTest returns services that retry webhooks quickly and the access
+// node that signs them.
+func newWebhookTest() (*Services, *node, error) {
+	s, err := newCreateTest()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.config.WebhookRetryDelay = 1
+	a, err := s.store.getNode(context.Background(), testAccess)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, a, nil
+}